@@ -51,8 +51,8 @@ func runPublish(url string, args []string) error {
 		if apiErr, ok := err.(*metax.ApiError); ok {
 			fmt.Fprintf(os.Stderr, "metax error: %s\n", apiErr.OriginalError())
 		}
-		if dbErr, ok := err.(*psql.DatabaseError); ok {
-			fmt.Fprintf(os.Stderr, "database error: %s\n", dbErr.Error())
+		if _, ok := psql.Cause(err).(*psql.DatabaseError); ok {
+			fmt.Fprintf(os.Stderr, "database error: %s\n", err.Error())
 		}
 		return err
 	}
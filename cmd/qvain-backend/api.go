@@ -99,6 +99,8 @@ func (apis *Apis) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case "version":
 		versionC.Add(1)
 		ifGet(w, r, apiVersion)
+	case "families":
+		ifGet(w, r, apiFamilies)
 	case "vars":
 		expvar.Handler().ServeHTTP(w, r)
 	case "":
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"net/http"
 	"path"
 	"strings"
@@ -8,6 +9,7 @@ import (
 	"github.com/CSCfi/qvain-api/internal/psql"
 	"github.com/CSCfi/qvain-api/internal/sessions"
 	"github.com/CSCfi/qvain-api/internal/version"
+	"github.com/CSCfi/qvain-api/pkg/models"
 
 	"github.com/francoispqt/gojay"
 	"github.com/wvh/uuid"
@@ -189,6 +191,41 @@ func apiVersion(w http.ResponseWriter, r *http.Request) {
 	enc.Write()
 }
 
+// familyInfo describes a dataset family for the family picker in the editor.
+type familyInfo struct {
+	Id       models.Family   `json:"id"`
+	Name     string          `json:"name"`
+	Parent   *models.Family  `json:"parent,omitempty"`
+	Children []models.Family `json:"children"`
+	Partial  bool            `json:"partial"`
+	Key      string          `json:"key,omitempty"`
+}
+
+// apiFamilies lists the registered dataset families with their place in the family hierarchy.
+func apiFamilies(w http.ResponseWriter, r *http.Request) {
+	families := models.Families()
+	list := make([]familyInfo, 0, len(families))
+	for _, fam := range families {
+		info := familyInfo{
+			Id:       fam.Id,
+			Name:     fam.Name,
+			Children: []models.Family{},
+			Partial:  fam.IsPartial(),
+			Key:      fam.Key(),
+		}
+		if parent := fam.Parent(); parent != nil {
+			info.Parent = &parent.Id
+		}
+		for _, child := range fam.Children() {
+			info.Children = append(info.Children, child.Id)
+		}
+		list = append(list, info)
+	}
+
+	apiWriteHeaders(w)
+	json.NewEncoder(w).Encode(list)
+}
+
 func apiDatabaseCheck(db *psql.DB) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
@@ -196,17 +233,25 @@ func apiDatabaseCheck(db *psql.DB) http.Handler {
 			return
 		}
 
-		err := db.Check()
+		err := db.Ping(r.Context())
+		stats := db.Stats()
 
 		enc := gojay.BorrowEncoder(w)
 		defer enc.Release()
 
 		apiWriteHeaders(w)
+		if err != nil {
+			// let readiness probes see the database is down
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
 		enc.AppendByte('{')
 		enc.AddBoolKey("alive", err == nil)
 		if err != nil {
 			enc.AddStringKey("error", err.Error())
 		}
+		enc.AddIntKey("open", stats.Open)
+		enc.AddIntKey("idle", stats.Idle)
+		enc.AddIntKey("in_use", stats.InUse)
 		enc.AppendByte('}')
 		enc.Write()
 	})
@@ -215,21 +260,49 @@ func apiDatabaseCheck(db *psql.DB) http.Handler {
 // dbError handles database errors. It returns more specific API messages for predefined errors
 // that might be relevant for the user. Other errors return `database error` with a 500 status code.
 func dbError(w http.ResponseWriter, err error) bool {
+	err = psql.Cause(err)
+	if verr, ok := err.(*psql.ValidationError); ok {
+		payload, _ := json.Marshal(verr.Violations)
+		jsonErrorWithPayload(w, "dataset does not validate against schema "+verr.Schema, "database", payload, http.StatusBadRequest)
+		return true
+	}
+
 	switch err {
 	case nil:
 		return false
 	// meta
-	case psql.ErrExists:
+	case psql.ErrExists, psql.ErrAlreadyExists:
 		jsonError(w, "resource exists already", http.StatusConflict)
 	case psql.ErrNotFound:
 		jsonError(w, "resource not found", http.StatusNotFound)
 	case psql.ErrNotOwner:
 		jsonError(w, "not resource owner", http.StatusForbidden)
-	case psql.ErrInvalidJson:
+	case psql.ErrInvalidJson, psql.ErrInvalidTag, psql.ErrInvalidPermission, psql.ErrInvalidID, psql.ErrInvalidKey, psql.ErrInvalidOrder, psql.ErrSchemaFamilyMismatch, psql.ErrInvalidSlug, psql.ErrUnknownFamily, psql.ErrCreatorOwnerMismatch, psql.ErrSameUser:
 		jsonError(w, "invalid input", http.StatusBadRequest)
+	case psql.ErrUnknownUser:
+		jsonError(w, "unknown user", http.StatusBadRequest)
+	case psql.ErrSlugTaken:
+		jsonError(w, "slug is already in use", http.StatusConflict)
+	case psql.ErrConflict:
+		jsonError(w, "resource has been modified", http.StatusConflict)
+	case psql.ErrArchived:
+		jsonError(w, "resource is archived", http.StatusConflict)
+	case psql.ErrCompressed:
+		jsonError(w, "resource is compressed and can only be replaced", http.StatusConflict)
+	case psql.ErrLocked:
+		jsonError(w, "resource is being edited by another user", http.StatusLocked)
+	case psql.ErrQuotaExceeded:
+		jsonError(w, "dataset quota exceeded", http.StatusForbidden)
+	case psql.ErrBlobTooLarge:
+		jsonError(w, "dataset too large", http.StatusRequestEntityTooLarge)
+	case psql.ErrNotModified:
+		// a 304 response can't have a body
+		w.WriteHeader(http.StatusNotModified)
 	// connection
 	case psql.ErrConnection:
 		jsonError(w, "no database connection", http.StatusServiceUnavailable)
+	case psql.ErrUnavailable:
+		jsonError(w, "database unavailable", http.StatusServiceUnavailable)
 	case psql.ErrTimeout:
 		jsonError(w, "database timeout", http.StatusServiceUnavailable)
 	case psql.ErrTemporary:
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/rs/zerolog"
 
@@ -109,12 +112,73 @@ func (config *Config) NewLogger(name string) zerolog.Logger {
 }
 
 // initDB initialises a new database pool to be used across the application.
+// If APP_DB_REPLICA is set, read-only queries go to that database.
+// Dataset blobs are validated against the JSON schemas found in APP_SCHEMA_DIR, if set, and the `schemas` table.
+// If APP_DATASET_QUOTA is set, users can't own more than that number of datasets.
+// If APP_DB_STATEMENT_TIMEOUT is set, database statements running longer than that duration are cancelled.
+// APP_MAX_BLOB_BYTES overrides the default size limit of dataset blobs.
+// If APP_COMPRESSION_THRESHOLD is set, dataset blobs larger than that number of bytes are stored compressed.
+// If APP_DB_SCHEMA is set, tables are looked up in that Postgres schema instead of the default search path.
+// Dataset reads are recorded in the background so abandoned drafts can be cleaned up.
 func (config *Config) initDB(logger zerolog.Logger) (err error) {
-	config.db, err = psql.NewPoolServiceFromEnv()
-	if err == nil {
-		config.db.SetLogger(logger)
+	config.db, err = psql.NewServiceFromEnv()
+	if err != nil {
+		return err
+	}
+	config.db.SetLogger(logger)
+	config.db.Schema = env.Get("APP_DB_SCHEMA")
+
+	if err = config.db.InitPool(); err != nil {
+		return err
+	}
+	config.db.TrackAccess(context.Background(), psql.DefaultAccessFlushInterval)
+
+	if replica := env.Get("APP_DB_REPLICA"); replica != "" {
+		if err = config.db.InitReplicaPool(replica); err != nil {
+			return fmt.Errorf("can't initialise replica pool: %s", err)
+		}
+	}
+
+	if timeout := env.Get("APP_DB_STATEMENT_TIMEOUT"); timeout != "" {
+		config.db.StatementTimeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			return fmt.Errorf("invalid statement timeout: %q", timeout)
+		}
+	}
+
+	if size := env.Get("APP_MAX_BLOB_BYTES"); size != "" {
+		config.db.MaxBlobBytes, err = strconv.Atoi(size)
+		if err != nil || config.db.MaxBlobBytes < 0 {
+			return fmt.Errorf("invalid blob size limit: %q", size)
+		}
+	}
+
+	if size := env.Get("APP_COMPRESSION_THRESHOLD"); size != "" {
+		config.db.CompressionThreshold, err = strconv.Atoi(size)
+		if err != nil || config.db.CompressionThreshold < 0 {
+			return fmt.Errorf("invalid compression threshold: %q", size)
+		}
+	}
+
+	if quota := env.Get("APP_DATASET_QUOTA"); quota != "" {
+		limit, err := strconv.Atoi(quota)
+		if err != nil || limit < 1 {
+			return fmt.Errorf("invalid dataset quota: %q", quota)
+		}
+		config.db.SetQuotaChecker(psql.CountQuota{Max: limit})
+	}
+
+	schemas := models.NewSchemaRegistry()
+	if dir := env.Get("APP_SCHEMA_DIR"); dir != "" {
+		if err = schemas.LoadDir(dir); err != nil {
+			return fmt.Errorf("can't load schemas: %s", err)
+		}
+	}
+	if err = config.db.LoadSchemas(schemas); err != nil {
+		return fmt.Errorf("can't load schemas from database: %s", err)
 	}
-	return err
+	config.db.SetSchemaRegistry(schemas)
+	return nil
 }
 
 // initSessions initialises the session manager.
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"io"
+	"io/ioutil"
 	"net/http"
 	"strings"
 
@@ -74,6 +76,19 @@ func (api *DatasetApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// dry-run validation
+	if head == "validate" {
+		switch r.Method {
+		case http.MethodPost:
+			api.validateDataset(w, r)
+		case http.MethodOptions:
+			apiWriteOptions(w, "POST, OPTIONS")
+		default:
+			jsonError(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
 	// dataset uuid
 	id, err := GetUuidParam(head)
 	if err != nil {
@@ -212,14 +227,60 @@ func (api *DatasetApi) createDataset(w http.ResponseWriter, r *http.Request, cre
 		return
 	}
 
-	err = api.db.Create(typed.Unwrap())
+	// clients can send an Idempotency-Key header so a retried request doesn't create a second dataset
+	id := typed.Unwrap().Id
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		id, err = api.db.StoreIdempotentContext(r.Context(), typed.Unwrap(), key)
+	} else {
+		err = api.db.Create(typed.Unwrap())
+	}
 	if err != nil {
 		//jsonError(w, "store failed", http.StatusBadRequest)
 		dbError(w, err)
 		return
 	}
 
-	api.Created(w, r, typed.Unwrap().Id)
+	api.Created(w, r, id)
+}
+
+// validateDataset checks the request body against the schema given in the `schema` query parameter without storing anything.
+// It returns 204 No Content if the blob would be accepted, or the same error a save would return.
+func (api *DatasetApi) validateDataset(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		jsonError(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	schema := r.URL.Query().Get("schema")
+	if schema == "" {
+		jsonError(w, "missing schema parameter", http.StatusBadRequest)
+		return
+	}
+
+	if r.Body == nil || r.Body == http.NoBody {
+		jsonError(w, "empty body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	// read one byte past the limit so oversized blobs are reported as such
+	var body io.Reader = r.Body
+	if api.db.MaxBlobBytes > 0 {
+		body = io.LimitReader(r.Body, int64(api.db.MaxBlobBytes)+1)
+	}
+	blob, err := ioutil.ReadAll(body)
+	if err != nil {
+		jsonError(w, "can't read body", http.StatusBadRequest)
+		return
+	}
+
+	if err = api.db.Validate(schema, blob); err != nil {
+		dbError(w, err)
+		return
+	}
+
+	apiWriteHeaders(w)
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (api *DatasetApi) updateDataset(w http.ResponseWriter, r *http.Request, owner *models.User, id uuid.UUID) {
@@ -264,7 +325,7 @@ func (api *DatasetApi) publishDataset(w http.ResponseWriter, r *http.Request, ow
 		case *metax.ApiError:
 			api.logger.Warn().Err(err).Str("dataset", id.String()).Str("owner", owner.String()).Str("origin", "api").Msg("publish failed")
 			jsonErrorWithPayload(w, t.Error(), "metax", t.OriginalError(), convertExternalStatusCode(t.StatusCode()))
-		case *psql.DatabaseError:
+		case *psql.DatabaseError, *psql.OpError:
 			api.logger.Error().Err(err).Str("dataset", id.String()).Str("owner", owner.String()).Str("origin", "database").Msg("publish failed")
 			dbError(w, err)
 		default:
@@ -278,7 +339,7 @@ func (api *DatasetApi) publishDataset(w http.ResponseWriter, r *http.Request, ow
 }
 
 func (api *DatasetApi) deleteDataset(w http.ResponseWriter, r *http.Request, owner uuid.UUID, id uuid.UUID) {
-	err := api.db.Delete(id, &owner)
+	err := api.db.SoftDelete(id, &owner)
 	if err != nil {
 		dbError(w, err)
 		return
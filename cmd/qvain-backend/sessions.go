@@ -109,6 +109,11 @@ func MakeSessionHandlerForFairdata(mgr *sessions.Manager, db *psql.DB, onLogin l
 			Organisation: claims.Org,
 		}
 
+		if err = db.UpdateUserInfo(uid, name, claims.Email); err != nil {
+			// not fatal, listings just won't show the user's name
+			logger.Warn().Err(err).Str("uid", uid.String()).Msg("failed to update user info")
+		}
+
 		// filter project names returned from the token to include only IDA project numbers
 		projects := filterOnAndTrimPrefix(claims.Projects, FairdataTokenProjectPrefixes...)
 		if len(projects) > 0 {
@@ -0,0 +1,135 @@
+package psql
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/wvh/uuid"
+)
+
+// DefaultAccessFlushInterval is the interval at which recorded dataset reads are written to the database.
+const DefaultAccessFlushInterval = time.Minute
+
+// accessLog collects the ids of datasets read since the last flush, so access times can be written in one statement
+// instead of on every read.
+type accessLog struct {
+	mu  sync.Mutex
+	ids map[uuid.UUID]struct{}
+}
+
+// touch records a read of the dataset.
+func (access *accessLog) touch(id uuid.UUID) {
+	access.mu.Lock()
+	access.ids[id] = struct{}{}
+	access.mu.Unlock()
+}
+
+// take returns the recorded ids and starts a new collection.
+func (access *accessLog) take() [][16]byte {
+	access.mu.Lock()
+	ids := access.ids
+	access.ids = make(map[uuid.UUID]struct{}, len(ids))
+	access.mu.Unlock()
+
+	arrays := make([][16]byte, 0, len(ids))
+	for id := range ids {
+		arrays = append(arrays, *id.Array())
+	}
+	return arrays
+}
+
+// TrackAccess records reads through Get and GetWithOwner and writes their time to the `dataset_access` table
+// at the given interval, until the context is cancelled. Access times are used by DeleteStaleDrafts.
+// Reads are not recorded unless this is called. It is not safe to call this function after initialisation.
+func (psql *DB) TrackAccess(ctx context.Context, interval time.Duration) {
+	psql.access = &accessLog{ids: make(map[uuid.UUID]struct{})}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				// write what is left with a fresh context, the given one is done
+				psql.FlushAccess(context.Background())
+				return
+			}
+
+			if _, err := psql.FlushAccess(ctx); err != nil && ctx.Err() == nil {
+				psql.logger.Warn().Err(err).Msg("can't record dataset access")
+			}
+		}
+	}()
+}
+
+// touch records a read of the dataset if access tracking is enabled.
+func (db *DB) touch(id uuid.UUID) {
+	if db.access != nil {
+		db.access.touch(id)
+	}
+}
+
+// FlushAccess writes the access time of the datasets read since the last flush and returns the number of datasets updated.
+// It is called periodically by TrackAccess. Ids of datasets that have been deleted in the meantime are dropped.
+func (db *DB) FlushAccess(ctx context.Context) (int64, error) {
+	if db.access == nil {
+		return 0, nil
+	}
+
+	ids := db.access.take()
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	ct, err := db.pool.ExecEx(ctx, `
+		INSERT INTO dataset_access(dataset, accessed)
+		SELECT id, now() FROM datasets WHERE id = ANY($1)
+		ON CONFLICT (dataset) DO UPDATE SET accessed = EXCLUDED.accessed`,
+		nil, ids)
+	if err != nil {
+		return 0, handleContextError(ctx, err)
+	}
+	return ct.RowsAffected(), nil
+}
+
+// DeleteStaleDrafts permanently deletes abandoned drafts and returns the number of datasets removed.
+// A draft is abandoned if it was never published or sent to Metax, still has no title, and hasn't been created, modified
+// or – if access is tracked – read since the cutoff.
+func (db *DB) DeleteStaleDrafts(olderThan time.Time) (int64, error) {
+	return db.DeleteStaleDraftsContext(context.Background(), olderThan)
+}
+
+// DeleteStaleDraftsContext permanently deletes abandoned drafts within the given context.
+func (db *DB) DeleteStaleDraftsContext(ctx context.Context, olderThan time.Time) (n int64, err error) {
+	defer db.observe("delete stale drafts", time.Now(), &err)
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return 0, wrapError("delete stale drafts", uuid.UUID{}, err)
+	}
+	defer tx.Rollback()
+
+	// greatest() ignores NULLs, so a missing access time falls back to the creation and modification dates
+	err = tx.QueryRow(`
+		WITH deleted AS (
+			DELETE FROM datasets d
+			WHERE NOT coalesce(d.published, false) AND d.metax_id IS NULL AND d.title IS NULL
+				AND greatest(d.created, d.modified, (SELECT accessed FROM dataset_access WHERE dataset = d.id)) < $1
+			RETURNING id
+		), history AS (
+			DELETE FROM ownership_history WHERE dataset IN (SELECT id FROM deleted)
+		)
+		SELECT COUNT(*) FROM deleted`,
+		olderThan).Scan(&n)
+	if err != nil {
+		return 0, wrapError("delete stale drafts", uuid.UUID{}, handleContextError(ctx, err))
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, wrapError("delete stale drafts", uuid.UUID{}, err)
+	}
+	return n, nil
+}
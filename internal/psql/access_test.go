@@ -0,0 +1,89 @@
+package psql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/wvh/uuid"
+)
+
+func TestAccessLog(t *testing.T) {
+	access := &accessLog{ids: make(map[uuid.UUID]struct{})}
+
+	other := uuid.MustFromString("11111111111111111111111111111111")
+	access.touch(owner)
+	access.touch(other)
+	access.touch(owner)
+
+	if ids := access.take(); len(ids) != 2 {
+		t.Errorf("expected 2 distinct ids, got %d", len(ids))
+	}
+	if ids := access.take(); len(ids) != 0 {
+		t.Errorf("expected no ids after take, got %d", len(ids))
+	}
+}
+
+func TestFlushAccessUntracked(t *testing.T) {
+	db := &DB{}
+	db.touch(owner)
+	if n, err := db.FlushAccess(context.Background()); n != 0 || err != nil {
+		t.Errorf("expected (0, nil) without tracking, got (%d, %v)", n, err)
+	}
+}
+
+// TestDeleteStaleDrafts tests that only untitled drafts not read since the cutoff are removed.
+func TestDeleteStaleDrafts(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	db, err := NewPoolServiceFromEnv()
+	if err != nil {
+		t.Fatal("psql:", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db.TrackAccess(ctx, time.Hour)
+
+	create := func(blob string) uuid.UUID {
+		dataset, err := models.NewDataset(owner)
+		if err != nil {
+			t.Fatal("models.NewDataset():", err)
+		}
+		dataset.SetData(1, "open test dataset", []byte(blob))
+		if err = db.Create(dataset); err != nil {
+			t.Fatal("db.Create():", err)
+		}
+		return dataset.Id
+	}
+
+	stale, read, titled := create(`{}`), create(`{}`), create(`{"title":"keep me"}`)
+	for _, id := range []uuid.UUID{stale, read, titled} {
+		defer db.Delete(id, nil)
+	}
+
+	cutoff := time.Now().Add(time.Second)
+	time.Sleep(2 * time.Second)
+
+	if _, err = db.Get(read); err != nil {
+		t.Fatal("db.Get():", err)
+	}
+	if n, err := db.FlushAccess(ctx); err != nil || n != 1 {
+		t.Fatalf("FlushAccess: expected (1, nil), got (%d, %v)", n, err)
+	}
+
+	if _, err = db.DeleteStaleDrafts(cutoff); err != nil {
+		t.Fatal("DeleteStaleDrafts:", err)
+	}
+
+	if _, err = db.Get(stale); Cause(err) != ErrNotFound {
+		t.Errorf("stale draft: expected %v, got %v", ErrNotFound, err)
+	}
+	for _, id := range []uuid.UUID{read, titled} {
+		if _, err = db.Get(id); err != nil {
+			t.Errorf("expected dataset %v to be kept, got %v", id, err)
+		}
+	}
+}
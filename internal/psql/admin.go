@@ -0,0 +1,122 @@
+package psql
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/wvh/uuid"
+)
+
+// AdminFilter restricts a listing across all users; nil fields are not filtered on.
+type AdminFilter struct {
+	Family    *models.Family
+	Schema    *string
+	Published *bool
+
+	// CreatedBefore and CreatedAfter are exclusive bounds on the creation date.
+	CreatedBefore *time.Time
+	CreatedAfter  *time.Time
+
+	Owner *uuid.UUID
+}
+
+// where returns SQL conditions for the set fields, each prefixed with AND, and appends their values to args.
+func (filter *AdminFilter) where(args []interface{}) (string, []interface{}) {
+	var sql string
+
+	add := func(cond string, value interface{}) {
+		args = append(args, value)
+		sql += " AND " + cond + " $" + strconv.Itoa(len(args))
+	}
+
+	if filter.Family != nil {
+		add("family =", int(*filter.Family))
+	}
+	if filter.Schema != nil {
+		add("schema =", *filter.Schema)
+	}
+	if filter.Published != nil {
+		add("coalesce(published, false) =", *filter.Published)
+	}
+	if filter.CreatedBefore != nil {
+		add("created <", *filter.CreatedBefore)
+	}
+	if filter.CreatedAfter != nil {
+		add("created >", *filter.CreatedAfter)
+	}
+	if filter.Owner != nil {
+		add("owner =", filter.Owner.Array())
+	}
+
+	return sql, args
+}
+
+// ListAll returns a page of datasets of all users matching the filter, along with the total number of matching datasets.
+//
+// This is meant for administrators only: it isn't scoped to an owner, so it must not be reachable by regular API users.
+func (db *DB) ListAll(filter AdminFilter, limit, offset int) ([]*models.Dataset, int, error) {
+	return db.ListAllContext(context.Background(), filter, limit, offset)
+}
+
+// ListAllContext returns a page of datasets of all users within the given context, ordered by creation date with the newest first.
+// The limit is capped to MaxPageSize. It reads from the replica if one is configured; see WithReadConsistency.
+func (db *DB) ListAllContext(ctx context.Context, filter AdminFilter, limit, offset int) (_ []*models.Dataset, _ int, err error) {
+	defer db.observe("list all", time.Now(), &err)
+
+	limit = clampLimit(limit)
+	if offset < 0 {
+		offset = 0
+	}
+
+	tx, err := db.beginRead(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	where, args := filter.where(nil)
+
+	var total int
+	err = tx.QueryRow("SELECT COUNT(*) FROM datasets WHERE deleted IS NULL"+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, handleContextError(ctx, err)
+	}
+
+	args = append(args, limit, offset)
+	list, err := tx.listDatasets(`
+		SELECT id, creator, owner, created, family, schema, valid
+		FROM datasets
+		WHERE deleted IS NULL`+where+`
+		ORDER BY created DESC, id
+		LIMIT $`+strconv.Itoa(len(args)-1)+` OFFSET $`+strconv.Itoa(len(args)),
+		args...)
+	if err != nil {
+		return nil, 0, handleContextError(ctx, err)
+	}
+
+	return list, total, nil
+}
+
+// ListCreatedBetween returns a page of the header fields of datasets of all users created in the half-open interval [from, to),
+// for reporting on dataset creation rates.
+//
+// This is meant for administrators only: it isn't scoped to an owner, so it must not be reachable by regular API users.
+func (db *DB) ListCreatedBetween(from, to time.Time, limit, offset int) ([]*DatasetMeta, error) {
+	return db.ListCreatedBetweenContext(context.Background(), from, to, limit, offset)
+}
+
+// ListCreatedBetweenContext returns a page of datasets of all users created in [from, to) within the given context, oldest first.
+// Soft-deleted datasets are not included. The limit is capped to MaxPageSize.
+// It reads from the replica if one is configured; see WithReadConsistency.
+func (db *DB) ListCreatedBetweenContext(ctx context.Context, from, to time.Time, limit, offset int) (_ []*DatasetMeta, err error) {
+	defer db.observe("list all", time.Now(), &err)
+
+	limit = clampLimit(limit)
+	if offset < 0 {
+		offset = 0
+	}
+
+	return db.listMeta(ctx, "created >= $1 AND created < $2 AND deleted IS NULL ORDER BY created, id LIMIT $3 OFFSET $4", from, to, limit, offset)
+}
@@ -0,0 +1,47 @@
+package psql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+)
+
+func TestAdminFilterWhere(t *testing.T) {
+	family, published := models.FamilyMetax, false
+	before := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		filter AdminFilter
+		sql    string
+		args   []interface{}
+	}{
+		{name: "empty", filter: AdminFilter{}, sql: "", args: nil},
+		{
+			name:   "family and unpublished",
+			filter: AdminFilter{Family: &family, Published: &published},
+			sql:    " AND family = $1 AND coalesce(published, false) = $2",
+			args:   []interface{}{2, false},
+		},
+		{
+			name:   "created before and owner",
+			filter: AdminFilter{CreatedBefore: &before, Owner: &owner},
+			sql:    " AND created < $1 AND owner = $2",
+			args:   []interface{}{before, owner.Array()},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sql, args := test.filter.where(nil)
+			if sql != test.sql {
+				t.Errorf("expected sql %q, got %q", test.sql, sql)
+			}
+			if !reflect.DeepEqual(args, test.args) {
+				t.Errorf("expected args %v, got %v", test.args, args)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package psql
+
+import (
+	"context"
+	"time"
+
+	"github.com/wvh/uuid"
+)
+
+// Archive moves the blob of a published dataset to cold storage, keeping its metadata in the datasets table.
+// Reads return the archived blob transparently; replacing the blob restores the dataset, but patches fail with ErrArchived until Unarchive is called.
+// Archiving an archived dataset has no effect.
+func (db *DB) Archive(id uuid.UUID) error {
+	return db.ArchiveContext(context.Background(), id)
+}
+
+// ArchiveContext moves the blob of a published dataset to cold storage within the given context.
+// It returns ErrConflict if the dataset isn't published, is compressed, or has changes that haven't been synced yet.
+func (db *DB) ArchiveContext(ctx context.Context, id uuid.UUID) (err error) {
+	defer db.observe("archive", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return wrapError("archive", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("archive", id, err)
+	}
+	defer tx.Rollback()
+
+	ct, err := tx.Exec(`
+		INSERT INTO archived_datasets(dataset, blob)
+		SELECT id, blob FROM datasets
+		WHERE id = $1 AND deleted IS NULL AND published AND NOT archived AND blob IS NOT NULL AND synced >= modified
+		ON CONFLICT (dataset) DO UPDATE SET blob = EXCLUDED.blob, archived = now()`,
+		id.Array())
+	if err != nil {
+		return wrapError("archive", id, handleContextError(ctx, err))
+	}
+
+	if ct.RowsAffected() != 1 {
+		archived, err := tx.isArchived(id)
+		if err != nil {
+			return wrapError("archive", id, handleContextError(ctx, err))
+		}
+		if !archived {
+			return wrapError("archive", id, ErrConflict)
+		}
+		return nil
+	}
+
+	_, err = tx.Exec("UPDATE datasets SET blob = NULL, archived = true WHERE id = $1", id.Array())
+	if err != nil {
+		return wrapError("archive", id, handleContextError(ctx, err))
+	}
+
+	return wrapError("archive", id, tx.Commit())
+}
+
+// Unarchive moves the blob of an archived dataset back from cold storage. Unarchiving a dataset that isn't archived has no effect.
+func (db *DB) Unarchive(id uuid.UUID) error {
+	return db.UnarchiveContext(context.Background(), id)
+}
+
+// UnarchiveContext moves the blob of an archived dataset back from cold storage within the given context.
+func (db *DB) UnarchiveContext(ctx context.Context, id uuid.UUID) (err error) {
+	defer db.observe("unarchive", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return wrapError("unarchive", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("unarchive", id, err)
+	}
+	defer tx.Rollback()
+
+	ct, err := tx.Exec(`
+		UPDATE datasets SET blob = archived_datasets.blob, archived = false
+		FROM archived_datasets
+		WHERE datasets.id = $1 AND datasets.archived AND archived_datasets.dataset = datasets.id`,
+		id.Array())
+	if err != nil {
+		return wrapError("unarchive", id, handleContextError(ctx, err))
+	}
+
+	if ct.RowsAffected() != 1 {
+		// not archived, or missing
+		_, err := tx.isArchived(id)
+		return wrapError("unarchive", id, handleContextError(ctx, err))
+	}
+
+	_, err = tx.Exec("DELETE FROM archived_datasets WHERE dataset = $1", id.Array())
+	if err != nil {
+		return wrapError("unarchive", id, handleContextError(ctx, err))
+	}
+
+	return wrapError("unarchive", id, tx.Commit())
+}
+
+// isArchived checks if a dataset is archived; it returns ErrNotFound if there is no such dataset.
+func (tx *Tx) isArchived(id uuid.UUID) (bool, error) {
+	var archived bool
+	err := tx.QueryRow("SELECT archived FROM datasets WHERE id = $1 AND deleted IS NULL", id.Array()).Scan(&archived)
+	if err != nil {
+		return false, handleError(err)
+	}
+	return archived, nil
+}
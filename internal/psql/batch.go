@@ -1,6 +1,7 @@
 package psql
 
 import (
+	"context"
 	"time"
 
 	"github.com/CSCfi/qvain-api/pkg/models"
@@ -14,7 +15,12 @@ type BatchManager struct {
 }
 
 func (db *DB) NewBatch() (*BatchManager, error) {
-	tx, err := db.Begin()
+	return db.NewBatchContext(context.Background())
+}
+
+// NewBatchContext starts a batch whose transaction is bound to the given context.
+func (db *DB) NewBatchContext(ctx context.Context) (*BatchManager, error) {
+	tx, err := db.BeginContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -22,7 +28,12 @@ func (db *DB) NewBatch() (*BatchManager, error) {
 }
 
 func (db *DB) NewBatchForUser(uid uuid.UUID) (*BatchManager, error) {
-	b, err := db.NewBatch()
+	return db.NewBatchForUserContext(context.Background(), uid)
+}
+
+// NewBatchForUserContext starts a batch for a user, bound to the given context.
+func (db *DB) NewBatchForUserContext(ctx context.Context, uid uuid.UUID) (*BatchManager, error) {
+	b, err := db.NewBatchContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -73,12 +84,19 @@ func (b *BatchManager) Rollback() {
 }
 
 func (db *DB) GetLastSync(uid uuid.UUID) (time.Time, error) {
-	tx, err := db.Begin()
+	return db.GetLastSyncContext(context.Background(), uid)
+}
+
+// GetLastSyncContext returns the time of the last synchronisation for a user within the given context.
+func (db *DB) GetLastSyncContext(ctx context.Context, uid uuid.UUID) (time.Time, error) {
+	tx, err := db.BeginContext(ctx)
 	if err != nil {
 		return time.Time{}, err
 	}
 	defer tx.Rollback()
-	return tx.getLastSync(uid)
+
+	last, err := tx.getLastSync(uid)
+	return last, handleContextError(ctx, err)
 }
 
 func (tx *Tx) getLastSync(uid uuid.UUID) (time.Time, error) {
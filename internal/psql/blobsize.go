@@ -0,0 +1,44 @@
+package psql
+
+import (
+	"github.com/wvh/uuid"
+)
+
+// checkBlobSize returns ErrBlobTooLarge if a blob of the given size exceeds the transaction's limit.
+func (tx *Tx) checkBlobSize(size int) error {
+	if tx.maxBlobBytes > 0 && size > tx.maxBlobBytes {
+		return ErrBlobTooLarge
+	}
+	return nil
+}
+
+// checkPatchSize checks the size a blob would have after merging a patch into it.
+// The stored size and the patch size are summed, which overestimates the result if the patch replaces existing keys.
+func (tx *Tx) checkPatchSize(id uuid.UUID, patch []byte) error {
+	if tx.maxBlobBytes <= 0 {
+		return nil
+	}
+
+	var stored int
+	err := tx.QueryRow("SELECT coalesce(octet_length(blob::text), 0) FROM datasets WHERE id = $1", id.Array()).Scan(&stored)
+	if err != nil {
+		return err
+	}
+
+	return tx.checkBlobSize(stored + len(patch))
+}
+
+// checkStoredSize checks the size of a blob already written in this transaction, for updates done in SQL
+// where the resulting size isn't known beforehand. Compressed blobs are measured decompressed.
+func (tx *Tx) checkStoredSize(id uuid.UUID) error {
+	if tx.maxBlobBytes <= 0 {
+		return nil
+	}
+
+	blob, err := tx.lockBlob(id)
+	if err != nil {
+		return err
+	}
+
+	return tx.checkBlobSize(len(blob))
+}
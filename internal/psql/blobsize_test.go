@@ -0,0 +1,34 @@
+package psql
+
+import (
+	"testing"
+)
+
+func TestCheckBlobSize(t *testing.T) {
+	tx := &Tx{maxBlobBytes: DefaultMaxBlobBytes}
+
+	tests := []struct {
+		name string
+		size int
+		err  error
+	}{
+		{name: "under", size: DefaultMaxBlobBytes - 1},
+		{name: "at", size: DefaultMaxBlobBytes},
+		{name: "over", size: DefaultMaxBlobBytes + 1, err: ErrBlobTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := tx.checkBlobSize(test.size); err != test.err {
+				t.Errorf("size %d: expected %v, got %v", test.size, test.err, err)
+			}
+		})
+	}
+}
+
+func TestCheckBlobSizeUnlimited(t *testing.T) {
+	tx := &Tx{}
+	if err := tx.checkBlobSize(DefaultMaxBlobBytes + 1); err != nil {
+		t.Errorf("expected no limit, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package psql
+
+import (
+	"context"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/wvh/uuid"
+)
+
+// DatasetChange is an entry in the changes feed: the current state of a dataset that changed, with its position in the feed.
+type DatasetChange struct {
+	// ChangeId increases globally with every change; clients pass the highest id they've seen to get later changes.
+	ChangeId int64 `json:"change_id"`
+
+	// Deleted is true if the dataset has been soft-deleted.
+	Deleted bool `json:"deleted"`
+
+	Dataset *models.Dataset `json:"-"`
+}
+
+// ChangesForUidSince returns up to limit datasets of a user that changed after the given change id, ordered by change id.
+func (db *DB) ChangesForUidSince(uid uuid.UUID, since int64, limit int) ([]DatasetChange, error) {
+	return db.ChangesForUidSinceContext(context.Background(), uid, since, limit)
+}
+
+// ChangesForUidSinceContext returns the datasets of a user that changed after the given change id within the given context.
+// Pass 0 to start from the beginning. The limit is capped to MaxPageSize.
+//
+// Soft-deleted datasets are included so clients can drop them. Datasets that were purged or transferred to another owner
+// don't show up; clients should do a full listing now and then. Change ids are assigned when a row is written, not when
+// its transaction commits, so a change can appear after one with a higher id; clients that can't tolerate this should
+// poll from a checkpoint slightly behind the highest id seen.
+func (db *DB) ChangesForUidSinceContext(ctx context.Context, uid uuid.UUID, since int64, limit int) ([]DatasetChange, error) {
+	tx, err := db.beginRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT change_id, deleted IS NOT NULL,
+			id, creator, owner, created, modified, synced, seq, published, state, metax_id, modified_by, valid, family, schema, dataset_data(id, blob, blob_gz)
+		FROM datasets
+		WHERE owner = $1 AND change_id > $2
+		ORDER BY change_id
+		LIMIT $3`,
+		uid.Array(), since, clampLimit(limit))
+	if err != nil {
+		return nil, handleContextError(ctx, err)
+	}
+	defer rows.Close()
+
+	var changes []DatasetChange
+	for rows.Next() {
+		var change DatasetChange
+		change.Dataset, err = scanDataset(rows, &change.ChangeId, &change.Deleted)
+		if err != nil {
+			return nil, handleContextError(ctx, err)
+		}
+		changes = append(changes, change)
+	}
+
+	if rows.Err() != nil {
+		return nil, handleContextError(ctx, rows.Err())
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,88 @@
+package psql
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+
+	"github.com/wvh/uuid"
+)
+
+// storedBlob selects the blob of a dataset row as bytes like the dataset_data function, but without reading from cold storage.
+const storedBlob = "coalesce(blob_gz, convert_to(blob::text, 'UTF8'))"
+
+// gzipMagic starts every gzip stream; a JSON document can't start with these bytes.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// compressBlob returns the blob gzip-compressed if it is larger than the transaction's compression threshold, or nil if it should be stored as is.
+func (tx *Tx) compressBlob(blob []byte) ([]byte, error) {
+	if tx.compressionThreshold <= 0 || len(blob) <= tx.compressionThreshold {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(blob); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// blobColumn returns the column a full replacement of a dataset's blob is written to, and the value to write:
+// blob_gz and the compressed blob if it is larger than the compression threshold, blob and the blob itself otherwise.
+// Updates must write only the returned column; the datasets_compress and datasets_decompress triggers clear the other one.
+// Inserts set compressed themselves, as the triggers only fire on update.
+func (tx *Tx) blobColumn(blob []byte) (string, []byte, error) {
+	compressed, err := tx.compressBlob(blob)
+	if err != nil {
+		return "", nil, err
+	}
+	if compressed != nil {
+		return "blob_gz", compressed, nil
+	}
+	return "blob", blob, nil
+}
+
+// checkNotCompressed returns ErrCompressed if the blob of a dataset is stored compressed.
+// Use it before in-place updates that filter on the JSON blob, as they never reach the datasets_decompress trigger.
+func (tx *Tx) checkNotCompressed(id uuid.UUID) error {
+	var compressed bool
+	err := tx.QueryRow("SELECT blob_gz IS NOT NULL FROM datasets WHERE id = $1", id.Array()).Scan(&compressed)
+	if err != nil {
+		return err
+	}
+
+	if compressed {
+		return ErrCompressed
+	}
+	return nil
+}
+
+// lockBlob reads and locks the blob of a dataset for a read-modify-write update, decompressing it if needed.
+// The blob of an archived dataset is nil, as it is in cold storage.
+func (tx *Tx) lockBlob(id uuid.UUID) ([]byte, error) {
+	var blob []byte
+	err := tx.QueryRow("SELECT "+storedBlob+" FROM datasets WHERE id = $1 FOR UPDATE", id.Array()).Scan(&blob)
+	if err != nil {
+		return nil, err
+	}
+	return decompressBlob(blob)
+}
+
+// decompressBlob returns the JSON of a blob read with the dataset_data function or storedBlob, decompressing it if it was stored compressed.
+func decompressBlob(blob []byte) ([]byte, error) {
+	if !bytes.HasPrefix(blob, gzipMagic) {
+		return blob, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return ioutil.ReadAll(zr)
+}
@@ -0,0 +1,65 @@
+package psql
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressBlob(t *testing.T) {
+	blob := []byte(`{"title": {"en": "a dataset with a title long enough to be compressed"}}`)
+
+	tx := &Tx{compressionThreshold: len(blob)}
+	compressed, err := tx.compressBlob(blob)
+	if err != nil || compressed != nil {
+		t.Fatalf("at threshold: expected no compression, got %v (err: %v)", compressed, err)
+	}
+
+	tx.compressionThreshold = len(blob) - 1
+	compressed, err = tx.compressBlob(blob)
+	if err != nil {
+		t.Fatal("compress:", err)
+	}
+	if !bytes.HasPrefix(compressed, gzipMagic) {
+		t.Fatalf("over threshold: expected gzip data, got %q", compressed)
+	}
+
+	decompressed, err := decompressBlob(compressed)
+	if err != nil {
+		t.Fatal("decompress:", err)
+	}
+	if !bytes.Equal(decompressed, blob) {
+		t.Errorf("round trip: expected %s, got %s", blob, decompressed)
+	}
+}
+
+func TestCompressBlobDisabled(t *testing.T) {
+	tx := &Tx{}
+	if compressed, _ := tx.compressBlob(make([]byte, DefaultMaxBlobBytes)); compressed != nil {
+		t.Error("expected compression to be off by default")
+	}
+}
+
+func TestDecompressBlobPlain(t *testing.T) {
+	for _, blob := range [][]byte{nil, []byte(`{}`), []byte(` {"a": 1}`)} {
+		res, err := decompressBlob(blob)
+		if err != nil || !bytes.Equal(res, blob) {
+			t.Errorf("expected %q unchanged, got %q (err: %v)", blob, res, err)
+		}
+	}
+}
+
+func TestBlobColumn(t *testing.T) {
+	blob := []byte(`{"title": {"en": "a dataset with a title long enough to be compressed"}}`)
+
+	tx := &Tx{compressionThreshold: len(blob)}
+	column, data, err := tx.blobColumn(blob)
+	if err != nil || column != "blob" || !bytes.Equal(data, blob) {
+		t.Errorf("at threshold: expected plain blob, got %s %q (err: %v)", column, data, err)
+	}
+
+	tx.compressionThreshold = len(blob) - 1
+	column, data, err = tx.blobColumn(blob)
+	if err != nil || column != "blob_gz" || !bytes.HasPrefix(data, gzipMagic) {
+		t.Errorf("over threshold: expected compressed blob, got %s %q (err: %v)", column, data, err)
+	}
+}
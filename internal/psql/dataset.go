@@ -3,88 +3,265 @@ package psql
 import (
 	//"errors"
 
-	"log"
+	"bytes"
+	"context"
+	"encoding/json"
 	"time"
 
+	"github.com/CSCfi/qvain-api/pkg/jsonpatch"
 	"github.com/CSCfi/qvain-api/pkg/models"
 	"github.com/wvh/uuid"
 )
 
 // Create creates a new dataset. It is a convenience wrapper for the Create method on transactions.
 func (db *DB) Create(dataset *models.Dataset) error {
-	tx, err := db.Begin()
+	return db.CreateContext(context.Background(), dataset)
+}
+
+// CreateContext creates a new dataset within the given context.
+func (db *DB) CreateContext(ctx context.Context, dataset *models.Dataset) (err error) {
+	defer db.observe("create", time.Now(), &err)
+
+	tx, err := db.BeginContext(ctx)
 	if err != nil {
-		return err
+		return wrapError("create", dataset.Id, err)
 	}
 	defer tx.Rollback()
 
 	err = tx.Create(dataset)
 	if err != nil {
-		return handleError(err)
+		return wrapError("create", dataset.Id, handleContextError(ctx, err))
 	}
 
-	return tx.Commit()
+	return wrapError("create", dataset.Id, tx.Commit())
+}
+
+// CreateOnBehalf creates a new dataset that may be owned by someone other than its creator, for admin code creating
+// datasets on behalf of other users. Otherwise it works like Create.
+func (db *DB) CreateOnBehalf(dataset *models.Dataset) error {
+	return db.CreateOnBehalfContext(context.Background(), dataset)
+}
+
+// CreateOnBehalfContext creates a new dataset on behalf of its owner within the given context.
+func (db *DB) CreateOnBehalfContext(ctx context.Context, dataset *models.Dataset) (err error) {
+	defer db.observe("create", time.Now(), &err)
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("create", dataset.Id, err)
+	}
+	defer tx.Rollback()
+
+	tx.AllowCrossUserCreate()
+	err = tx.Create(dataset)
+	if err != nil {
+		return wrapError("create", dataset.Id, handleContextError(ctx, err))
+	}
+
+	return wrapError("create", dataset.Id, tx.Commit())
+}
+
+// AllowCrossUserCreate lets the transaction store datasets owned by someone other than their creator.
+// Only admin code creating datasets on behalf of other users should call it; without it, such datasets are refused.
+func (tx *Tx) AllowCrossUserCreate() {
+	tx.allowCrossUserCreate = true
 }
 
 // BatchStore takes a list of datasets and stores them as new datasets.
 func (db *DB) BatchStore(datasets []*models.Dataset) error {
-	tx, err := db.Begin()
+	return db.BatchStoreContext(context.Background(), datasets)
+}
+
+// BatchStoreContext stores a list of new datasets within the given context.
+// The transaction is retried on serialization failures and deadlocks.
+func (db *DB) BatchStoreContext(ctx context.Context, datasets []*models.Dataset) (err error) {
+	defer db.observe("batch store", time.Now(), &err)
+
+	return db.withRetry(ctx, "batch store", func() error {
+		return db.batchStore(ctx, datasets)
+	})
+}
+
+// batchStore stores a list of new datasets in one serializable transaction, so concurrent batches can't exceed the quota.
+func (db *DB) batchStore(ctx context.Context, datasets []*models.Dataset) error {
+	tx, err := db.BeginWithLevelContext(ctx, LevelSerializable)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
 	// do something batch-like
-	for _, dataset := range datasets {
+	for i, dataset := range datasets {
 		err = tx.Create(dataset)
 		if err != nil {
-			tx.Rollback()
-			return err
+			return &BatchError{Index: i, Err: handleContextError(ctx, err)}
 		}
 	}
 
-	err = tx.Commit()
+	return tx.Commit()
+}
+
+// BatchStorePartial stores a list of new datasets, committing those that succeed.
+// It returns a slice with an error – or nil – for each dataset, and an error if the batch as a whole failed.
+func (db *DB) BatchStorePartial(datasets []*models.Dataset) ([]error, error) {
+	return db.BatchStorePartialContext(context.Background(), datasets)
+}
+
+// BatchStorePartialContext stores a list of new datasets on a best-effort basis within the given context.
+// Each dataset is inserted within its own savepoint so a failing dataset doesn't abort the transaction.
+func (db *DB) BatchStorePartialContext(ctx context.Context, datasets []*models.Dataset) ([]error, error) {
+	tx, err := db.BeginContext(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	return nil
+	errs := make([]error, len(datasets))
+	for i, dataset := range datasets {
+		if _, err = tx.Exec("SAVEPOINT batch_item"); err != nil {
+			return nil, handleContextError(ctx, err)
+		}
+
+		if err = tx.Create(dataset); err != nil {
+			errs[i] = handleContextError(ctx, err)
+			if _, err = tx.Exec("ROLLBACK TO SAVEPOINT batch_item"); err != nil {
+				return nil, handleContextError(ctx, err)
+			}
+			continue
+		}
+
+		if _, err = tx.Exec("RELEASE SAVEPOINT batch_item"); err != nil {
+			return nil, handleContextError(ctx, err)
+		}
+	}
+
+	return errs, tx.Commit()
 }
 
-// Create inserts a new dataset into the database using default values for date and boolean fields.
+// Create inserts a new dataset into the database using default values for date fields.
 // Use this for new datasets created in this application.
+//
+// If a validator is set, the blob is validated against its schema and the dataset is marked valid;
+// a blob that doesn't validate is not stored and a *ValidationError is returned.
+// If a quota checker is set and the owner has reached their quota, ErrQuotaExceeded is returned.
+// A blob larger than the MaxBlobBytes limit is refused with ErrBlobTooLarge, a dataset with nil id with ErrInvalidID.
+// A blob larger than the CompressionThreshold is stored compressed.
+// Unless AllowCrossUserCreate was called, a dataset owned by someone other than its creator is refused with ErrCreatorOwnerMismatch.
 func (tx *Tx) Create(dataset *models.Dataset) error {
-	_, err := tx.Exec("INSERT INTO datasets(id, creator, owner, family, schema, blob) VALUES($1, $2, $3, $4, $5, $6)",
+	valid, err := tx.checkCreate(dataset)
+	if err != nil {
+		return err
+	}
+
+	column, blob, err := tx.blobColumn(dataset.Blob())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO datasets(id, creator, owner, valid, family, schema, "+column+", compressed) VALUES($1, $2, $3, coalesce($4, false), $5, $6, $7, $8)",
 		dataset.Id.Array(),
 		dataset.Creator.Array(),
 		dataset.Owner.Array(),
-		dataset.Family(),
+		valid,
+		int(dataset.Family()),
 		dataset.Schema(),
-		dataset.Blob(),
+		blob,
+		column == "blob_gz",
 	)
 	if err != nil {
 		return err
 	}
 
+	if valid != nil {
+		dataset.SetValid(*valid)
+	}
+
+	return nil
+}
+
+// checkCreate runs the checks Create applies to a new dataset and returns its validation result; see Create.
+func (tx *Tx) checkCreate(dataset *models.Dataset) (*bool, error) {
+	if err := checkID(dataset.Id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.checkCreator(dataset); err != nil {
+		return nil, err
+	}
+
+	if err := checkBlob(dataset.Blob()); err != nil {
+		return nil, err
+	}
+
+	if err := checkFamilySchema(dataset.Family(), dataset.Schema()); err != nil {
+		return nil, err
+	}
+
+	if err := tx.checkBlobSize(len(dataset.Blob())); err != nil {
+		return nil, err
+	}
+
+	valid, err := tx.validate(dataset.Schema(), dataset.Blob())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.checkQuota(dataset.Owner); err != nil {
+		return nil, err
+	}
+
+	return valid, nil
+}
+
+// checkCreator returns ErrCreatorOwnerMismatch if a new dataset is owned by someone other than its creator, unless the transaction allows it.
+func (tx *Tx) checkCreator(dataset *models.Dataset) error {
+	if !tx.allowCrossUserCreate && dataset.Creator != dataset.Owner {
+		return ErrCreatorOwnerMismatch
+	}
 	return nil
 }
 
 // createWithMetadata inserts a new dataset into the database, but also populates other fields.
-// Use this when the new dataset already has some metadata fields set, such as when it origates from other services.
+// Use this when the new dataset already has some metadata fields set, such as when it origates from other services;
+// the dataset's origin is recorded as OriginService.
 //
-// This method does not set Modified, as that field is reserved for user edits.
+// This method does not set Modified, as that field is reserved for user edits. A zero Created is stored as the current time,
+// a zero Synced as NULL.
 func (tx *Tx) createWithMetadata(dataset *models.Dataset) error {
-	_, err := tx.Exec("INSERT INTO datasets(id, creator, owner, created, synced, published, valid, family, schema, blob) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+	if err := tx.checkCreator(dataset); err != nil {
+		return err
+	}
+
+	if err := checkBlob(dataset.Blob()); err != nil {
+		return err
+	}
+
+	if err := checkFamilySchema(dataset.Family(), dataset.Schema()); err != nil {
+		return err
+	}
+
+	if err := tx.checkQuota(dataset.Owner); err != nil {
+		return err
+	}
+
+	column, blob, err := tx.blobColumn(dataset.Blob())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO datasets(id, creator, owner, created, synced, published, valid, family, schema, "+column+", compressed, origin) VALUES($1, $2, $3, coalesce($4, now()), $5, $6, $7, $8, $9, $10, $11, $12)",
 		dataset.Id.Array(),
 		dataset.Creator.Array(),
 		dataset.Owner.Array(),
-		dataset.Created,
-		dataset.Synced,
+		timeOrNull(dataset.Created),
+		timeOrNull(dataset.Synced),
 		dataset.Published,
 		dataset.IsValid(),
-		dataset.Family(),
+		int(dataset.Family()),
 		dataset.Schema(),
-		dataset.Blob(),
+		blob,
+		column == "blob_gz",
+		string(OriginService),
 	)
 	if err != nil {
 		return err
@@ -93,14 +270,134 @@ func (tx *Tx) createWithMetadata(dataset *models.Dataset) error {
 	return nil
 }
 
+// Upsert stores a dataset, updating the blob of an existing dataset with the same id instead of failing.
+// It reports whether the dataset was inserted (true) or updated (false).
+func (db *DB) Upsert(dataset *models.Dataset) (bool, error) {
+	return db.UpsertContext(context.Background(), dataset)
+}
+
+// UpsertContext stores or updates a dataset within the given context.
+// Because the conflict is resolved in a single statement, concurrent syncs of the same dataset can't both insert.
+func (db *DB) UpsertContext(ctx context.Context, dataset *models.Dataset) (_ bool, err error) {
+	defer db.observe("upsert", time.Now(), &err)
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return false, wrapError("upsert", dataset.Id, err)
+	}
+	defer tx.Rollback()
+
+	inserted, err := tx.Upsert(dataset)
+	if err != nil {
+		return false, wrapError("upsert", dataset.Id, handleContextError(ctx, err))
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, wrapError("upsert", dataset.Id, err)
+	}
+	return inserted, nil
+}
+
+// Upsert inserts a new dataset or, if a dataset with that id exists, replaces its blob and bumps modified and seq.
+// A new dataset goes through the same checks as in Create. Owner, family and schema of an existing dataset are left unchanged
+// and the blob is validated against the stored schema; it returns ErrNotOwner if the existing dataset has another owner,
+// and ErrNotFound if it has been soft-deleted. If a dataset with that id is created concurrently, ErrConflict is returned.
+func (tx *Tx) Upsert(dataset *models.Dataset) (bool, error) {
+	if err := checkID(dataset.Id); err != nil {
+		return false, err
+	}
+
+	var (
+		owner   uuid.UUID
+		schema  string
+		deleted bool
+	)
+	err := handleError(tx.QueryRow("SELECT owner, schema, deleted IS NOT NULL FROM datasets WHERE id = $1 FOR UPDATE", dataset.Id.Array()).Scan(owner.Array(), &schema, &deleted))
+
+	var valid *bool
+	switch {
+	case err == ErrNotFound:
+		schema = dataset.Schema()
+		valid, err = tx.checkCreate(dataset)
+	case err != nil:
+		// database error
+	case deleted:
+		err = ErrNotFound
+	case owner != dataset.Owner:
+		err = ErrNotOwner
+	default:
+		valid, err = tx.checkReplace(schema, dataset.Blob())
+	}
+	if err != nil {
+		return false, err
+	}
+
+	column, blob, err := tx.blobColumn(dataset.Blob())
+	if err != nil {
+		return false, err
+	}
+
+	// a dataset inserted concurrently after the check above is only updated if its owner and schema match; otherwise no row is returned
+	var inserted bool
+	err = tx.QueryRow(`
+		INSERT INTO datasets(id, creator, owner, valid, family, schema, `+column+`, compressed)
+		VALUES($1, $2, $3, coalesce($4, false), $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET
+			`+column+` = EXCLUDED.`+column+`,
+			valid = coalesce($4, datasets.valid),
+			modified = now(),
+			seq = datasets.seq + 1
+		WHERE datasets.deleted IS NULL AND datasets.owner = EXCLUDED.owner AND datasets.schema = EXCLUDED.schema
+		RETURNING (xmax = 0)`,
+		dataset.Id.Array(),
+		dataset.Creator.Array(),
+		dataset.Owner.Array(),
+		valid,
+		int(dataset.Family()),
+		schema,
+		blob,
+		column == "blob_gz",
+	).Scan(&inserted)
+	if err != nil {
+		if err = handleError(err); err == ErrNotFound {
+			return false, ErrConflict
+		}
+		return false, err
+	}
+
+	if valid != nil {
+		dataset.SetValid(*valid)
+	}
+
+	return inserted, nil
+}
+
+// checkReplace checks a blob replacing the stored blob of a dataset with the given schema and returns its validation result.
+func (tx *Tx) checkReplace(schema string, blob []byte) (*bool, error) {
+	if err := checkBlob(blob); err != nil {
+		return nil, err
+	}
+
+	if err := tx.checkBlobSize(len(blob)); err != nil {
+		return nil, err
+	}
+
+	return tx.validate(schema, blob)
+}
+
 // StoreNewVersion inserts a new version of an existing dataset, copying most fields.
 func (tx *Tx) StoreNewVersion(basedOn uuid.UUID, id uuid.UUID, created time.Time, blob []byte) error {
+	column, data, err := tx.blobColumn(blob)
+	if err != nil {
+		return err
+	}
+
 	tag, err := tx.Exec(`
-	INSERT INTO datasets (id, creator, owner, created, synced, published, valid, family, schema, blob)
-		SELECT $2, creator, owner, $3, $3, true, true, family, schema, $4
+	INSERT INTO datasets (id, creator, owner, created, synced, published, valid, family, schema, `+column+`, compressed)
+		SELECT $2, creator, owner, $3, $3, true, true, family, schema, $4, $5
 		FROM datasets
 		WHERE id = $1
-	`, basedOn.Array(), id.Array(), created, blob)
+	`, basedOn.Array(), id.Array(), created, data, column == "blob_gz")
 	if err != nil {
 		return err
 	}
@@ -120,7 +417,13 @@ func (tx *Tx) StoreNewVersion(basedOn uuid.UUID, id uuid.UUID, created time.Time
 // 		return tx.StoreNewVersion(id, parent, created, blob)
 // 	})
 func (db *DB) WithTransaction(f func(tx *Tx) error) error {
-	tx, err := db.Begin()
+	return db.WithTransactionContext(context.Background(), f)
+}
+
+// WithTransactionContext wraps Tx methods in a transaction bound to the given context.
+// If the context is cancelled, the transaction is rolled back and the context's error is returned.
+func (db *DB) WithTransactionContext(ctx context.Context, f func(tx *Tx) error) error {
+	tx, err := db.BeginContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -128,95 +431,151 @@ func (db *DB) WithTransaction(f func(tx *Tx) error) error {
 
 	err = f(tx)
 	if err != nil {
-		return handleError(err)
+		return handleContextError(ctx, err)
 	}
 
 	return tx.Commit()
 }
 
+// InTx runs several operations as one atomic unit: the transaction is committed if fn returns nil and rolled back otherwise.
+// Unlike WithTransaction, the transaction is retried on serialization failures and deadlocks, so fn may be called more than once
+// and shouldn't have side effects outside the transaction.
+//
+// example:
+//
+//	err := db.InTx(func(tx *psql.Tx) error {
+//		if err := tx.Create(dataset); err != nil {
+//			return err
+//		}
+//		return tx.Grant(dataset.Id, colleague, psql.PermWrite)
+//	})
+func (db *DB) InTx(fn func(tx *Tx) error) error {
+	return db.InTxContext(context.Background(), fn)
+}
+
+// InTxContext runs fn in a retried transaction bound to the given context.
+func (db *DB) InTxContext(ctx context.Context, fn func(tx *Tx) error) error {
+	return db.withRetry(ctx, "transaction", func() error {
+		return db.WithTransactionContext(ctx, fn)
+	})
+}
+
 // StoreNewVersion wraps a StoreNewVersion transaction.
 func (db *DB) StoreNewVersion(id uuid.UUID, basedOn uuid.UUID, created time.Time, blob []byte) error {
-	tx, err := db.Begin()
+	return db.StoreNewVersionContext(context.Background(), id, basedOn, created, blob)
+}
+
+// StoreNewVersionContext wraps a StoreNewVersion transaction bound to the given context.
+func (db *DB) StoreNewVersionContext(ctx context.Context, id uuid.UUID, basedOn uuid.UUID, created time.Time, blob []byte) error {
+	if err := checkID(id); err != nil {
+		return wrapError("store new version", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
 	if err != nil {
-		return err
+		return wrapError("store new version", id, err)
 	}
 	defer tx.Rollback()
 
 	err = tx.StoreNewVersion(id, basedOn, created, blob)
 	if err != nil {
-		return handleError(err)
+		return wrapError("store new version", id, handleContextError(ctx, err))
 	}
 
-	return tx.Commit()
+	return wrapError("store new version", id, tx.Commit())
 }
 
 func (db *DB) Update(id uuid.UUID, blob []byte) error {
-	tx, err := db.Begin()
+	return db.UpdateContext(context.Background(), id, blob)
+}
+
+// UpdateContext updates a dataset's blob within the given context.
+func (db *DB) UpdateContext(ctx context.Context, id uuid.UUID, blob []byte) (err error) {
+	defer db.observe("update", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return wrapError("update", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
 	if err != nil {
-		return err
+		return wrapError("update", id, err)
 	}
 	defer tx.Rollback()
 
-	err = tx.update(id, blob)
+	err = tx.Update(id, blob, nil)
 	if err != nil {
-		return handleError(err)
+		return wrapError("update", id, handleContextError(ctx, err))
 	}
 
-	return tx.Commit()
+	return wrapError("update", id, tx.Commit())
 }
 
 // UpdateWithOwner updates a dataset with ownership checks.
+// It returns ErrLocked if another user holds a live edit lock on the dataset; see AcquireLock.
 func (db *DB) UpdateWithOwner(id uuid.UUID, blob []byte, owner uuid.UUID) error {
-	tx, err := db.Begin()
+	return db.UpdateWithOwnerContext(context.Background(), id, blob, owner)
+}
+
+// UpdateWithOwnerContext updates a dataset with ownership checks within the given context.
+func (db *DB) UpdateWithOwnerContext(ctx context.Context, id uuid.UUID, blob []byte, owner uuid.UUID) (err error) {
+	defer db.observe("update", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return wrapError("update", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
 	if err != nil {
-		return err
+		return wrapError("update", id, err)
 	}
 	defer tx.Rollback()
 
 	err = tx.CheckOwner(id, owner)
 	if err != nil {
-		return err
+		return wrapError("update", id, handleContextError(ctx, err))
 	}
 
-	err = tx.update(id, blob)
+	err = tx.checkLock(id, owner)
 	if err != nil {
-		return handleError(err)
+		return wrapError("update", id, handleContextError(ctx, err))
 	}
 
-	return tx.Commit()
+	err = tx.Update(id, blob, &owner)
+	if err != nil {
+		return wrapError("update", id, handleContextError(ctx, err))
+	}
+
+	return wrapError("update", id, tx.Commit())
 }
 
-// internal update, user triggered
-func (tx *Tx) update(id uuid.UUID, blob []byte) error {
-	ct, err := tx.Exec("UPDATE datasets SET modified = now(), seq = seq + 1, blob = $2 WHERE id = $1", id.Array(), blob)
-	if err != nil {
+// Update replaces the blob of a dataset, validating it if a validator is set; by is the acting user, nil if unknown.
+// A blob larger than the CompressionThreshold is stored compressed. It doesn't check ownership; use CheckOwner first for user requests.
+func (tx *Tx) Update(id uuid.UUID, blob []byte, by *uuid.UUID) error {
+	if err := checkID(id); err != nil {
 		return err
 	}
 
-	if ct.RowsAffected() != 1 {
-		return ErrNotFound
+	if err := tx.checkBlobSize(len(blob)); err != nil {
+		return err
 	}
 
-	return nil
-}
-
-// internal update synced, service triggered
-func (tx *Tx) updateSyncedByService(id uuid.UUID) error {
-	ct, err := tx.Exec("UPDATE datasets SET synced = now(), seq = seq + 1 WHERE id = $1", id.Array())
+	valid, err := tx.validateForUpdate(id, blob)
 	if err != nil {
 		return err
 	}
 
-	if ct.RowsAffected() != 1 {
-		return ErrNotFound
+	column, data, err := tx.blobColumn(blob)
+	if err != nil {
+		return err
 	}
 
-	return nil
-}
+	sql := stmtUpdate
+	if column != "blob" {
+		sql = "UPDATE datasets SET modified = now(), modified_by = $4, seq = seq + 1, " + column + " = $2, valid = coalesce($3, valid) WHERE id = $1 AND deleted IS NULL"
+	}
 
-// internal update, service triggered
-func (tx *Tx) updateByService(id uuid.UUID, blob []byte) error {
-	ct, err := tx.Exec("UPDATE datasets SET synced = now(), modified = now(), seq = seq + 1, blob = $2 WHERE id = $1", id.Array(), blob)
+	ct, err := tx.Exec(sql, id.Array(), data, valid, actor(by))
 	if err != nil {
 		return err
 	}
@@ -228,283 +587,1794 @@ func (tx *Tx) updateByService(id uuid.UUID, blob []byte) error {
 	return nil
 }
 
-func (db *DB) Patch(id uuid.UUID, blob []byte) error {
-	tx, err := db.Begin()
+// UpdateReturning updates a dataset and returns the stored record, saving the caller a separate Get.
+func (db *DB) UpdateReturning(id uuid.UUID, blob []byte) (*models.Dataset, error) {
+	return db.UpdateReturningContext(context.Background(), id, blob)
+}
+
+// UpdateReturningContext updates a dataset and returns the stored record, within the given context.
+func (db *DB) UpdateReturningContext(ctx context.Context, id uuid.UUID, blob []byte) (_ *models.Dataset, err error) {
+	defer db.observe("update", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return nil, wrapError("update", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
 	if err != nil {
-		return err
+		return nil, wrapError("update", id, err)
 	}
 	defer tx.Rollback()
 
-	err = tx.patch(id, blob)
+	res, err := tx.updateReturning(id, blob, nil)
 	if err != nil {
-		return handleError(err)
+		return nil, wrapError("update", id, handleContextError(ctx, err))
 	}
 
-	return tx.Commit()
+	return res, wrapError("update", id, tx.Commit())
 }
 
-// PatchWithOwner patches a dataset JSON blob with ownership checks.
-func (db *DB) PatchWithOwner(id uuid.UUID, blob []byte, owner uuid.UUID) error {
-	tx, err := db.Begin()
+// UpdateReturningWithOwner updates a dataset with ownership checks and returns the stored record.
+func (db *DB) UpdateReturningWithOwner(id uuid.UUID, blob []byte, owner uuid.UUID) (*models.Dataset, error) {
+	return db.UpdateReturningWithOwnerContext(context.Background(), id, blob, owner)
+}
+
+// UpdateReturningWithOwnerContext updates a dataset with ownership checks and returns the stored record, within the given context.
+func (db *DB) UpdateReturningWithOwnerContext(ctx context.Context, id uuid.UUID, blob []byte, owner uuid.UUID) (_ *models.Dataset, err error) {
+	defer db.observe("update", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return nil, wrapError("update", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
 	if err != nil {
-		return err
+		return nil, wrapError("update", id, err)
 	}
 	defer tx.Rollback()
 
 	err = tx.CheckOwner(id, owner)
 	if err != nil {
-		return err
+		return nil, wrapError("update", id, handleContextError(ctx, err))
 	}
 
-	err = tx.patch(id, blob)
+	err = tx.checkLock(id, owner)
 	if err != nil {
-		return handleError(err)
+		return nil, wrapError("update", id, handleContextError(ctx, err))
 	}
 
-	return tx.Commit()
-}
-
-func (tx *Tx) patch(id uuid.UUID, blob []byte) error {
-	ct, err := tx.Exec("UPDATE datasets SET modified = now(), seq = seq + 1, blob = blob || $2 WHERE id = $1", id.Array(), blob)
+	res, err := tx.updateReturning(id, blob, &owner)
 	if err != nil {
-		return err
+		return nil, wrapError("update", id, handleContextError(ctx, err))
 	}
 
-	if ct.RowsAffected() != 1 {
-		return ErrNotFound
+	return res, wrapError("update", id, tx.Commit())
+}
+
+// internal update returning the updated record, user triggered; by is the acting user, nil if unknown
+func (tx *Tx) updateReturning(id uuid.UUID, blob []byte, by *uuid.UUID) (*models.Dataset, error) {
+	var (
+		modified *time.Time
+		valid    *bool
+		family   *int
+		schema   *string
+		stored   []byte
+	)
+
+	if err := tx.checkBlobSize(len(blob)); err != nil {
+		return nil, err
 	}
 
-	return nil
-}
+	isValid, err := tx.validateForUpdate(id, blob)
+	if err != nil {
+		return nil, err
+	}
 
-func (db *DB) SmartGetWithOwner(id uuid.UUID, owner uuid.UUID) (*models.Dataset, error) {
-	tx, err := db.Begin()
+	column, data, err := tx.blobColumn(blob)
 	if err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
 
-	err = tx.CheckOwner(id, owner)
+	res := new(models.Dataset)
+	err = tx.QueryRow(`
+		UPDATE datasets SET modified = now(), modified_by = $4, seq = seq + 1, `+column+` = $2, valid = coalesce($3, valid) WHERE id = $1 AND deleted IS NULL
+		RETURNING id, creator, owner, modified, seq, valid, family, schema, `+storedBlob,
+		id.Array(), data, isValid, actor(by),
+	).Scan(res.Id.Array(), res.Creator.Array(), res.Owner.Array(), &modified, &res.Seq, &valid, &family, &schema, &stored)
 	if err != nil {
 		return nil, err
 	}
 
-	famId, err := tx.getFamily(id)
+	stored, err = decompressBlob(stored)
 	if err != nil {
 		return nil, err
 	}
 
-	family, err := models.LookupFamily(famId)
+	err = res.SetData(models.Family(*family), *schema, stored)
 	if err != nil {
 		return nil, err
 	}
 
-	if family.IsPartial() {
-		return tx.get(id, family.Key())
+	if modified != nil {
+		res.Modified = *modified
+	}
+	if by != nil {
+		res.ModifiedBy = *by
 	}
-	return tx.get(id, "")
+	if valid != nil {
+		res.SetValid(*valid)
+	}
+
+	return res, nil
 }
 
-func (db *DB) SmartUpdateWithOwner(id uuid.UUID, blob []byte, owner uuid.UUID) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+// UpdateWithSeq updates a dataset only if its sequence number still matches the one the caller read,
+// returning ErrConflict if the dataset has been modified in the meantime.
+func (db *DB) UpdateWithSeq(id uuid.UUID, blob []byte, expectedSeq int64) error {
+	return db.UpdateWithSeqContext(context.Background(), id, blob, expectedSeq)
+}
 
-	err = tx.CheckOwner(id, owner)
-	if err != nil {
-		return err
+// UpdateWithSeqContext updates a dataset if its sequence number matches, within the given context.
+func (db *DB) UpdateWithSeqContext(ctx context.Context, id uuid.UUID, blob []byte, expectedSeq int64) (err error) {
+	defer db.observe("update", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return wrapError("update", id, err)
 	}
 
-	famId, err := tx.getFamily(id)
+	tx, err := db.BeginContext(ctx)
 	if err != nil {
-		return err
+		return wrapError("update", id, err)
 	}
+	defer tx.Rollback()
 
-	family, err := models.LookupFamily(famId)
+	err = tx.updateWithSeq(id, blob, expectedSeq, nil)
 	if err != nil {
-		return err
+		return wrapError("update", id, handleContextError(ctx, err))
 	}
 
-	if family.IsPartial() {
-		err = tx.patch(id, blob)
-	} else {
-		err = tx.update(id, blob)
+	return wrapError("update", id, tx.Commit())
+}
+
+// UpdateWithSeqWithOwner updates a dataset with ownership checks if its sequence number still matches; see UpdateWithSeq.
+func (db *DB) UpdateWithSeqWithOwner(id uuid.UUID, blob []byte, expectedSeq int64, owner uuid.UUID) error {
+	return db.UpdateWithSeqWithOwnerContext(context.Background(), id, blob, expectedSeq, owner)
+}
+
+// UpdateWithSeqWithOwnerContext updates a dataset with ownership checks if its sequence number matches, within the given context.
+func (db *DB) UpdateWithSeqWithOwnerContext(ctx context.Context, id uuid.UUID, blob []byte, expectedSeq int64, owner uuid.UUID) (err error) {
+	defer db.observe("update", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return wrapError("update", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("update", id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return wrapError("update", id, handleContextError(ctx, err))
+	}
+
+	err = tx.checkLock(id, owner)
+	if err != nil {
+		return wrapError("update", id, handleContextError(ctx, err))
+	}
+
+	err = tx.updateWithSeq(id, blob, expectedSeq, &owner)
+	if err != nil {
+		return wrapError("update", id, handleContextError(ctx, err))
+	}
+
+	return wrapError("update", id, tx.Commit())
+}
+
+// internal update with sequence check, user triggered; by is the acting user, nil if unknown
+func (tx *Tx) updateWithSeq(id uuid.UUID, blob []byte, expectedSeq int64, by *uuid.UUID) error {
+	if err := tx.checkBlobSize(len(blob)); err != nil {
+		return err
+	}
+
+	valid, err := tx.validateForUpdate(id, blob)
+	if err != nil {
+		return err
+	}
+
+	column, data, err := tx.blobColumn(blob)
+	if err != nil {
+		return err
+	}
+
+	ct, err := tx.Exec("UPDATE datasets SET modified = now(), modified_by = $5, seq = seq + 1, "+column+" = $2, valid = coalesce($4, valid) WHERE id = $1 AND seq = $3 AND deleted IS NULL", id.Array(), data, expectedSeq, valid, actor(by))
+	if err != nil {
+		return err
+	}
+
+	if ct.RowsAffected() != 1 {
+		// distinguish a stale sequence number from a missing record
+		var exists bool
+		err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM datasets WHERE id = $1 AND deleted IS NULL)", id.Array()).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrConflict
+		}
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// internal update synced, service triggered
+func (tx *Tx) updateSyncedByService(id uuid.UUID) error {
+	ct, err := tx.Exec("UPDATE datasets SET synced = now(), seq = seq + 1 WHERE id = $1", id.Array())
+	if err != nil {
+		return err
+	}
+
+	if ct.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// internal update, service triggered
+func (tx *Tx) updateByService(id uuid.UUID, blob []byte) error {
+	if err := tx.checkBlobSize(len(blob)); err != nil {
+		return err
+	}
+
+	column, data, err := tx.blobColumn(blob)
+	if err != nil {
+		return err
+	}
+
+	ct, err := tx.Exec("UPDATE datasets SET synced = now(), modified = now(), modified_by = NULL, seq = seq + 1, "+column+" = $2 WHERE id = $1", id.Array(), data)
+	if err != nil {
+		return err
+	}
+
+	if ct.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (db *DB) Patch(id uuid.UUID, blob []byte) error {
+	return db.PatchContext(context.Background(), id, blob)
+}
+
+// PatchContext patches a dataset JSON blob within the given context.
+func (db *DB) PatchContext(ctx context.Context, id uuid.UUID, blob []byte) (err error) {
+	defer db.observe("patch", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return wrapError("patch", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("patch", id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.Patch(id, blob, nil)
+	if err != nil {
+		return wrapError("patch", id, handleContextError(ctx, err))
+	}
+
+	return wrapError("patch", id, tx.Commit())
+}
+
+// PatchWithOwner patches a dataset JSON blob with ownership checks.
+func (db *DB) PatchWithOwner(id uuid.UUID, blob []byte, owner uuid.UUID) error {
+	return db.PatchWithOwnerContext(context.Background(), id, blob, owner)
+}
+
+// PatchWithOwnerContext patches a dataset JSON blob with ownership checks within the given context.
+func (db *DB) PatchWithOwnerContext(ctx context.Context, id uuid.UUID, blob []byte, owner uuid.UUID) (err error) {
+	defer db.observe("patch", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return wrapError("patch", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("patch", id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return wrapError("patch", id, handleContextError(ctx, err))
+	}
+
+	err = tx.checkLock(id, owner)
+	if err != nil {
+		return wrapError("patch", id, handleContextError(ctx, err))
+	}
+
+	err = tx.Patch(id, blob, &owner)
+	if err != nil {
+		return wrapError("patch", id, handleContextError(ctx, err))
+	}
+
+	return wrapError("patch", id, tx.Commit())
+}
+
+// ApplyJSONPatch applies an RFC 6902 JSON Patch document to a dataset's blob with ownership checks.
+// The patch is applied in Go and the result written back in the same transaction;
+// if a `test` operation fails, jsonpatch.ErrTestFailed is returned and nothing is changed.
+func (db *DB) ApplyJSONPatch(id uuid.UUID, patch []byte, owner uuid.UUID) error {
+	return db.ApplyJSONPatchContext(context.Background(), id, patch, owner)
+}
+
+// ApplyJSONPatchContext applies an RFC 6902 JSON Patch document to a dataset's blob within the given context.
+// The transaction is retried on serialization failures and deadlocks.
+func (db *DB) ApplyJSONPatchContext(ctx context.Context, id uuid.UUID, patch []byte, owner uuid.UUID) (err error) {
+	defer db.observe("json patch", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return wrapError("json patch", id, err)
+	}
+
+	err = db.withRetry(ctx, "json patch", func() error {
+		return db.applyJSONPatch(ctx, id, patch, owner)
+	})
+	return wrapError("json patch", id, err)
+}
+
+// applyJSONPatch checks ownership and applies a JSON Patch document in one transaction.
+func (db *DB) applyJSONPatch(ctx context.Context, id uuid.UUID, patch []byte, owner uuid.UUID) error {
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return handleContextError(ctx, err)
+	}
+
+	err = tx.checkLock(id, owner)
+	if err != nil {
+		return handleContextError(ctx, err)
+	}
+
+	err = tx.applyJSONPatch(id, patch, &owner)
+	if err != nil {
+		return handleContextError(ctx, err)
+	}
+
+	return tx.Commit()
+}
+
+// applyJSONPatch reads and locks the blob, applies the patch and saves the result as modified by the given user.
+func (tx *Tx) applyJSONPatch(id uuid.UUID, patch []byte, by *uuid.UUID) error {
+	blob, err := tx.lockBlob(id)
+	if err != nil {
+		return err
+	}
+
+	patched, err := jsonpatch.Apply(blob, patch)
+	if err != nil {
+		return err
+	}
+
+	return tx.Update(id, patched, by)
+}
+
+// ApplyMergePatch applies an RFC 7386 JSON Merge Patch document to a dataset's blob with ownership checks.
+// Unlike Patch, objects are merged recursively and a null value removes a key. The patch must be a JSON object,
+// so the blob can't be replaced by a scalar or array; ErrInvalidJson is returned otherwise.
+func (db *DB) ApplyMergePatch(id uuid.UUID, merge []byte, owner uuid.UUID) error {
+	return db.ApplyMergePatchContext(context.Background(), id, merge, owner)
+}
+
+// ApplyMergePatchContext applies an RFC 7386 JSON Merge Patch document to a dataset's blob within the given context.
+// The transaction is retried on serialization failures and deadlocks.
+func (db *DB) ApplyMergePatchContext(ctx context.Context, id uuid.UUID, merge []byte, owner uuid.UUID) (err error) {
+	defer db.observe("merge patch", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return wrapError("merge patch", id, err)
+	}
+
+	if !isJSONObject(merge) {
+		return wrapError("merge patch", id, ErrInvalidJson)
+	}
+
+	err = db.withRetry(ctx, "merge patch", func() error {
+		return db.applyMergePatch(ctx, id, merge, owner)
+	})
+	return wrapError("merge patch", id, err)
+}
+
+// applyMergePatch checks ownership and applies a JSON Merge Patch document in one transaction.
+func (db *DB) applyMergePatch(ctx context.Context, id uuid.UUID, merge []byte, owner uuid.UUID) error {
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return handleContextError(ctx, err)
+	}
+
+	err = tx.checkLock(id, owner)
+	if err != nil {
+		return handleContextError(ctx, err)
+	}
+
+	err = tx.applyMergePatch(id, merge, &owner)
+	if err != nil {
+		return handleContextError(ctx, err)
+	}
+
+	return tx.Commit()
+}
+
+// applyMergePatch reads and locks the blob, merges the patch into it and saves the result as modified by the given user.
+func (tx *Tx) applyMergePatch(id uuid.UUID, merge []byte, by *uuid.UUID) error {
+	blob, err := tx.lockBlob(id)
+	if err != nil {
+		return err
+	}
+
+	// a NULL blob counts as an empty object
+	if len(blob) == 0 {
+		blob = []byte("{}")
+	}
+
+	merged, err := jsonpatch.MergePatch(blob, merge)
+	if err != nil {
+		return err
+	}
+
+	return tx.Update(id, merged, by)
+}
+
+// UpdatePreserving merges the top-level keys of blob into a dataset's blob with ownership checks, like Patch,
+// but keeps the stored values at the given paths of object keys, so clients can't drop or change server-managed fields
+// such as identifiers; a protected path that isn't stored is removed. It returns the blob as saved.
+func (db *DB) UpdatePreserving(id uuid.UUID, blob []byte, owner uuid.UUID, preservePaths [][]string) ([]byte, error) {
+	return db.UpdatePreservingContext(context.Background(), id, blob, owner, preservePaths)
+}
+
+// UpdatePreservingContext merges a blob into a dataset while keeping protected paths, within the given context.
+// The transaction is retried on serialization failures and deadlocks.
+func (db *DB) UpdatePreservingContext(ctx context.Context, id uuid.UUID, blob []byte, owner uuid.UUID, preservePaths [][]string) (_ []byte, err error) {
+	defer db.observe("update", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return nil, wrapError("update", id, err)
+	}
+
+	if !isJSONObject(blob) {
+		return nil, wrapError("update", id, ErrInvalidJson)
+	}
+
+	var saved []byte
+	err = db.withRetry(ctx, "update", func() (err error) {
+		saved, err = db.updatePreserving(ctx, id, blob, owner, preservePaths)
+		return err
+	})
+	if err != nil {
+		return nil, wrapError("update", id, err)
+	}
+	return saved, nil
+}
+
+// updatePreserving checks ownership and merges a blob while keeping protected paths in one transaction.
+func (db *DB) updatePreserving(ctx context.Context, id uuid.UUID, blob []byte, owner uuid.UUID, preservePaths [][]string) ([]byte, error) {
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return nil, handleContextError(ctx, err)
+	}
+
+	err = tx.checkLock(id, owner)
+	if err != nil {
+		return nil, handleContextError(ctx, err)
+	}
+
+	saved, err := tx.updatePreserving(id, blob, preservePaths, &owner)
+	if err != nil {
+		return nil, handleContextError(ctx, err)
+	}
+
+	return saved, tx.Commit()
+}
+
+// updatePreserving reads and locks the blob, merges the new top-level keys into it, restores the protected paths
+// and saves the result as modified by the given user.
+func (tx *Tx) updatePreserving(id uuid.UUID, blob []byte, preservePaths [][]string, by *uuid.UUID) ([]byte, error) {
+	stored, err := tx.lockBlob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// a NULL blob counts as an empty object
+	if len(stored) == 0 {
+		stored = []byte("{}")
+	}
+
+	var keys, updates map[string]json.RawMessage
+	if err = json.Unmarshal(stored, &keys); err != nil {
+		return nil, ErrInvalidJson
+	}
+	if err = json.Unmarshal(blob, &updates); err != nil {
+		return nil, ErrInvalidJson
+	}
+	if keys == nil {
+		keys = make(map[string]json.RawMessage, len(updates))
+	}
+	for key, value := range updates {
+		keys[key] = value
+	}
+
+	merged, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err = jsonpatch.Preserve(merged, stored, preservePaths)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Update(id, merged, by); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// checkBlob returns ErrInvalidJson if a blob is empty or not valid JSON, so corrupt data is caught when it is written
+// instead of breaking every later read.
+func checkBlob(blob []byte) error {
+	if !json.Valid(blob) {
+		return ErrInvalidJson
+	}
+	return nil
+}
+
+// checkFamilySchema returns ErrUnknownFamily if the dataset family isn't registered,
+// and ErrSchemaFamilyMismatch if the schema is not allowed for it; see models.FamilySchemas.
+func checkFamilySchema(family models.Family, schema string) error {
+	fam, err := models.LookupFamily(family)
+	if err != nil {
+		return ErrUnknownFamily
+	}
+	if !fam.AllowsSchema(schema) {
+		return ErrSchemaFamilyMismatch
+	}
+	return nil
+}
+
+// isJSONObject checks if data looks like a JSON object; it doesn't validate the content.
+func isJSONObject(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '{'
+}
+
+// Patch merges the top-level keys of blob into the stored blob of a dataset; by is the acting user, nil if unknown.
+// The merge runs in the database, so a compressed dataset can't be patched and ErrCompressed is returned; replace its blob instead.
+// It doesn't check ownership; use CheckOwner first for user requests.
+func (tx *Tx) Patch(id uuid.UUID, blob []byte, by *uuid.UUID) error {
+	if err := checkID(id); err != nil {
+		return err
+	}
+
+	if err := tx.checkPatchSize(id, blob); err != nil {
+		return err
+	}
+
+	ct, err := tx.Exec(stmtPatch, id.Array(), blob, actor(by))
+	if err != nil {
+		return err
+	}
+
+	if ct.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	return tx.validateStored(id)
+}
+
+// PatchReturning patches a dataset JSON blob and returns the stored record, saving the caller a separate Get.
+func (db *DB) PatchReturning(id uuid.UUID, blob []byte) (*models.Dataset, error) {
+	return db.PatchReturningContext(context.Background(), id, blob)
+}
+
+// PatchReturningContext patches a dataset JSON blob and returns the stored record, within the given context.
+func (db *DB) PatchReturningContext(ctx context.Context, id uuid.UUID, blob []byte) (_ *models.Dataset, err error) {
+	defer db.observe("patch", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return nil, wrapError("patch", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return nil, wrapError("patch", id, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.patchReturning(id, blob, nil)
+	if err != nil {
+		return nil, wrapError("patch", id, handleContextError(ctx, err))
+	}
+
+	return res, wrapError("patch", id, tx.Commit())
+}
+
+// PatchReturningWithOwner patches a dataset JSON blob with ownership checks and returns the stored record.
+func (db *DB) PatchReturningWithOwner(id uuid.UUID, blob []byte, owner uuid.UUID) (*models.Dataset, error) {
+	return db.PatchReturningWithOwnerContext(context.Background(), id, blob, owner)
+}
+
+// PatchReturningWithOwnerContext patches a dataset JSON blob with ownership checks and returns the stored record, within the given context.
+func (db *DB) PatchReturningWithOwnerContext(ctx context.Context, id uuid.UUID, blob []byte, owner uuid.UUID) (_ *models.Dataset, err error) {
+	defer db.observe("patch", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return nil, wrapError("patch", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return nil, wrapError("patch", id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return nil, wrapError("patch", id, handleContextError(ctx, err))
+	}
+
+	err = tx.checkLock(id, owner)
+	if err != nil {
+		return nil, wrapError("patch", id, handleContextError(ctx, err))
+	}
+
+	res, err := tx.patchReturning(id, blob, &owner)
+	if err != nil {
+		return nil, wrapError("patch", id, handleContextError(ctx, err))
+	}
+
+	return res, wrapError("patch", id, tx.Commit())
+}
+
+// patchReturning merges the top-level keys of blob into the stored blob and returns the updated record.
+// The merged blob is validated after the update, since it isn't known before.
+func (tx *Tx) patchReturning(id uuid.UUID, blob []byte, by *uuid.UUID) (*models.Dataset, error) {
+	var (
+		modified *time.Time
+		valid    *bool
+		family   *int
+		schema   *string
+		stored   []byte
+	)
+
+	if err := tx.checkPatchSize(id, blob); err != nil {
+		return nil, err
+	}
+
+	res := new(models.Dataset)
+	err := tx.QueryRow(`
+		UPDATE datasets SET modified = now(), modified_by = $3, seq = seq + 1, blob = blob || $2 WHERE id = $1 AND deleted IS NULL
+		RETURNING id, creator, owner, modified, seq, valid, family, schema, blob`,
+		id.Array(), blob, actor(by),
+	).Scan(res.Id.Array(), res.Creator.Array(), res.Owner.Array(), &modified, &res.Seq, &valid, &family, &schema, &stored)
+	if err != nil {
+		return nil, err
+	}
+
+	isValid, err := tx.validate(*schema, stored)
+	if err != nil {
+		return nil, err
+	}
+	if isValid != nil {
+		if _, err = tx.Exec("UPDATE datasets SET valid = $2 WHERE id = $1", id.Array(), *isValid); err != nil {
+			return nil, err
+		}
+		valid = isValid
+	}
+
+	err = res.SetData(models.Family(*family), *schema, stored)
+	if err != nil {
+		return nil, err
+	}
+
+	if modified != nil {
+		res.Modified = *modified
+	}
+	if by != nil {
+		res.ModifiedBy = *by
+	}
+	if valid != nil {
+		res.SetValid(*valid)
+	}
+
+	return res, nil
+}
+
+// SetFieldAtPath replaces the JSON value at a nested path in a dataset's blob if the owner matches.
+// A missing last key on the path is created; missing intermediate objects are not.
+func (db *DB) SetFieldAtPath(id uuid.UUID, path []string, value json.RawMessage, owner uuid.UUID) error {
+	return db.SetFieldAtPathContext(context.Background(), id, path, value, owner)
+}
+
+// SetFieldAtPathContext replaces the JSON value at a nested path in a dataset's blob within the given context.
+func (db *DB) SetFieldAtPathContext(ctx context.Context, id uuid.UUID, path []string, value json.RawMessage, owner uuid.UUID) error {
+	if err := checkID(id); err != nil {
+		return wrapError("set field", id, err)
+	}
+
+	if !json.Valid(value) {
+		return wrapError("set field", id, ErrInvalidJson)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("set field", id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return wrapError("set field", id, handleContextError(ctx, err))
+	}
+
+	err = tx.checkLock(id, owner)
+	if err != nil {
+		return wrapError("set field", id, handleContextError(ctx, err))
+	}
+
+	ct, err := tx.Exec("UPDATE datasets SET modified = now(), modified_by = $4, seq = seq + 1, blob = jsonb_set(blob, $2, $3, true) WHERE id = $1 AND deleted IS NULL", id.Array(), path, []byte(value), owner.Array())
+	if err != nil {
+		return wrapError("set field", id, handleContextError(ctx, err))
+	}
+
+	if ct.RowsAffected() != 1 {
+		return wrapError("set field", id, ErrNotFound)
+	}
+
+	err = tx.checkStoredSize(id)
+	if err != nil {
+		return wrapError("set field", id, handleContextError(ctx, err))
+	}
+
+	err = tx.validateStored(id)
+	if err != nil {
+		return wrapError("set field", id, handleContextError(ctx, err))
+	}
+
+	return wrapError("set field", id, tx.Commit())
+}
+
+// DeleteFieldAtPath removes the value at a nested path from a dataset's blob if the owner matches.
+// It returns ErrNotFound if the document doesn't contain the path, so a repeated call is reported rather than silently ignored.
+func (db *DB) DeleteFieldAtPath(id uuid.UUID, path []string, owner uuid.UUID) error {
+	return db.DeleteFieldAtPathContext(context.Background(), id, path, owner)
+}
+
+// DeleteFieldAtPathContext removes the value at a nested path from a dataset's blob within the given context.
+func (db *DB) DeleteFieldAtPathContext(ctx context.Context, id uuid.UUID, path []string, owner uuid.UUID) error {
+	if err := checkID(id); err != nil {
+		return wrapError("delete field", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("delete field", id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return wrapError("delete field", id, handleContextError(ctx, err))
+	}
+
+	err = tx.checkLock(id, owner)
+	if err != nil {
+		return wrapError("delete field", id, handleContextError(ctx, err))
+	}
+
+	err = tx.checkNotCompressed(id)
+	if err != nil {
+		return wrapError("delete field", id, handleContextError(ctx, err))
+	}
+
+	// the owner check guarantees the row exists, so no match means the path is missing
+	ct, err := tx.Exec("UPDATE datasets SET modified = now(), modified_by = $3, seq = seq + 1, blob = blob #- $2 WHERE id = $1 AND deleted IS NULL AND blob #> $2 IS NOT NULL", id.Array(), path, owner.Array())
+	if err != nil {
+		return wrapError("delete field", id, handleContextError(ctx, err))
+	}
+
+	if ct.RowsAffected() != 1 {
+		return wrapError("delete field", id, ErrNotFound)
+	}
+
+	err = tx.validateStored(id)
+	if err != nil {
+		return wrapError("delete field", id, handleContextError(ctx, err))
+	}
+
+	return wrapError("delete field", id, tx.Commit())
+}
+
+func (db *DB) SmartGetWithOwner(id uuid.UUID, owner uuid.UUID) (*models.Dataset, error) {
+	return db.SmartGetWithOwnerContext(context.Background(), id, owner)
+}
+
+// SmartGetWithOwnerContext retrieves the – possibly partial – dataset if the owner matches, within the given context.
+func (db *DB) SmartGetWithOwnerContext(ctx context.Context, id uuid.UUID, owner uuid.UUID) (_ *models.Dataset, err error) {
+	defer db.observe("get", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return nil, wrapError("get", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return nil, wrapError("get", id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return nil, wrapError("get", id, handleContextError(ctx, err))
+	}
+
+	famId, err := tx.getFamily(id)
+	if err != nil {
+		return nil, wrapError("get", id, handleContextError(ctx, err))
+	}
+
+	family, err := models.LookupFamily(famId)
+	if err != nil {
+		return nil, wrapError("get", id, err)
+	}
+
+	var res *models.Dataset
+	if family.IsPartial() {
+		res, err = tx.get(id, family.Key())
+	} else {
+		res, err = tx.get(id, "")
+	}
+	return res, wrapError("get", id, handleContextError(ctx, err))
+}
+
+// SmartGetField retrieves the given top-level key of a dataset if the owner matches, instead of the family's default key.
+// It returns ErrInvalidKey if the dataset's family is partial and key isn't one of its public keys.
+func (db *DB) SmartGetField(id uuid.UUID, owner uuid.UUID, key string) (*models.Dataset, error) {
+	return db.SmartGetFieldContext(context.Background(), id, owner, key)
+}
+
+// SmartGetFieldContext retrieves a top-level key of a dataset if the owner matches, within the given context.
+func (db *DB) SmartGetFieldContext(ctx context.Context, id uuid.UUID, owner uuid.UUID, key string) (_ *models.Dataset, err error) {
+	defer db.observe("get", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return nil, wrapError("get", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return nil, wrapError("get", id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return nil, wrapError("get", id, handleContextError(ctx, err))
+	}
+
+	famId, err := tx.getFamily(id)
+	if err != nil {
+		return nil, wrapError("get", id, handleContextError(ctx, err))
+	}
+
+	family, err := models.LookupFamily(famId)
+	if err != nil {
+		return nil, wrapError("get", id, err)
+	}
+
+	if !family.HasKey(key) {
+		return nil, wrapError("get", id, ErrInvalidKey)
+	}
+
+	res, err := tx.get(id, key)
+	return res, wrapError("get", id, handleContextError(ctx, err))
+}
+
+func (db *DB) SmartUpdateWithOwner(id uuid.UUID, blob []byte, owner uuid.UUID) error {
+	return db.SmartUpdateWithOwnerContext(context.Background(), id, blob, owner)
+}
+
+// SmartUpdateWithOwnerContext updates or – for partial datasets – patches a dataset if the owner matches, within the given context.
+// It runs in a serializable transaction, which is retried on serialization failures and deadlocks.
+func (db *DB) SmartUpdateWithOwnerContext(ctx context.Context, id uuid.UUID, blob []byte, owner uuid.UUID) (err error) {
+	defer db.observe("update", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return wrapError("update", id, err)
+	}
+
+	err = db.withRetry(ctx, "update", func() error {
+		return db.smartUpdateWithOwner(ctx, id, blob, owner)
+	})
+	return wrapError("update", id, err)
+}
+
+// smartUpdateWithOwner updates or patches a dataset in one transaction.
+func (db *DB) smartUpdateWithOwner(ctx context.Context, id uuid.UUID, blob []byte, owner uuid.UUID) error {
+	tx, err := db.BeginWithLevelContext(ctx, LevelSerializable)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return handleContextError(ctx, err)
+	}
+
+	err = tx.checkLock(id, owner)
+	if err != nil {
+		return handleContextError(ctx, err)
+	}
+
+	famId, err := tx.getFamily(id)
+	if err != nil {
+		return handleContextError(ctx, err)
+	}
+
+	family, err := models.LookupFamily(famId)
+	if err != nil {
+		return err
+	}
+
+	if family.IsPartial() {
+		err = tx.Patch(id, blob, &owner)
+	} else {
+		err = tx.Update(id, blob, &owner)
+	}
+	if err != nil {
+		return handleContextError(ctx, err)
+	}
+
+	return tx.Commit()
+}
+
+// StorePublished saves a published dataset to the database and marks it as published, recording its Metax identifier.
+// An empty blob is stored as `{}`; ErrInvalidJson is returned if the blob is not valid JSON.
+// It returns the dataset's new sync time and sequence number; the publication is added to the dataset's PublishHistory.
+func (db *DB) StorePublished(id uuid.UUID, blob []byte, metaxId string, synced time.Time) (Publication, error) {
+	return db.StorePublishedContext(context.Background(), id, blob, metaxId, synced)
+}
+
+// StorePublishedContext saves a published dataset within the given context.
+// It only updates an existing dataset, so it doesn't count against the owner's quota.
+func (db *DB) StorePublishedContext(ctx context.Context, id uuid.UUID, blob []byte, metaxId string, synced time.Time) (Publication, error) {
+	return db.storePublished(ctx, id, blob, metaxId, &synced)
+}
+
+// StorePublishedOptions holds the settings for StorePublishedWithOptions.
+// If neither field is set, the dataset's sync time is left unchanged.
+type StorePublishedOptions struct {
+	// MarkSyncedNow records the current time as sync time, for blobs just pushed to Metax.
+	MarkSyncedNow bool
+
+	// SyncedAt records the given time as sync time, for instance the modification time Metax reports for a harvested dataset,
+	// so the sync time can be compared with Metax for conflict detection. It takes precedence over MarkSyncedNow.
+	SyncedAt *time.Time
+}
+
+// StorePublishedWithOptions saves a published dataset like StorePublished, with control over the recorded sync time.
+func (db *DB) StorePublishedWithOptions(id uuid.UUID, blob []byte, metaxId string, opts StorePublishedOptions) (Publication, error) {
+	return db.StorePublishedWithOptionsContext(context.Background(), id, blob, metaxId, opts)
+}
+
+// StorePublishedWithOptionsContext saves a published dataset within the given context; see StorePublishedWithOptions.
+func (db *DB) StorePublishedWithOptionsContext(ctx context.Context, id uuid.UUID, blob []byte, metaxId string, opts StorePublishedOptions) (Publication, error) {
+	synced := opts.SyncedAt
+	if synced == nil && opts.MarkSyncedNow {
+		now := time.Now()
+		synced = &now
+	}
+
+	return db.storePublished(ctx, id, blob, metaxId, synced)
+}
+
+// storePublished saves a published blob and marks the dataset as published in one transaction; a nil synced keeps the sync time.
+func (db *DB) storePublished(ctx context.Context, id uuid.UUID, blob []byte, metaxId string, synced *time.Time) (pub Publication, err error) {
+	if err := checkID(id); err != nil {
+		return pub, wrapError("store published", id, err)
+	}
+
+	if len(blob) == 0 {
+		blob = []byte("{}")
+	}
+	if err := checkBlob(blob); err != nil {
+		return pub, wrapError("store published", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return pub, wrapError("store published", id, err)
+	}
+	defer tx.Rollback()
+
+	if err = tx.checkBlobSize(len(blob)); err != nil {
+		return pub, wrapError("store published", id, err)
+	}
+
+	column, data, err := tx.blobColumn(blob)
+	if err != nil {
+		return pub, wrapError("store published", id, err)
+	}
+
+	ct, err := tx.Exec("UPDATE datasets SET "+column+" = $2 WHERE id = $1 AND deleted IS NULL", id.Array(), data)
+	if err != nil {
+		return pub, wrapError("store published", id, handleContextError(ctx, err))
+	}
+
+	if ct.RowsAffected() != 1 {
+		return pub, wrapError("store published", id, ErrNotFound)
+	}
+
+	pub, err = tx.markPublished(id, metaxId, synced)
+	if err != nil {
+		return Publication{}, wrapError("store published", id, handleContextError(ctx, err))
+	}
+
+	if err = tx.Commit(); err != nil {
+		return Publication{}, wrapError("store published", id, err)
+	}
+	return pub, nil
+}
+
+// Clone copies a dataset to a new id with the given blob.
+// If the new id is already taken, ErrAlreadyExists is returned; see CloneWithOptions to pick another id instead.
+func (db *DB) Clone(id uuid.UUID, newid uuid.UUID, blob []byte) error {
+	return db.CloneContext(context.Background(), id, newid, blob)
+}
+
+// CloneContext copies a dataset to a new id with the given blob, within the given context.
+func (db *DB) CloneContext(ctx context.Context, id uuid.UUID, newid uuid.UUID, blob []byte) error {
+	if err := checkID(id); err != nil {
+		return wrapError("clone", id, err)
+	}
+
+	return wrapError("clone", id, db.clone(ctx, id, newid, blob))
+}
+
+// CloneOptions holds the settings for CloneWithOptions.
+type CloneOptions struct {
+	// RegenerateOnConflict retries with a newly generated id if the requested one already exists,
+	// up to maxCloneAttempts times in total.
+	RegenerateOnConflict bool
+}
+
+// maxCloneAttempts limits the ids tried by CloneWithOptions when RegenerateOnConflict is set.
+const maxCloneAttempts = 3
+
+// CloneWithOptions copies a dataset to a new id with the given blob and returns the id actually used,
+// which differs from newid if the options allowed picking another one after a conflict.
+func (db *DB) CloneWithOptions(id uuid.UUID, newid uuid.UUID, blob []byte, opts CloneOptions) (uuid.UUID, error) {
+	return db.CloneWithOptionsContext(context.Background(), id, newid, blob, opts)
+}
+
+// CloneWithOptionsContext copies a dataset to a new id within the given context; see CloneWithOptions.
+// Each attempt runs in its own transaction, as a failed insert aborts the transaction it runs in.
+func (db *DB) CloneWithOptionsContext(ctx context.Context, id uuid.UUID, newid uuid.UUID, blob []byte, opts CloneOptions) (uuid.UUID, error) {
+	if err := checkID(id); err != nil {
+		return uuid.UUID{}, wrapError("clone", id, err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := db.clone(ctx, id, newid, blob)
+		if err == nil {
+			return newid, nil
+		}
+		if !opts.RegenerateOnConflict || Cause(err) != ErrAlreadyExists || attempt >= maxCloneAttempts {
+			return uuid.UUID{}, wrapError("clone", id, err)
+		}
+
+		db.logger.Debug().Str("id", id.String()).Str("newid", newid.String()).Msg("clone target exists, retrying with new id")
+		if newid, err = db.newID(); err != nil {
+			return uuid.UUID{}, wrapError("clone", id, err)
+		}
+	}
+}
+
+// clone copies a dataset to a new id in one transaction.
+func (db *DB) clone(ctx context.Context, id uuid.UUID, newid uuid.UUID, blob []byte) error {
+	if err := checkID(newid); err != nil {
+		return err
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = tx.checkBlobSize(len(blob)); err != nil {
+		return err
+	}
+
+	column, data, err := tx.blobColumn(blob)
+	if err != nil {
+		return err
+	}
+
+	ct, err := tx.Exec(`
+		INSERT INTO datasets(id, creator, owner, created, modified, synced, published, valid, family, schema, `+column+`, compressed)
+		(SELECT $2, creator, owner, created, modified, synced, published, valid, family, schema, $3, $4 FROM datasets WHERE id = $1 AND deleted IS NULL)`,
+		id.Array(), newid.Array(), data, column == "blob_gz")
+	if err != nil {
+		return handleContextError(ctx, err)
+	}
+
+	if ct.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	return tx.Commit()
+}
+
+// CloneAsDraft copies a dataset to a new id as an unpublished draft owned and created by the given user.
+// Only the family and schema are copied from the source; the blob is replaced by the given one.
+func (db *DB) CloneAsDraft(id uuid.UUID, newid uuid.UUID, owner uuid.UUID, blob []byte) error {
+	return db.CloneAsDraftContext(context.Background(), id, newid, owner, blob)
+}
+
+// CloneAsDraftContext copies a dataset to a new id as an unpublished draft, within the given context.
+func (db *DB) CloneAsDraftContext(ctx context.Context, id uuid.UUID, newid uuid.UUID, owner uuid.UUID, blob []byte) error {
+	if err := checkID(id); err != nil {
+		return wrapError("clone", id, err)
 	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("clone", id, err)
+	}
+	defer tx.Rollback()
+
+	if err = tx.checkBlobSize(len(blob)); err != nil {
+		return wrapError("clone", id, err)
+	}
+
+	if err = tx.checkQuota(owner); err != nil {
+		return wrapError("clone", id, handleContextError(ctx, err))
+	}
+
+	column, data, err := tx.blobColumn(blob)
+	if err != nil {
+		return wrapError("clone", id, err)
+	}
+
+	ct, err := tx.Exec(`
+		INSERT INTO datasets(id, creator, owner, published, synced, family, schema, `+column+`, compressed)
+		(SELECT $2, $3, $3, false, NULL, family, schema, $4, $5 FROM datasets WHERE id = $1 AND deleted IS NULL)`,
+		id.Array(), newid.Array(), owner.Array(), data, column == "blob_gz")
+	if err != nil {
+		return wrapError("clone", id, handleContextError(ctx, err))
+	}
+
+	if ct.RowsAffected() != 1 {
+		return wrapError("clone", id, ErrNotFound)
+	}
+
+	err = tx.validateStored(newid)
+	if err != nil {
+		return wrapError("clone", id, handleContextError(ctx, err))
+	}
+
+	return wrapError("clone", id, tx.Commit())
+}
+
+func (tx *Tx) getSchema(id uuid.UUID) (string, error) {
+	var schema string
+	err := tx.QueryRow("SELECT schema FROM datasets WHERE id = $1", id.Array()).Scan(&schema)
+	if err != nil {
+		return "", handleError(err)
+	}
+
+	return schema, nil
+}
+
+func (tx *Tx) getFamily(id uuid.UUID) (models.Family, error) {
+	var fam int
+	err := tx.QueryRow(stmtGetFamily, id.Array()).Scan(&fam)
+	if err != nil {
+		return 0, handleError(err)
+	}
+
+	return models.Family(fam), nil
+}
+
+// CheckOwner returns an error if the record is not owned by the given user.
+//
+// It returns ErrNotFound if the record doesn't exist and ErrNotOwner if it belongs to someone else;
+// if SetHideNotFoundAsNotOwner is enabled, both cases return ErrNotOwner so the caller can't tell whether the record exists.
+func (tx *Tx) CheckOwner(id uuid.UUID, owner uuid.UUID) error {
+	return tx.checkOwner(stmtCheckOwner, id, owner)
+}
+
+// checkDeletedOwner is like CheckOwner, but also finds soft-deleted datasets, so their owner can restore or purge them.
+func (tx *Tx) checkDeletedOwner(id uuid.UUID, owner uuid.UUID) error {
+	return tx.checkOwner("SELECT (owner = $2) FROM datasets WHERE id = $1", id, owner)
+}
+
+// checkOwner runs an ownership query taking the dataset id and owner; see CheckOwner.
+func (tx *Tx) checkOwner(sql string, id uuid.UUID, owner uuid.UUID) error {
+	var isOwner bool
+	err := tx.QueryRow(sql, id.Array(), owner.Array()).Scan(&isOwner)
+	if err != nil {
+		err = handleError(err)
+		if err == ErrNotFound && tx.hideNotFound {
+			return ErrNotOwner
+		}
+		return err
+	}
+
+	if !isOwner {
+		return ErrNotOwner
+	}
+
+	return nil
+}
+
+// CheckOwner calls tx.CheckOwner to check if the record exists and is owner by the given user.
+func (db *DB) CheckOwner(id uuid.UUID, owner uuid.UUID) (err error) {
+	return db.CheckOwnerContext(context.Background(), id, owner)
+}
+
+// CheckOwnerContext checks ownership of a record within the given context.
+func (db *DB) CheckOwnerContext(ctx context.Context, id uuid.UUID, owner uuid.UUID) (err error) {
+	if err := checkID(id); err != nil {
+		return wrapError("check owner", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("check owner", id, err)
+	}
+	defer tx.Rollback()
+
+	return wrapError("check owner", id, handleContextError(ctx, tx.CheckOwner(id, owner)))
+}
+
+// CheckOwnerMany checks ownership of several datasets at once, for authorising bulk actions in one round trip.
+// It splits the ids, in the order given, into those owned by the user and those that are not;
+// missing and deleted datasets count as not owned.
+func (db *DB) CheckOwnerMany(ids []uuid.UUID, owner uuid.UUID) (owned []uuid.UUID, notOwned []uuid.UUID, err error) {
+	return db.CheckOwnerManyContext(context.Background(), ids, owner)
+}
+
+// CheckOwnerManyContext checks ownership of several datasets within the given context.
+func (db *DB) CheckOwnerManyContext(ctx context.Context, ids []uuid.UUID, owner uuid.UUID) (owned []uuid.UUID, notOwned []uuid.UUID, err error) {
+	defer db.observe("check owner", time.Now(), &err)
+
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	arrays, err := idArrays("check owner", ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := db.pool.QueryEx(ctx, "SELECT id FROM datasets WHERE id = ANY($1) AND owner = $2 AND deleted IS NULL", nil, arrays, owner.Array())
+	if err != nil {
+		return nil, nil, wrapError("check owner", uuid.UUID{}, handleContextError(ctx, err))
+	}
+	defer rows.Close()
+
+	isOwned := make(map[uuid.UUID]bool, len(ids))
+	for rows.Next() {
+		var id uuid.UUID
+		if err = rows.Scan(id.Array()); err != nil {
+			return nil, nil, wrapError("check owner", uuid.UUID{}, handleContextError(ctx, err))
+		}
+		isOwned[id] = true
+	}
+	if rows.Err() != nil {
+		return nil, nil, wrapError("check owner", uuid.UUID{}, handleContextError(ctx, rows.Err()))
+	}
+
+	for _, id := range ids {
+		if isOwned[id] {
+			owned = append(owned, id)
+		} else {
+			notOwned = append(notOwned, id)
+		}
+	}
+	return owned, notOwned, nil
+}
+
+// GetOwner returns the owner of a dataset without fetching the dataset itself; it returns ErrNotFound if there is no such dataset.
+func (db *DB) GetOwner(id uuid.UUID) (uuid.UUID, error) {
+	return db.GetOwnerContext(context.Background(), id)
+}
+
+// GetOwnerContext returns the owner of a dataset within the given context.
+// It reads from the replica if one is configured; see WithReadConsistency.
+func (db *DB) GetOwnerContext(ctx context.Context, id uuid.UUID) (owner uuid.UUID, err error) {
+	defer db.observe("get owner", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return owner, wrapError("get owner", id, err)
+	}
+
+	err = db.readPool(ctx).QueryRowEx(ctx, "SELECT owner FROM datasets WHERE id = $1 AND deleted IS NULL", nil, id.Array()).Scan(owner.Array())
+	if err != nil {
+		return uuid.UUID{}, wrapError("get owner", id, handleContextError(ctx, err))
+	}
+	return owner, nil
+}
+
+// idArrays checks a list of ids and converts them to byte arrays for use as a query parameter with `= ANY($n)`.
+func idArrays(op string, ids []uuid.UUID) ([][16]byte, error) {
+	arrays := make([][16]byte, len(ids))
+	for i := range ids {
+		if err := checkID(ids[i]); err != nil {
+			return nil, wrapError(op, ids[i], err)
+		}
+		arrays[i] = *ids[i].Array()
+	}
+	return arrays, nil
+}
+
+// Get retrieves a dataset from the database.
+func (db *DB) Get(id uuid.UUID) (*models.Dataset, error) {
+	return db.GetContext(context.Background(), id)
+}
+
+// GetContext retrieves a dataset from the database within the given context.
+// It always returns ErrNotFound for missing datasets, regardless of SetHideNotFoundAsNotOwner.
+// It reads from the replica if one is configured; see WithReadConsistency.
+func (db *DB) GetContext(ctx context.Context, id uuid.UUID) (_ *models.Dataset, err error) {
+	defer db.observe("get", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return nil, wrapError("get", id, err)
+	}
+
+	res, err := db.getDataset(ctx, stmtGet, id.Array())
+	if err != nil {
+		return nil, wrapError("get", id, err)
+	}
+
+	db.touch(id)
+	return res, nil
+}
+
+// GetIfChanged retrieves a dataset unless its sequence number still equals knownSeq, in which case it returns ErrNotModified
+// without transferring the blob. Use the seq of an earlier Get as ETag to answer conditional requests.
+func (db *DB) GetIfChanged(id uuid.UUID, knownSeq int64) (*models.Dataset, error) {
+	return db.GetIfChangedContext(context.Background(), id, knownSeq)
+}
+
+// GetIfChangedContext retrieves a dataset if it has changed since knownSeq, within the given context.
+// It reads from the replica if one is configured; see WithReadConsistency.
+func (db *DB) GetIfChangedContext(ctx context.Context, id uuid.UUID, knownSeq int64) (_ *models.Dataset, err error) {
+	defer db.observe("get", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return nil, wrapError("get", id, err)
+	}
+
+	res, err := db.getDataset(ctx, datasetIfChangedSelect, id.Array(), knownSeq)
 	if err != nil {
-		return handleError(err)
+		return nil, wrapError("get", id, err)
+	}
+
+	if res.Seq == knownSeq {
+		return nil, wrapError("get", id, ErrNotModified)
+	}
+	return res, nil
+}
+
+// GetByMetaxId retrieves a dataset by its Metax identifier.
+func (db *DB) GetByMetaxId(metaxId string) (*models.Dataset, error) {
+	return db.GetByMetaxIdContext(context.Background(), metaxId)
+}
+
+// GetByMetaxIdContext retrieves a dataset by its Metax identifier within the given context.
+func (db *DB) GetByMetaxIdContext(ctx context.Context, metaxId string) (*models.Dataset, error) {
+	return db.getDataset(ctx, datasetSelect+"metax_id = $1 and deleted is null", metaxId)
+}
+
+// GetIncludingDeleted retrieves a dataset from the database even if it has been soft-deleted.
+func (db *DB) GetIncludingDeleted(id uuid.UUID) (*models.Dataset, error) {
+	return db.GetIncludingDeletedContext(context.Background(), id)
+}
+
+// GetIncludingDeletedContext retrieves a dataset even if it has been soft-deleted, within the given context.
+func (db *DB) GetIncludingDeletedContext(ctx context.Context, id uuid.UUID) (*models.Dataset, error) {
+	if err := checkID(id); err != nil {
+		return nil, wrapError("get", id, err)
 	}
 
-	return tx.Commit()
+	res, err := db.getDataset(ctx, datasetSelect+"id = $1", id.Array())
+	return res, wrapError("get", id, err)
 }
 
-// StorePublished saves a published dataset to the database and marks it as published.
-// TODO: handle empty blob
-func (db *DB) StorePublished(id uuid.UUID, blob []byte, synced time.Time) error {
-	tx, err := db.Begin()
+// getDataset retrieves a dataset with a query selecting the datasetSelect columns, given as SQL or prepared statement name.
+func (db *DB) getDataset(ctx context.Context, sql string, args ...interface{}) (*models.Dataset, error) {
+	var (
+		created, modified, synced *time.Time
+
+		metaxId *string
+		by      *[16]byte
+		valid   *bool
+		family  *int
+		schema  *string
+		blob    []byte
+	)
+
+	res := new(models.Dataset)
+	err := db.readPool(ctx).QueryRowEx(ctx, sql, nil, args...).Scan(res.Id.Array(), res.Creator.Array(), res.Owner.Array(), &created, &modified, &synced, &res.Seq, &metaxId, &by, &valid, &family, &schema, &blob)
 	if err != nil {
-		return err
+		return nil, handleContextError(ctx, err)
 	}
-	defer tx.Rollback()
 
-	ct, err := tx.Exec("UPDATE datasets SET blob = $2, published = true, synced = $3, seq = seq + 1 WHERE id = $1",
-		id.Array(), blob, synced)
+	blob, err = decompressBlob(blob)
 	if err != nil {
-		return handleError(err)
+		return nil, err
 	}
 
-	if ct.RowsAffected() != 1 {
-		return ErrNotFound
+	err = res.SetData(models.Family(*family), *schema, blob)
+	if err != nil {
+		return nil, err
 	}
 
-	return tx.Commit()
+	res.SetValid(*valid)
+	res.Created, res.Modified, res.Synced = timeOrZero(created), timeOrZero(modified), timeOrZero(synced)
+	if metaxId != nil {
+		res.MetaxId = *metaxId
+	}
+	if by != nil {
+		res.ModifiedBy = *by
+	}
+
+	return res, nil
 }
 
-func (db *DB) Clone(id uuid.UUID, newid uuid.UUID, blob []byte) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return err
+// actor returns the acting user as query argument, or NULL if unknown.
+func actor(by *uuid.UUID) interface{} {
+	if by == nil {
+		return nil
 	}
-	defer tx.Rollback()
+	return by.Array()
+}
 
-	ct, err := tx.Exec(`
-		INSERT INTO datasets(id, creator, owner, created, modified, synced, published, valid, family, schema, blob)
-		(SELECT $2, creator, owner, created, modified, synced, published, valid, family, schema, $3 WHERE id = $1)`,
-		id, newid, blob)
-	if err != nil {
-		return handleError(err)
+// timeOrZero returns the time t points to, or the zero time for NULL database values.
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
 	}
+	return *t
+}
 
-	if ct.RowsAffected() != 1 {
-		return ErrNotFound
+// timeOrNull returns t as query argument, or NULL for the zero time; it is the inverse of timeOrZero.
+func timeOrNull(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
 	}
+	return t
+}
 
-	return tx.Commit()
+// GetMany retrieves several datasets at once, keyed by id. Ids that don't exist are absent from the map.
+func (db *DB) GetMany(ids []uuid.UUID) (map[uuid.UUID]*models.Dataset, error) {
+	return db.GetManyContext(context.Background(), ids)
 }
 
-func (tx *Tx) getFamily(id uuid.UUID) (int, error) {
-	var fam int
-	err := tx.QueryRow("SELECT family FROM datasets WHERE id = $1", id.Array()).Scan(&fam)
-	if err != nil {
-		return 0, handleError(err)
+// GetManyContext retrieves several datasets at once, keyed by id, within the given context.
+// It reads from the replica if one is configured; see WithReadConsistency.
+func (db *DB) GetManyContext(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.Dataset, error) {
+	res := make(map[uuid.UUID]*models.Dataset, len(ids))
+	if len(ids) == 0 {
+		return res, nil
 	}
 
-	return fam, nil
-}
+	arrays := make([][16]byte, len(ids))
+	for i := range ids {
+		arrays[i] = *ids[i].Array()
+	}
 
-// CheckOwner returns an error if the record is not owned by the given user.
-func (tx *Tx) CheckOwner(id uuid.UUID, owner uuid.UUID) error {
-	var isOwner bool
-	err := tx.QueryRow("SELECT (owner = $2) FROM datasets WHERE id = $1", id.Array(), owner.Array()).Scan(&isOwner)
+	rows, err := db.readPool(ctx).QueryEx(ctx, "select id, creator, owner, seq, valid, family, schema, dataset_data(id, blob, blob_gz) from datasets where id = any($1) and deleted is null", nil, arrays)
 	if err != nil {
-		return handleError(err)
+		return nil, handleContextError(ctx, err)
 	}
+	defer rows.Close()
 
-	if !isOwner {
-		return ErrNotOwner
+	for rows.Next() {
+		var (
+			valid  bool
+			family int
+			schema string
+			blob   []byte
+		)
+
+		dataset := new(models.Dataset)
+		err = rows.Scan(dataset.Id.Array(), dataset.Creator.Array(), dataset.Owner.Array(), &dataset.Seq, &valid, &family, &schema, &blob)
+		if err != nil {
+			return nil, handleContextError(ctx, err)
+		}
+		blob, err = decompressBlob(blob)
+		if err != nil {
+			return nil, err
+		}
+		err = dataset.SetData(models.Family(family), schema, blob)
+		if err != nil {
+			return nil, err
+		}
+		dataset.SetValid(valid)
+		res[dataset.Id] = dataset
 	}
 
-	return nil
+	if rows.Err() != nil {
+		return nil, handleContextError(ctx, rows.Err())
+	}
+
+	return res, nil
 }
 
-// CheckOwner calls tx.CheckOwner to check if the record exists and is owner by the given user.
-func (db *DB) CheckOwner(id uuid.UUID, owner uuid.UUID) (err error) {
-	tx, err := db.Begin()
+// GetManyOrdered retrieves several datasets at once in the order requested, with nil entries for ids that don't exist.
+func (db *DB) GetManyOrdered(ids []uuid.UUID) ([]*models.Dataset, error) {
+	return db.GetManyOrderedContext(context.Background(), ids)
+}
+
+// GetManyOrderedContext retrieves several datasets in the order requested, within the given context.
+func (db *DB) GetManyOrderedContext(ctx context.Context, ids []uuid.UUID) ([]*models.Dataset, error) {
+	found, err := db.GetManyContext(ctx, ids)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	list := make([]*models.Dataset, len(ids))
+	for i := range ids {
+		list[i] = found[ids[i]]
 	}
-	defer tx.Rollback()
 
-	return tx.CheckOwner(id, owner)
+	return list, nil
 }
 
-// Get retrieves a dataset from the database.
-func (db *DB) Get(id uuid.UUID) (*models.Dataset, error) {
-	var (
-		valid  *bool
-		family *int
-		schema *string
-		blob   []byte
-	)
+// GetWithOwner retrieves a dataset from the database if the owner matches.
+func (db *DB) GetWithOwner(id uuid.UUID, owner uuid.UUID) (*models.Dataset, error) {
+	return db.GetWithOwnerContext(context.Background(), id, owner)
+}
 
-	res := new(models.Dataset)
-	err := db.pool.QueryRow("select id, creator, owner, valid, family, schema, blob from datasets where id=$1", id.Array()).Scan(res.Id.Array(), res.Creator.Array(), res.Owner.Array(), &valid, &family, &schema, &blob)
+// GetWithOwnerContext retrieves a dataset if the owner matches, within the given context.
+//
+// A missing dataset returns ErrNotFound, or ErrNotOwner if SetHideNotFoundAsNotOwner is enabled;
+// internal callers that need to know whether a dataset exists should use Get.
+//
+// This always reads from the primary: the ownership check and read run in one transaction,
+// and callers typically go on to update the dataset, which a lagging replica might not reflect.
+func (db *DB) GetWithOwnerContext(ctx context.Context, id uuid.UUID, owner uuid.UUID) (_ *models.Dataset, err error) {
+	defer db.observe("get", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return nil, wrapError("get", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
 	if err != nil {
-		return nil, handleError(err)
+		return nil, wrapError("get", id, err)
 	}
+	defer tx.Rollback()
 
-	err = res.SetData(*family, *schema, blob)
+	err = tx.CheckOwner(id, owner)
 	if err != nil {
-		return nil, err
+		return nil, wrapError("get", id, handleContextError(ctx, err))
 	}
 
-	res.SetValid(*valid)
+	res, err := tx.get(id, "")
+	if err != nil {
+		return nil, wrapError("get", id, handleContextError(ctx, err))
+	}
 
+	db.touch(id)
 	return res, nil
 }
 
-// GetWithOwner retrieves a dataset from the database if the owner matches.
-func (db *DB) GetWithOwner(id uuid.UUID, owner uuid.UUID) (*models.Dataset, error) {
-	tx, err := db.Begin()
+// GetField retrieves the JSON value at the given path in a dataset's blob if the owner matches.
+func (db *DB) GetField(id uuid.UUID, owner uuid.UUID, path []string) (json.RawMessage, error) {
+	return db.GetFieldContext(context.Background(), id, owner, path)
+}
+
+// GetFieldContext retrieves the JSON value at a path in a dataset's blob within the given context.
+// This allows loading large sub-sections of a dataset without transferring the whole blob.
+// It returns ErrNotFound if the path doesn't exist in the document.
+func (db *DB) GetFieldContext(ctx context.Context, id uuid.UUID, owner uuid.UUID, path []string) (json.RawMessage, error) {
+	if err := checkID(id); err != nil {
+		return nil, wrapError("get field", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
 	if err != nil {
-		return nil, err
+		return nil, wrapError("get field", id, err)
 	}
 	defer tx.Rollback()
 
 	err = tx.CheckOwner(id, owner)
 	if err != nil {
-		return nil, err
+		return nil, wrapError("get field", id, handleContextError(ctx, err))
+	}
+
+	var field []byte
+	err = tx.QueryRow("SELECT dataset_blob(id, blob) #> $2 FROM datasets WHERE id = $1 AND deleted IS NULL", id.Array(), path).Scan(&field)
+	if err != nil {
+		return nil, wrapError("get field", id, handleContextError(ctx, err))
+	}
+	if field == nil {
+		return nil, wrapError("get field", id, ErrNotFound)
 	}
 
-	return tx.get(id, "")
+	return json.RawMessage(field), nil
 }
 
 func (tx *Tx) get(id uuid.UUID, key string) (*models.Dataset, error) {
 	var (
-		family *int
-		schema *string
-		blob   []byte
+		created, modified, synced *time.Time
+
+		metaxId *string
+		by      *[16]byte
+		family  *int
+		schema  *string
+		blob    []byte
 
 		err error
 	)
 
 	res := new(models.Dataset)
 	if key == "" {
-		err = tx.QueryRow("select id, creator, owner, family, schema, blob from datasets where id=$1", id.Array()).Scan(res.Id.Array(), res.Creator.Array(), res.Owner.Array(), &family, &schema, &blob)
+		err = tx.QueryRow(stmtGetTx, id.Array()).Scan(res.Id.Array(), res.Creator.Array(), res.Owner.Array(), &created, &modified, &synced, &res.Seq, &metaxId, &by, &family, &schema, &blob)
 	} else {
-		err = tx.QueryRow(`select id, creator, owner, family, schema, blob#>$2 from datasets where id=$1`, id.Array(), []string{key}).Scan(res.Id.Array(), res.Creator.Array(), res.Owner.Array(), &family, &schema, &blob)
+		err = tx.QueryRow(`select id, creator, owner, created, modified, synced, seq, metax_id, modified_by, family, schema, dataset_blob(id, blob)#>$2 from datasets where id=$1 and deleted is null`, id.Array(), []string{key}).Scan(res.Id.Array(), res.Creator.Array(), res.Owner.Array(), &created, &modified, &synced, &res.Seq, &metaxId, &by, &family, &schema, &blob)
 	}
 	if err != nil {
 		return nil, handleError(err)
 	}
 
-	err = res.SetData(*family, *schema, blob)
+	blob, err = decompressBlob(blob)
+	if err != nil {
+		return nil, err
+	}
+
+	err = res.SetData(models.Family(*family), *schema, blob)
 	if err != nil {
 		return nil, err
 	}
 
+	res.Created, res.Modified, res.Synced = timeOrZero(created), timeOrZero(modified), timeOrZero(synced)
+	if metaxId != nil {
+		res.MetaxId = *metaxId
+	}
+	if by != nil {
+		res.ModifiedBy = *by
+	}
+
 	return res, nil
 }
 
 // Delete removes one dataset from the database if the owner matches.
 func (db *DB) Delete(id uuid.UUID, owner *uuid.UUID) error {
-	tx, err := db.Begin()
+	return db.DeleteContext(context.Background(), id, owner)
+}
+
+// DeleteContext removes one dataset if the owner matches, within the given context.
+func (db *DB) DeleteContext(ctx context.Context, id uuid.UUID, owner *uuid.UUID) (err error) {
+	defer db.observe("delete", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return wrapError("delete", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
 	if err != nil {
-		return err
+		return wrapError("delete", id, err)
 	}
 	defer tx.Rollback()
 
 	if owner != nil {
-		err = tx.CheckOwner(id, *owner)
+		err = tx.checkDeletedOwner(id, *owner)
 		if err != nil {
-			return handleError(err)
+			return wrapError("delete", id, handleContextError(ctx, err))
 		}
 	}
 
 	ct, err := tx.Exec(`DELETE FROM datasets WHERE id = $1`, id.Array())
 	if err != nil {
-		return handleError(err)
+		return wrapError("delete", id, handleContextError(ctx, err))
+	}
+
+	if ct.RowsAffected() != 1 {
+		return wrapError("delete", id, ErrNotFound)
+	}
+
+	return wrapError("delete", id, tx.Commit())
+}
+
+// SoftDelete marks a dataset as deleted without removing it, if the owner matches.
+// Soft-deleted datasets are hidden from the normal read paths and can be brought back with Restore.
+func (db *DB) SoftDelete(id uuid.UUID, owner *uuid.UUID) error {
+	return db.SoftDeleteContext(context.Background(), id, owner)
+}
+
+// SoftDeleteContext marks a dataset as deleted if the owner matches, within the given context.
+func (db *DB) SoftDeleteContext(ctx context.Context, id uuid.UUID, owner *uuid.UUID) (err error) {
+	defer db.observe("delete", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return wrapError("delete", id, err)
+	}
+
+	return wrapError("delete", id, db.setDeleted(ctx, id, owner, true))
+}
+
+// Restore brings back a soft-deleted dataset if the owner matches.
+func (db *DB) Restore(id uuid.UUID, owner *uuid.UUID) error {
+	return db.RestoreContext(context.Background(), id, owner)
+}
+
+// RestoreContext brings back a soft-deleted dataset if the owner matches, within the given context.
+func (db *DB) RestoreContext(ctx context.Context, id uuid.UUID, owner *uuid.UUID) (err error) {
+	defer db.observe("restore", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return wrapError("restore", id, err)
+	}
+
+	return wrapError("restore", id, db.setDeleted(ctx, id, owner, false))
+}
+
+// setDeleted sets or clears the deletion timestamp; it returns ErrNotFound if the dataset is not in the expected state.
+func (db *DB) setDeleted(ctx context.Context, id uuid.UUID, owner *uuid.UUID, deleted bool) error {
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if owner != nil {
+		err = tx.checkDeletedOwner(id, *owner)
+		if err != nil {
+			return handleContextError(ctx, err)
+		}
+	}
+
+	sql := "UPDATE datasets SET deleted = now(), seq = seq + 1 WHERE id = $1 AND deleted IS NULL"
+	if !deleted {
+		sql = "UPDATE datasets SET deleted = NULL, seq = seq + 1 WHERE id = $1 AND deleted IS NOT NULL"
+	}
+
+	ct, err := tx.Exec(sql, id.Array())
+	if err != nil {
+		return handleContextError(ctx, err)
 	}
 
 	if ct.RowsAffected() != 1 {
@@ -516,11 +2386,16 @@ func (db *DB) Delete(id uuid.UUID, owner *uuid.UUID) error {
 
 // GetAllForUid returns all datasets for a given user.
 func (db *DB) GetAllForUid(uid uuid.UUID) ([]*models.Dataset, error) {
+	return db.GetAllForUidContext(context.Background(), uid)
+}
+
+// GetAllForUidContext returns all datasets for a given user within the given context.
+func (db *DB) GetAllForUidContext(ctx context.Context, uid uuid.UUID) ([]*models.Dataset, error) {
 	var list []*models.Dataset
 
-	rows, err := db.pool.Query("select id, creator, owner, synced, family, schema, valid, blob from datasets where owner=$1", uid.Array())
+	rows, err := db.pool.QueryEx(ctx, "select id, creator, owner, synced, family, schema, valid, dataset_data(id, blob, blob_gz) from datasets where owner=$1 and deleted is null", nil, uid.Array())
 	if err != nil {
-		return list, err
+		return list, handleContextError(ctx, err)
 	}
 	defer rows.Close()
 
@@ -540,7 +2415,11 @@ func (db *DB) GetAllForUid(uid uuid.UUID) ([]*models.Dataset, error) {
 		if synced != nil {
 			dataset.Synced = *synced
 		}
-		dataset.SetData(family, schema, blob)
+		blob, err = decompressBlob(blob)
+		if err != nil {
+			return nil, err
+		}
+		err = dataset.SetData(models.Family(family), schema, blob)
 		if err != nil {
 			return nil, err
 		}
@@ -548,60 +2427,224 @@ func (db *DB) GetAllForUid(uid uuid.UUID) ([]*models.Dataset, error) {
 	}
 
 	if rows.Err() != nil {
-		return []*models.Dataset{}, rows.Err()
+		return []*models.Dataset{}, handleContextError(ctx, rows.Err())
 	}
 
 	return list, nil
 }
 
-// ListAllForUid returns the list of datasets for a given user.
-func (db *DB) ListAllForUid(uid uuid.UUID) ([]*models.Dataset, error) {
+// ListAllForUid returns the list of datasets for a given user in the given order; the zero OrderBy sorts by modification date, newest first.
+func (db *DB) ListAllForUid(uid uuid.UUID, order OrderBy) ([]*models.Dataset, error) {
+	return db.ListAllForUidContext(context.Background(), uid, order)
+}
+
+// ListAllForUidContext returns the list of datasets for a given user within the given context.
+// The blobs are not fetched; each dataset has an empty `{}` blob. It reads from the replica if one is configured; see WithReadConsistency.
+func (db *DB) ListAllForUidContext(ctx context.Context, uid uuid.UUID, order OrderBy) (_ []*models.Dataset, err error) {
+	defer db.observe("list", time.Now(), &err)
+
 	var list []*models.Dataset
 
-	rows, err := db.pool.Query("select id, creator, owner, family, schema, valid from datasets where owner=$1", uid.Array())
+	orderBy, err := order.sql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.readPool(ctx).QueryEx(ctx, metaSelect+"owner = $1 AND deleted IS NULL ORDER BY "+orderBy, nil, uid.Array())
 	if err != nil {
-		return list, err
+		return list, handleContextError(ctx, err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var dataset models.Dataset
-		var (
-			family int
-			schema string
-			valid  bool
-		)
-		err = rows.Scan(dataset.Id.Array(), dataset.Creator.Array(), dataset.Owner.Array(), &family, &schema, &valid)
+		meta, err := scanMeta(rows)
 		if err != nil {
 			return nil, err
 		}
-		dataset.SetData(family, schema, nil)
+		dataset, err := meta.Dataset()
 		if err != nil {
 			return nil, err
 		}
-		list = append(list, &dataset)
+		list = append(list, dataset)
 	}
 
 	if rows.Err() != nil {
-		return []*models.Dataset{}, rows.Err()
+		return []*models.Dataset{}, handleContextError(ctx, rows.Err())
 	}
 
 	return list, nil
 }
 
-// ChangeOwnerTo updates a dataset's owner.
+// ChangeOwnerTo updates a dataset's owner. It returns ErrNotFound if there is no dataset with the given id,
+// and ErrUnknownUser if the new owner isn't a registered user, so a typo can't orphan the dataset.
+//
+// Unlike TransferOwnership it doesn't check the current owner or record the change in the ownership history.
 func (db *DB) ChangeOwnerTo(id uuid.UUID, uid uuid.UUID) error {
-	tx, err := db.pool.Begin()
+	return db.ChangeOwnerToContext(context.Background(), id, uid)
+}
+
+// ChangeOwnerToContext updates a dataset's owner within the given context.
+func (db *DB) ChangeOwnerToContext(ctx context.Context, id uuid.UUID, uid uuid.UUID) error {
+	if err := checkID(id); err != nil {
+		return wrapError("change owner", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
 	if err != nil {
-		return err
+		return wrapError("change owner", id, err)
 	}
 	defer tx.Rollback()
 
-	tag, err := tx.Exec("UPDATE datasets SET owner = $1 WHERE id = $2", uid.Array(), id.Array())
+	err = tx.checkUser(uid)
 	if err != nil {
-		return handleError(err)
+		return wrapError("change owner", id, handleContextError(ctx, err))
 	}
-	log.Println("tag:", tag)
 
-	return tx.Commit()
+	ct, err := tx.Exec("UPDATE datasets SET owner = $1 WHERE id = $2", uid.Array(), id.Array())
+	if err != nil {
+		return wrapError("change owner", id, handleContextError(ctx, err))
+	}
+
+	if ct.RowsAffected() != 1 {
+		return wrapError("change owner", id, ErrNotFound)
+	}
+
+	return wrapError("change owner", id, tx.Commit())
+}
+
+// TransferOwnership moves a dataset from one owner to another and records the change in the ownership history.
+// It returns ErrNotOwner if the dataset is not currently owned by `from`.
+func (db *DB) TransferOwnership(id uuid.UUID, from, to uuid.UUID) error {
+	return db.TransferOwnershipContext(context.Background(), id, from, to)
+}
+
+// TransferOwnershipContext moves a dataset from one owner to another within the given context.
+func (db *DB) TransferOwnershipContext(ctx context.Context, id uuid.UUID, from, to uuid.UUID) error {
+	if err := checkID(id); err != nil {
+		return wrapError("transfer ownership", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("transfer ownership", id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.transferOwnership(id, from, to)
+	if err != nil {
+		return wrapError("transfer ownership", id, handleContextError(ctx, err))
+	}
+
+	return wrapError("transfer ownership", id, tx.Commit())
+}
+
+// ReassignAll moves every dataset owned by one user to another, for instance when accounts are merged,
+// and returns the number of datasets moved. The creator is left untouched to preserve provenance.
+func (db *DB) ReassignAll(from, to uuid.UUID) (int64, error) {
+	return db.ReassignAllContext(context.Background(), from, to)
+}
+
+// ReassignAllContext moves every dataset owned by one user to another within the given context.
+// Each move is recorded in the ownership history. It returns ErrInvalidID for a nil from, ErrSameUser if from and to are equal,
+// and ErrUnknownUser if to isn't a registered user, so datasets can't be orphaned.
+func (db *DB) ReassignAllContext(ctx context.Context, from, to uuid.UUID) (n int64, err error) {
+	defer db.observe("reassign", time.Now(), &err)
+
+	if err := checkID(from); err != nil {
+		return 0, wrapError("reassign", uuid.UUID{}, err)
+	}
+	if from == to {
+		return 0, wrapError("reassign", uuid.UUID{}, ErrSameUser)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return 0, wrapError("reassign", uuid.UUID{}, err)
+	}
+	defer tx.Rollback()
+
+	if err = tx.checkUser(to); err != nil {
+		return 0, wrapError("reassign", uuid.UUID{}, handleContextError(ctx, err))
+	}
+
+	ct, err := tx.Exec(`
+		WITH moved AS (
+			UPDATE datasets SET owner = $2, seq = seq + 1 WHERE owner = $1 RETURNING id
+		)
+		INSERT INTO ownership_history(dataset, old_owner, new_owner)
+		SELECT id, $1, $2 FROM moved`,
+		from.Array(), to.Array())
+	if err != nil {
+		return 0, wrapError("reassign", uuid.UUID{}, handleContextError(ctx, err))
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, wrapError("reassign", uuid.UUID{}, err)
+	}
+
+	return ct.RowsAffected(), nil
+}
+
+// ConfirmDelete guards destructive bulk operations; only ConfirmDeleteAll is accepted.
+type ConfirmDelete string
+
+// ConfirmDeleteAll confirms that all of a user's datasets should be removed.
+const ConfirmDeleteAll ConfirmDelete = "delete all datasets"
+
+// DeleteAllForUid permanently removes every dataset owned by the given user, including soft-deleted ones,
+// for instance when the user's account is deleted. It returns the number of datasets removed.
+// The confirm argument must be ConfirmDeleteAll, otherwise ErrNotConfirmed is returned and nothing is deleted.
+func (db *DB) DeleteAllForUid(uid uuid.UUID, confirm ConfirmDelete) (int64, error) {
+	return db.DeleteAllForUidContext(context.Background(), uid, confirm)
+}
+
+// DeleteAllForUidContext permanently removes every dataset owned by the given user within the given context.
+// Versions, grants and idempotency keys of the datasets are removed by cascade; their ownership history is kept for provenance.
+func (db *DB) DeleteAllForUidContext(ctx context.Context, uid uuid.UUID, confirm ConfirmDelete) (n int64, err error) {
+	defer db.observe("delete all", time.Now(), &err)
+
+	if err := checkID(uid); err != nil {
+		return 0, wrapError("delete all", uuid.UUID{}, err)
+	}
+
+	if confirm != ConfirmDeleteAll {
+		return 0, wrapError("delete all", uuid.UUID{}, ErrNotConfirmed)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return 0, wrapError("delete all", uuid.UUID{}, err)
+	}
+	defer tx.Rollback()
+
+	ct, err := tx.Exec("DELETE FROM datasets WHERE owner = $1", uid.Array())
+	if err != nil {
+		return 0, wrapError("delete all", uuid.UUID{}, handleContextError(ctx, err))
+	}
+	n = ct.RowsAffected()
+
+	if err = tx.Commit(); err != nil {
+		return 0, wrapError("delete all", uuid.UUID{}, err)
+	}
+	return n, nil
+}
+
+// transferOwnership changes the owner of a dataset and writes an audit record.
+func (tx *Tx) transferOwnership(id uuid.UUID, from, to uuid.UUID) error {
+	err := tx.CheckOwner(id, from)
+	if err != nil {
+		return err
+	}
+
+	ct, err := tx.Exec("UPDATE datasets SET owner = $2, seq = seq + 1 WHERE id = $1", id.Array(), to.Array())
+	if err != nil {
+		return err
+	}
+
+	if ct.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	_, err = tx.Exec("INSERT INTO ownership_history(dataset, old_owner, new_owner) VALUES($1, $2, $3)", id.Array(), from.Array(), to.Array())
+	return err
 }
@@ -2,6 +2,7 @@ package psql
 
 import (
 	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 
@@ -87,3 +88,687 @@ func TestDatasetNewVersion(t *testing.T) {
 	})
 
 }
+
+// TestDatasetUpdateWithSeq tests that updates with a stale sequence number are rejected.
+func TestDatasetUpdateWithSeq(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	db, err := NewPoolServiceFromEnv()
+	if err != nil {
+		t.Fatal("psql:", err)
+	}
+
+	dataset, err := models.NewDataset(owner)
+	if err != nil {
+		t.Fatal("models.NewDataset():", err)
+	}
+	dataset.SetData(1, "open test dataset", []byte(`{"title":"seq test"}`))
+
+	err = db.Create(dataset)
+	if err != nil {
+		t.Fatal("db.Create():", err)
+	}
+	defer db.Delete(dataset.Id, nil)
+
+	stored, err := db.Get(dataset.Id)
+	if err != nil {
+		t.Fatal("db.Get():", err)
+	}
+
+	err = db.UpdateWithSeq(dataset.Id, []byte(`{"title":"first"}`), stored.Seq)
+	if err != nil {
+		t.Fatal("first update:", err)
+	}
+
+	err = db.UpdateWithSeq(dataset.Id, []byte(`{"title":"second"}`), stored.Seq)
+	if Cause(err) != ErrConflict {
+		t.Errorf("expected %v for stale seq, got %v", ErrConflict, err)
+	}
+
+	missing, err := uuid.NewUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.UpdateWithSeq(missing, []byte(`{}`), 0)
+	if Cause(err) != ErrNotFound {
+		t.Errorf("expected %v for missing dataset, got %v", ErrNotFound, err)
+	}
+}
+
+// TestUpdateModifiedBy tests that the owner-checked update variants record the acting user.
+func TestUpdateModifiedBy(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	db, err := NewPoolServiceFromEnv()
+	if err != nil {
+		t.Fatal("psql:", err)
+	}
+
+	dataset, err := models.NewDataset(owner)
+	if err != nil {
+		t.Fatal("models.NewDataset():", err)
+	}
+	dataset.SetData(1, "open test dataset", []byte(`{"title":"modified by test"}`))
+
+	if err = db.Create(dataset); err != nil {
+		t.Fatal("db.Create():", err)
+	}
+	defer db.Delete(dataset.Id, nil)
+
+	res, err := db.UpdateReturningWithOwner(dataset.Id, []byte(`{"title":"returning"}`), owner)
+	if err != nil {
+		t.Fatal("db.UpdateReturningWithOwner():", err)
+	}
+	if res.ModifiedBy != owner {
+		t.Errorf("returning: expected modified by %s, got %s", owner, res.ModifiedBy)
+	}
+
+	if err = db.Update(dataset.Id, []byte(`{"title":"anonymous"}`)); err != nil {
+		t.Fatal("db.Update():", err)
+	}
+
+	stored, err := db.Get(dataset.Id)
+	if err != nil {
+		t.Fatal("db.Get():", err)
+	}
+
+	if err = db.UpdateWithSeqWithOwner(dataset.Id, []byte(`{"title":"seq"}`), stored.Seq, owner); err != nil {
+		t.Fatal("db.UpdateWithSeqWithOwner():", err)
+	}
+
+	stored, err = db.Get(dataset.Id)
+	if err != nil {
+		t.Fatal("db.Get():", err)
+	}
+	if stored.ModifiedBy != owner {
+		t.Errorf("with seq: expected modified by %s, got %s", owner, stored.ModifiedBy)
+	}
+}
+
+// TestListAllForUid tests that listing a user's datasets scans real rows.
+func TestListAllForUid(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	db, err := NewPoolServiceFromEnv()
+	if err != nil {
+		t.Fatal("psql:", err)
+	}
+
+	uid, err := uuid.NewUUID()
+	if err != nil {
+		t.Fatal("uuid:", err)
+	}
+
+	dataset, err := models.NewDataset(uid)
+	if err != nil {
+		t.Fatal("models.NewDataset():", err)
+	}
+	dataset.SetData(1, "open test dataset", []byte(`{"title":"list test"}`))
+
+	err = db.Create(dataset)
+	if err != nil {
+		t.Fatal("db.Create():", err)
+	}
+	defer db.Delete(dataset.Id, nil)
+
+	list, err := db.ListAllForUid(uid, OrderBy{})
+	if err != nil {
+		t.Fatal("db.ListAllForUid():", err)
+	}
+
+	if len(list) != 1 {
+		t.Fatalf("expected %d dataset, got %d", 1, len(list))
+	}
+
+	if list[0].Id != dataset.Id {
+		t.Errorf("expected id %s, got %s", dataset.Id, list[0].Id)
+	}
+
+	if list[0].Owner != uid {
+		t.Errorf("expected owner %s, got %s", uid, list[0].Owner)
+	}
+
+	if list[0].Family() != 1 || list[0].Schema() != "open test dataset" {
+		t.Errorf("unexpected family or schema: %d, %q", list[0].Family(), list[0].Schema())
+	}
+}
+
+// TestDatasetCreateDuplicate tests that inserting an existing id returns ErrAlreadyExists with the constraint name.
+func TestDatasetCreateDuplicate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	db, err := NewPoolServiceFromEnv()
+	if err != nil {
+		t.Fatal("psql:", err)
+	}
+
+	dataset, err := models.NewDataset(owner)
+	if err != nil {
+		t.Fatal("models.NewDataset():", err)
+	}
+	dataset.SetData(1, "open test dataset", []byte(`{"title":"duplicate test"}`))
+
+	err = db.Create(dataset)
+	if err != nil {
+		t.Fatal("db.Create():", err)
+	}
+	defer db.Delete(dataset.Id, nil)
+
+	err = db.Create(dataset)
+	if Cause(err) != ErrAlreadyExists {
+		t.Fatalf("expected %v for duplicate id, got %v", ErrAlreadyExists, err)
+	}
+
+	var constraintErr *ConstraintError
+	if opErr, ok := err.(*OpError); ok {
+		constraintErr, _ = opErr.Err.(*ConstraintError)
+	}
+	if constraintErr == nil || constraintErr.Constraint != "datasets_pkey" {
+		t.Errorf("expected constraint %q, got %v", "datasets_pkey", err)
+	}
+}
+
+// TestGetNotFound tests that Get and GetWithOwner report a missing or soft-deleted dataset the same way.
+func TestGetNotFound(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	db, err := NewPoolServiceFromEnv()
+	if err != nil {
+		t.Fatal("psql:", err)
+	}
+
+	missing, err := uuid.NewUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataset, err := models.NewDataset(owner)
+	if err != nil {
+		t.Fatal("models.NewDataset():", err)
+	}
+	dataset.SetData(1, "open test dataset", []byte(`{"title":"not found test"}`))
+
+	if err = db.Create(dataset); err != nil {
+		t.Fatal("db.Create():", err)
+	}
+	defer db.Delete(dataset.Id, nil)
+
+	if err = db.SoftDelete(dataset.Id, nil); err != nil {
+		t.Fatal("db.SoftDelete():", err)
+	}
+
+	for name, id := range map[string]uuid.UUID{"missing": missing, "deleted": dataset.Id} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := db.Get(id); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get: expected %v, got %v", ErrNotFound, err)
+			}
+			if _, err := db.GetWithOwner(id, owner); !errors.Is(err, ErrNotFound) {
+				t.Errorf("GetWithOwner: expected %v, got %v", ErrNotFound, err)
+			}
+		})
+	}
+}
+
+// TestSoftDeletedNotFound tests that the write paths refuse soft-deleted datasets.
+func TestSoftDeletedNotFound(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	db, err := NewPoolServiceFromEnv()
+	if err != nil {
+		t.Fatal("psql:", err)
+	}
+
+	dataset, err := models.NewDataset(owner)
+	if err != nil {
+		t.Fatal("models.NewDataset():", err)
+	}
+	dataset.SetData(1, "open test dataset", []byte(`{"title":"soft-deleted test"}`))
+
+	if err = db.Create(dataset); err != nil {
+		t.Fatal("db.Create():", err)
+	}
+	defer db.Delete(dataset.Id, nil)
+
+	stored, err := db.Get(dataset.Id)
+	if err != nil {
+		t.Fatal("db.Get():", err)
+	}
+
+	if err = db.SoftDelete(dataset.Id, nil); err != nil {
+		t.Fatal("db.SoftDelete():", err)
+	}
+
+	newid, err := uuid.NewUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob := []byte(`{"title":"changed"}`)
+	tests := map[string]func() error{
+		"CheckOwner":    func() error { return db.CheckOwner(dataset.Id, owner) },
+		"Update":        func() error { return db.Update(dataset.Id, blob) },
+		"UpdateWithSeq": func() error { return db.UpdateWithSeq(dataset.Id, blob, stored.Seq) },
+		"UpdateReturning": func() error {
+			_, err := db.UpdateReturning(dataset.Id, blob)
+			return err
+		},
+		"Patch": func() error { return db.Patch(dataset.Id, blob) },
+		"PatchReturning": func() error {
+			_, err := db.PatchReturning(dataset.Id, blob)
+			return err
+		},
+		"StorePublished": func() error {
+			_, err := db.StorePublished(dataset.Id, blob, "metax-id", time.Now())
+			return err
+		},
+		"Clone": func() error { return db.Clone(dataset.Id, newid, blob) },
+	}
+
+	for name, f := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := f(); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected %v, got %v", ErrNotFound, err)
+			}
+		})
+	}
+
+	// the owner can still restore the dataset
+	if err = db.Restore(dataset.Id, &owner); err != nil {
+		t.Error("db.Restore():", err)
+	}
+}
+
+// TestDeleteAllForUidConfirm tests that bulk deletion is refused without confirmation, before touching the database.
+func TestDeleteAllForUidConfirm(t *testing.T) {
+	db := &DB{}
+	for _, confirm := range []ConfirmDelete{"", "yes"} {
+		if n, err := db.DeleteAllForUid(owner, confirm); Cause(err) != ErrNotConfirmed || n != 0 {
+			t.Errorf("%q: expected (0, %v), got (%d, %v)", confirm, ErrNotConfirmed, n, err)
+		}
+	}
+}
+
+// TestGetNullBlob tests that a dataset stored with a NULL blob is returned with an empty JSON object.
+func TestGetNullBlob(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	db, err := NewPoolServiceFromEnv()
+	if err != nil {
+		t.Fatal("psql:", err)
+	}
+
+	id, err := uuid.NewUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.WithTransaction(func(tx *Tx) error {
+		_, err := tx.Exec("INSERT INTO datasets(id, creator, owner, family, schema, blob) VALUES($1, $2, $2, 1, 'open test dataset', NULL)", id.Array(), owner.Array())
+		return err
+	})
+	if err != nil {
+		t.Fatal("insert:", err)
+	}
+	defer db.Delete(id, nil)
+
+	dataset, err := db.Get(id)
+	if err != nil {
+		t.Fatal("db.Get():", err)
+	}
+	if string(dataset.Blob()) != "{}" {
+		t.Errorf("expected empty object, got %q", dataset.Blob())
+	}
+}
+
+// TestApplyMergePatchNotObject tests that merge patches that would replace the whole blob are refused before touching the database.
+func TestApplyMergePatchNotObject(t *testing.T) {
+	db := &DB{}
+	for _, merge := range []string{``, `null`, `["a"]`, `"a"`, ` 1`} {
+		if err := db.ApplyMergePatch(owner, []byte(merge), owner); Cause(err) != ErrInvalidJson {
+			t.Errorf("%q: expected %v, got %v", merge, ErrInvalidJson, err)
+		}
+	}
+}
+
+// TestPatchReturning tests that a patch returns the merged blob and that ownership is still checked.
+func TestPatchReturning(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	db, err := NewPoolServiceFromEnv()
+	if err != nil {
+		t.Fatal("psql:", err)
+	}
+
+	dataset, err := models.NewDataset(owner)
+	if err != nil {
+		t.Fatal("models.NewDataset():", err)
+	}
+	dataset.SetData(1, "open test dataset", []byte(`{"title":"patch test","version":1}`))
+
+	if err = db.Create(dataset); err != nil {
+		t.Fatal("db.Create():", err)
+	}
+	defer db.Delete(dataset.Id, nil)
+
+	stored, err := db.Get(dataset.Id)
+	if err != nil {
+		t.Fatal("db.Get():", err)
+	}
+
+	res, err := db.PatchReturningWithOwner(dataset.Id, []byte(`{"version":2}`), owner)
+	if err != nil {
+		t.Fatal("db.PatchReturningWithOwner():", err)
+	}
+
+	var blob struct {
+		Title   string `json:"title"`
+		Version int    `json:"version"`
+	}
+	if err = json.Unmarshal(res.Blob(), &blob); err != nil {
+		t.Fatal("json:", err)
+	}
+	if blob.Title != "patch test" || blob.Version != 2 {
+		t.Errorf("expected merged blob, got %s", res.Blob())
+	}
+	if res.Seq != stored.Seq+1 {
+		t.Errorf("expected seq %d, got %d", stored.Seq+1, res.Seq)
+	}
+
+	other := uuid.MustFromString("11111111111111111111111111111111")
+	if _, err = db.PatchReturningWithOwner(dataset.Id, []byte(`{"version":3}`), other); Cause(err) != ErrNotOwner {
+		t.Errorf("expected %v for other owner, got %v", ErrNotOwner, err)
+	}
+}
+
+func TestCheckBlob(t *testing.T) {
+	for _, blob := range []string{`{}`, `{"title":"a"}`, ` {"a":[1,2]} `} {
+		if err := checkBlob([]byte(blob)); err != nil {
+			t.Errorf("%q: expected no error, got %v", blob, err)
+		}
+	}
+	for _, blob := range []string{``, `not-json`, `{"a":`, `{} {}`} {
+		if err := checkBlob([]byte(blob)); err != ErrInvalidJson {
+			t.Errorf("%q: expected %v, got %v", blob, ErrInvalidJson, err)
+		}
+	}
+}
+
+// TestStorePublishedInvalid tests that a malformed blob is refused before touching the database.
+func TestStorePublishedInvalid(t *testing.T) {
+	db := &DB{}
+	if _, err := db.StorePublished(owner, []byte(`not-json`), "urn:test", time.Now()); Cause(err) != ErrInvalidJson {
+		t.Errorf("expected %v, got %v", ErrInvalidJson, err)
+	}
+	if _, err := db.StorePublishedWithOptions(owner, []byte(`not-json`), "urn:test", StorePublishedOptions{MarkSyncedNow: true}); Cause(err) != ErrInvalidJson {
+		t.Errorf("expected %v with options, got %v", ErrInvalidJson, err)
+	}
+}
+
+// TestCheckOwnerMany tests that owned, foreign and missing ids are told apart in one call.
+func TestCheckOwnerMany(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	db, err := NewPoolServiceFromEnv()
+	if err != nil {
+		t.Fatal("psql:", err)
+	}
+
+	other := uuid.MustFromString("11111111111111111111111111111111")
+
+	var ids []uuid.UUID
+	for _, uid := range []uuid.UUID{owner, other} {
+		dataset, err := models.NewDataset(uid)
+		if err != nil {
+			t.Fatal("models.NewDataset():", err)
+		}
+		dataset.SetData(1, "open test dataset", []byte(`{"title":"owner test"}`))
+
+		if err = db.Create(dataset); err != nil {
+			t.Fatal("db.Create():", err)
+		}
+		defer db.Delete(dataset.Id, nil)
+		ids = append(ids, dataset.Id)
+	}
+
+	missing, err := uuid.NewUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids = append(ids, missing)
+
+	owned, notOwned, err := db.CheckOwnerMany(ids, owner)
+	if err != nil {
+		t.Fatal("db.CheckOwnerMany():", err)
+	}
+	if len(owned) != 1 || owned[0] != ids[0] {
+		t.Errorf("owned: expected [%v], got %v", ids[0], owned)
+	}
+	if len(notOwned) != 2 || notOwned[0] != ids[1] || notOwned[1] != missing {
+		t.Errorf("not owned: expected %v, got %v", ids[1:], notOwned)
+	}
+}
+
+func TestCheckOwnerManyNilID(t *testing.T) {
+	db := &DB{}
+	if _, _, err := db.CheckOwnerMany([]uuid.UUID{owner, {}}, owner); Cause(err) != ErrInvalidID {
+		t.Errorf("expected %v, got %v", ErrInvalidID, err)
+	}
+}
+
+// TestCloneConflict tests that cloning onto an existing id fails unless the options allow picking another id.
+func TestCloneConflict(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	db, err := NewPoolServiceFromEnv()
+	if err != nil {
+		t.Fatal("psql:", err)
+	}
+
+	var ids []uuid.UUID
+	for i := 0; i < 2; i++ {
+		dataset, err := models.NewDataset(owner)
+		if err != nil {
+			t.Fatal("models.NewDataset():", err)
+		}
+		dataset.SetData(1, "open test dataset", []byte(`{"title":"clone test"}`))
+
+		if err = db.Create(dataset); err != nil {
+			t.Fatal("db.Create():", err)
+		}
+		defer db.Delete(dataset.Id, nil)
+		ids = append(ids, dataset.Id)
+	}
+
+	if err = db.Clone(ids[0], ids[1], []byte(`{}`)); Cause(err) != ErrAlreadyExists {
+		t.Errorf("Clone: expected %v, got %v", ErrAlreadyExists, err)
+	}
+
+	if _, err = db.CloneWithOptions(ids[0], ids[1], []byte(`{}`), CloneOptions{}); Cause(err) != ErrAlreadyExists {
+		t.Errorf("CloneWithOptions: expected %v, got %v", ErrAlreadyExists, err)
+	}
+
+	used, err := db.CloneWithOptions(ids[0], ids[1], []byte(`{}`), CloneOptions{RegenerateOnConflict: true})
+	if err != nil {
+		t.Fatal("CloneWithOptions with regeneration:", err)
+	}
+	defer db.Delete(used, nil)
+
+	if used == ids[0] || used == ids[1] {
+		t.Errorf("expected a new id, got %v", used)
+	}
+	if _, err = db.Get(used); err != nil {
+		t.Errorf("clone not found under returned id: %v", err)
+	}
+}
+
+// TestGetIfChanged tests that a dataset is only returned if its seq differs from the known one.
+func TestGetIfChanged(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	db, err := NewPoolServiceFromEnv()
+	if err != nil {
+		t.Fatal("psql:", err)
+	}
+
+	dataset, err := models.NewDataset(owner)
+	if err != nil {
+		t.Fatal("models.NewDataset():", err)
+	}
+	dataset.SetData(1, "open test dataset", []byte(`{"title":"etag test"}`))
+
+	if err = db.Create(dataset); err != nil {
+		t.Fatal("db.Create():", err)
+	}
+	defer db.Delete(dataset.Id, nil)
+
+	stored, err := db.Get(dataset.Id)
+	if err != nil {
+		t.Fatal("db.Get():", err)
+	}
+
+	if res, err := db.GetIfChanged(dataset.Id, stored.Seq); res != nil || !errors.Is(err, ErrNotModified) {
+		t.Errorf("unchanged: expected (nil, %v), got (%v, %v)", ErrNotModified, res, err)
+	}
+
+	if err = db.Update(dataset.Id, []byte(`{"title":"changed"}`)); err != nil {
+		t.Fatal("db.Update():", err)
+	}
+
+	res, err := db.GetIfChanged(dataset.Id, stored.Seq)
+	if err != nil {
+		t.Fatal("changed:", err)
+	}
+	if string(res.Blob()) != `{"title": "changed"}` || res.Seq == stored.Seq {
+		t.Errorf("changed: expected new blob and seq, got %s (seq %d)", res.Blob(), res.Seq)
+	}
+}
+
+func TestCheckFamilySchema(t *testing.T) {
+	if err := models.SetFamilySchemas(1, "open test dataset"); err != nil {
+		t.Fatal(err)
+	}
+	defer models.SetFamilySchemas(1)
+
+	if err := checkFamilySchema(1, "open test dataset"); err != nil {
+		t.Errorf("allowed schema: expected no error, got %v", err)
+	}
+	if err := checkFamilySchema(1, "metax-ida"); err != ErrSchemaFamilyMismatch {
+		t.Errorf("other schema: expected %v, got %v", ErrSchemaFamilyMismatch, err)
+	}
+	if err := checkFamilySchema(0, "anything"); err != nil {
+		t.Errorf("unrestricted family: expected no error, got %v", err)
+	}
+	if err := checkFamilySchema(99, "anything"); err != ErrUnknownFamily {
+		t.Errorf("unknown family: expected %v, got %v", ErrUnknownFamily, err)
+	}
+}
+
+// TestCreateCreatorOwnerMismatch tests that a dataset owned by someone other than its creator is refused unless allowed.
+func TestCreateCreatorOwnerMismatch(t *testing.T) {
+	dataset, err := models.NewDataset(owner)
+	if err != nil {
+		t.Fatal("models.NewDataset():", err)
+	}
+	dataset.Owner = uuid.MustFromString("8b5f4b2d3a6c4e0f9d1e2c3b4a596877")
+	if err = dataset.SetData(1, "open test dataset", []byte(`{}`)); err != nil {
+		t.Fatal("SetData():", err)
+	}
+
+	tx := &Tx{}
+	if err := tx.Create(dataset); err != ErrCreatorOwnerMismatch {
+		t.Errorf("create: expected %v, got %v", ErrCreatorOwnerMismatch, err)
+	}
+	if err := tx.createWithMetadata(dataset); err != ErrCreatorOwnerMismatch {
+		t.Errorf("createWithMetadata: expected %v, got %v", ErrCreatorOwnerMismatch, err)
+	}
+
+	tx.AllowCrossUserCreate()
+	if err := tx.checkCreator(dataset); err != nil {
+		t.Errorf("allowed: expected no error, got %v", err)
+	}
+}
+
+// TestUpdatePreserving tests that protected paths keep their stored values while other keys are merged.
+func TestUpdatePreserving(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	db, err := NewPoolServiceFromEnv()
+	if err != nil {
+		t.Fatal("psql:", err)
+	}
+
+	dataset, err := models.NewDataset(owner)
+	if err != nil {
+		t.Fatal("models.NewDataset():", err)
+	}
+	dataset.SetData(1, "open test dataset", []byte(`{"title":"old","identifier":"urn:1","keywords":["a"]}`))
+
+	if err = db.Create(dataset); err != nil {
+		t.Fatal("db.Create():", err)
+	}
+	defer db.Delete(dataset.Id, nil)
+
+	saved, err := db.UpdatePreserving(dataset.Id, []byte(`{"title":"new","identifier":"urn:2"}`), owner, [][]string{{"identifier"}})
+	if err != nil {
+		t.Fatal("db.UpdatePreserving():", err)
+	}
+
+	var blob struct {
+		Title      string   `json:"title"`
+		Identifier string   `json:"identifier"`
+		Keywords   []string `json:"keywords"`
+	}
+	if err = json.Unmarshal(saved, &blob); err != nil {
+		t.Fatal("json:", err)
+	}
+	if blob.Title != "new" || blob.Identifier != "urn:1" || len(blob.Keywords) != 1 {
+		t.Errorf("unexpected saved blob: %s", saved)
+	}
+}
+
+// TestTimeOrNull tests that zero timestamps from the model are written as NULL and read back as zero.
+func TestTimeOrNull(t *testing.T) {
+	if arg := timeOrNull(time.Time{}); arg != nil {
+		t.Errorf("zero time: expected NULL, got %v", arg)
+	}
+
+	now := time.Now()
+	if arg := timeOrNull(now); arg != now {
+		t.Errorf("expected %v, got %v", now, arg)
+	}
+	if res := timeOrZero(nil); !res.IsZero() {
+		t.Errorf("NULL: expected zero time, got %v", res)
+	}
+}
+
+// TestUpsertNilID tests that Upsert refuses a nil id before touching the database, like Create.
+func TestUpsertNilID(t *testing.T) {
+	dataset := &models.Dataset{Creator: owner, Owner: owner}
+	if _, err := (&Tx{}).Upsert(dataset); err != ErrInvalidID {
+		t.Errorf("expected %v, got %v", ErrInvalidID, err)
+	}
+}
@@ -0,0 +1,79 @@
+package psql
+
+import (
+	"context"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/wvh/uuid"
+)
+
+// draftLockSpace is the first key of the advisory locks serialising draft lookups per owner.
+const draftLockSpace = 0x6472
+
+// emptyDraft is the blob of a new draft if no template is given.
+var emptyDraft = []byte("{}")
+
+// GetOrCreateDraft returns an unused draft of the given family owned by the user, creating one if there is none.
+// A draft is unused if it is unpublished and its blob is still `{}` or equal to the template; a new draft starts out with the template,
+// or `{}` if the template is nil. The boolean return value is true if a new draft was created.
+func (db *DB) GetOrCreateDraft(uid uuid.UUID, family models.Family, schema string, template []byte) (*models.Dataset, bool, error) {
+	return db.GetOrCreateDraftContext(context.Background(), uid, family, schema, template)
+}
+
+// GetOrCreateDraftContext returns or creates an unused draft within the given context.
+// The lookup and insert happen in one transaction holding a lock on the user, so concurrent calls don't create duplicate drafts.
+func (db *DB) GetOrCreateDraftContext(ctx context.Context, uid uuid.UUID, family models.Family, schema string, template []byte) (*models.Dataset, bool, error) {
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return nil, false, wrapError("get or create draft", uuid.UUID{}, err)
+	}
+	defer tx.Rollback()
+
+	dataset, created, err := tx.getOrCreateDraft(uid, family, schema, template)
+	if err != nil {
+		return nil, false, wrapError("get or create draft", uuid.UUID{}, handleContextError(ctx, err))
+	}
+
+	return dataset, created, wrapError("get or create draft", dataset.Id, tx.Commit())
+}
+
+// getOrCreateDraft looks for an unused draft and creates one if none is found.
+func (tx *Tx) getOrCreateDraft(uid uuid.UUID, family models.Family, schema string, template []byte) (*models.Dataset, bool, error) {
+	_, err := tx.Exec("SELECT pg_advisory_xact_lock($1, hashtext($2::uuid::text))", draftLockSpace, uid.Array())
+	if err != nil {
+		return nil, false, err
+	}
+
+	var id uuid.UUID
+	err = tx.QueryRow(`
+		SELECT id FROM datasets
+		WHERE owner = $1 AND family = $2 AND NOT published AND deleted IS NULL AND (blob = '{}' OR blob = $3::jsonb)
+		ORDER BY created DESC LIMIT 1`,
+		uid.Array(), int(family), template,
+	).Scan(id.Array())
+	switch err = handleError(err); err {
+	case nil:
+		dataset, err := tx.get(id, "")
+		return dataset, false, err
+	case ErrNotFound:
+	default:
+		return nil, false, err
+	}
+
+	if template == nil {
+		template = emptyDraft
+	}
+
+	dataset, err := models.NewDataset(uid)
+	if err != nil {
+		return nil, false, err
+	}
+	if err = dataset.SetData(family, schema, template); err != nil {
+		return nil, false, err
+	}
+
+	if err = tx.Create(dataset); err != nil {
+		return nil, false, err
+	}
+	return dataset, true, nil
+}
@@ -1,10 +1,15 @@
 package psql
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
 	"net"
+	"os"
+	"syscall"
 
 	"github.com/jackc/pgx"
+	"github.com/wvh/uuid"
 )
 
 // New returns an error that formats as the given text.
@@ -22,13 +27,158 @@ func (e *DatabaseError) Error() string {
 	return e.s
 }
 
+// BatchError is returned when a batch operation fails; it records the index of the item that caused the failure.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+// Error satisfies Go's Error interface.
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch store failed at index %d: %s", e.Index, e.Err)
+}
+
+// Unwrap returns the error of the failed item.
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// ConstraintError is returned when a statement violates a unique constraint; Constraint holds the name of the violated constraint,
+// so a collision on the primary key (`datasets_pkey`) can be told apart from one on another unique index.
+type ConstraintError struct {
+	Constraint string
+	Err        error
+}
+
+// Error satisfies Go's Error interface.
+func (e *ConstraintError) Error() string {
+	if e.Constraint == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s (constraint %s)", e.Err, e.Constraint)
+}
+
+// Unwrap returns the underlying error.
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// DeadlockError is returned when a transaction was aborted to resolve a deadlock; Detail holds the server's description
+// of the processes and locks involved, and Where the statement context if any. Its cause is ErrDeadlock, so it can be retried.
+type DeadlockError struct {
+	Detail string
+	Where  string
+	Err    error
+}
+
+// Error satisfies Go's Error interface.
+func (e *DeadlockError) Error() string {
+	if e.Detail == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + ": " + e.Detail
+}
+
+// Unwrap returns the underlying error.
+func (e *DeadlockError) Unwrap() error {
+	return e.Err
+}
+
+// OpError annotates an error with the database operation and the dataset it was called for.
+// Use Cause to get the underlying error for comparison with the errors defined in this package.
+type OpError struct {
+	Op  string
+	Id  uuid.UUID
+	Err error
+}
+
+// Error satisfies Go's Error interface.
+func (e *OpError) Error() string {
+	if e.Id == (uuid.UUID{}) {
+		return e.Op + ": " + e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %s for id %s", e.Op, e.Err, e.Id)
+}
+
+// Unwrap returns the underlying error.
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// checkID returns ErrInvalidID for the nil UUID, which never identifies a valid dataset.
+func checkID(id uuid.UUID) error {
+	if id == (uuid.UUID{}) {
+		return ErrInvalidID
+	}
+	return nil
+}
+
+// wrapError annotates an error with the operation and dataset id; it returns nil if err is nil.
+func wrapError(op string, id uuid.UUID, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &OpError{Op: op, Id: id, Err: err}
+}
+
+// Cause returns the underlying error of an error returned by the database layer, stripping operation, batch and constraint annotations.
+// The result can be compared directly with the errors defined in this package:
+//
+//	if psql.Cause(err) == psql.ErrNotFound {
+//		...
+//	}
+func Cause(err error) error {
+	for {
+		switch e := err.(type) {
+		case *OpError:
+			err = e.Err
+		case *BatchError:
+			err = e.Err
+		case *ConstraintError:
+			err = e.Err
+		case *DeadlockError:
+			err = e.Err
+		default:
+			return err
+		}
+	}
+}
+
 // Errors exported by the database layer.
 var (
-	ErrExists         = NewError("exists")
-	ErrNotFound       = NewError("not found")
-	ErrNotOwner       = NewError("not owner")
-	ErrInvalidJson    = NewError("invalid json")
-	ErrNotImplemented = NewError("not implemented")
+	ErrExists            = NewError("exists")
+	ErrAlreadyExists     = NewError("already exists")
+	ErrNotFound          = NewError("not found")
+	ErrNotOwner          = NewError("not owner")
+	ErrInvalidJson       = NewError("invalid json")
+	ErrNotImplemented    = NewError("not implemented")
+	ErrConflict          = NewError("conflict")
+	ErrQuotaExceeded     = NewError("quota exceeded")
+	ErrLocked            = NewError("locked")
+	ErrInvalidTag        = NewError("invalid tag")
+	ErrInvalidPermission = NewError("invalid permission")
+	ErrBlobTooLarge      = NewError("blob too large")
+	ErrInvalidID         = NewError("invalid id")
+	ErrInvalidKey        = NewError("invalid key")
+	ErrNotConfirmed      = NewError("not confirmed")
+	ErrInvalidOrder      = NewError("invalid order")
+	ErrNotModified       = NewError("not modified")
+	ErrArchived          = NewError("archived")
+	ErrUnknownUser       = NewError("unknown user")
+	ErrInvalidSlug       = NewError("invalid slug")
+	ErrSlugTaken         = NewError("slug taken")
+	ErrUnknownFamily     = NewError("unknown dataset family")
+	ErrCompressed        = NewError("compressed")
+	ErrSameUser          = NewError("same user")
+
+	ErrSchemaFamilyMismatch = NewError("schema not allowed for family")
+	ErrCreatorOwnerMismatch = NewError("creator and owner differ")
+)
+
+// Errors from concurrent transactions; these can be retried.
+var (
+	ErrSerializationFailure = NewError("serialization failure")
+	ErrDeadlock             = NewError("deadlock detected")
 )
 
 // Errors from the underlying database connection.
@@ -36,23 +186,32 @@ var (
 	ErrTemporary  = NewError("temporary database error")
 	ErrTimeout    = NewError("database timeout")
 	ErrConnection = NewError("database connection error")
+	ErrClosed     = NewError("database closed")
+
+	// ErrUnavailable means the connection to the database was refused or lost, for instance because the server restarted.
+	ErrUnavailable = NewError("database unavailable")
 )
 
 // handleError catches some psql errors the application should know about and converts them to one of those defined above.
+// It is the only place pgx.ErrNoRows is translated to ErrNotFound, so code reading single rows must pass driver errors through it
+// – directly or via handleContextError – instead of comparing them itself.
+// Postgres errors without a translation are returned as is and logged when the operation is observed; see DB.observe.
 func handleError(err error) error {
 	// heh... shortcut this
 	if err == nil {
 		return nil
 	}
 
-	// TODO: remove this
-	log.Printf("[DEBUG] error: %s (%#v; %T)\n", err, err, err)
-
 	// no rows
 	if err == pgx.ErrNoRows {
 		return ErrNotFound
 	}
 
+	// pool closed by Close
+	if err == pgx.ErrClosedPool {
+		return ErrClosed
+	}
+
 	// pgx/postgres error
 	if pgerr, ok := err.(pgx.PgError); ok {
 		switch pgerr.Code {
@@ -61,12 +220,30 @@ func handleError(err error) error {
 		case "23503":
 			return ErrExists
 		case "23505":
-			return ErrExists
+			return &ConstraintError{Constraint: pgerr.ConstraintName, Err: ErrAlreadyExists}
+		case "40001":
+			return ErrSerializationFailure
+		case "40P01":
+			return &DeadlockError{Detail: pgerr.Detail, Where: pgerr.Where, Err: ErrDeadlock}
+		case "QV001":
+			// raised by the datasets_restore trigger
+			return ErrArchived
+		case "QV002":
+			// raised by the datasets_decompress trigger
+			return ErrCompressed
+		case "57014":
+			// query_canceled, for instance by statement_timeout
+			return ErrTimeout
 		}
 
 		return pgerr
 	}
 
+	// connection refused or lost mid-query
+	if isUnavailable(err) {
+		return ErrUnavailable
+	}
+
 	// net connection error
 	if neterr, ok := err.(*net.OpError); ok {
 		if neterr.Temporary() {
@@ -82,6 +259,45 @@ func handleError(err error) error {
 	return err
 }
 
+// isUnavailable checks if a driver error means the database server can't be reached or dropped the connection.
+func isUnavailable(err error) bool {
+	switch err {
+	case pgx.ErrDeadConn, io.EOF, io.ErrUnexpectedEOF:
+		// the server closed the connection while pgx was reading from it
+		return true
+	}
+
+	neterr, ok := err.(*net.OpError)
+	if !ok {
+		return false
+	}
+
+	err = neterr.Err
+	if syserr, ok := err.(*os.SyscallError); ok {
+		err = syserr.Err
+	}
+
+	switch err {
+	case syscall.ECONNREFUSED, syscall.ECONNRESET, syscall.EPIPE:
+		return true
+	}
+	return false
+}
+
+// handleContextError returns the context's error if the context is done, otherwise it passes err on to handleError.
+// This makes sure a cancelled or timed out call reports why it was aborted rather than a generic driver error.
+func handleContextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	return handleError(err)
+}
+
 /*
 	Errors good to catch are:
 
@@ -0,0 +1,156 @@
+package psql
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/jackc/pgx"
+	"github.com/wvh/uuid"
+)
+
+func TestHandleContextError(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		err      error
+		expected error
+	}{
+		{name: "nil error", ctx: cancelled, err: nil, expected: nil},
+		{name: "cancelled", ctx: cancelled, err: errors.New("driver error"), expected: context.Canceled},
+		{name: "no rows", ctx: context.Background(), err: pgx.ErrNoRows, expected: ErrNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := handleContextError(test.ctx, test.err); err != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestWrapError(t *testing.T) {
+	id := uuid.MustFromString("053bffbcc41edad4853bea91fc42ea18")
+
+	if err := wrapError("update", id, nil); err != nil {
+		t.Errorf("expected nil for nil error, got %v", err)
+	}
+
+	err := wrapError("update", id, ErrNotFound)
+	if Cause(err) != ErrNotFound {
+		t.Errorf("expected cause %v, got %v", ErrNotFound, Cause(err))
+	}
+	if expected := "update: not found for id " + id.String(); err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+
+	err = wrapError("batch store", uuid.UUID{}, &BatchError{Index: 1, Err: ErrDeadlock})
+	if Cause(err) != ErrDeadlock {
+		t.Errorf("expected cause %v, got %v", ErrDeadlock, Cause(err))
+	}
+}
+
+func TestNotFoundIs(t *testing.T) {
+	id := uuid.MustFromString("053bffbcc41edad4853bea91fc42ea18")
+
+	// both Get and GetWithOwner wrap the converted driver error like this
+	err := wrapError("get", id, handleContextError(context.Background(), pgx.ErrNoRows))
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected errors.Is(err, ErrNotFound) for %v", err)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("driver error leaked through: %v", err)
+	}
+}
+
+func TestNilID(t *testing.T) {
+	if err := checkID(uuid.MustFromString("053bffbcc41edad4853bea91fc42ea18")); err != nil {
+		t.Errorf("expected nil for valid id, got %v", err)
+	}
+
+	// the guard runs before the database is touched, so an unconnected handle will do
+	db := &DB{}
+	if _, err := db.Get(uuid.UUID{}); Cause(err) != ErrInvalidID {
+		t.Errorf("get: expected %v, got %v", ErrInvalidID, err)
+	}
+	if err := db.Update(uuid.UUID{}, []byte(`{}`)); Cause(err) != ErrInvalidID {
+		t.Errorf("update: expected %v, got %v", ErrInvalidID, err)
+	}
+	if err := db.Delete(uuid.UUID{}, nil); Cause(err) != ErrInvalidID {
+		t.Errorf("delete: expected %v, got %v", ErrInvalidID, err)
+	}
+	if _, err := db.PublishHistory(uuid.UUID{}); Cause(err) != ErrInvalidID {
+		t.Errorf("publish history: expected %v, got %v", ErrInvalidID, err)
+	}
+	if _, err := db.ReassignAll(uuid.UUID{}, owner); Cause(err) != ErrInvalidID {
+		t.Errorf("reassign: expected %v, got %v", ErrInvalidID, err)
+	}
+	if _, err := db.ReassignAll(owner, owner); Cause(err) != ErrSameUser {
+		t.Errorf("reassign to self: expected %v, got %v", ErrSameUser, err)
+	}
+	if _, err := db.DeleteAllForUid(uuid.UUID{}, ConfirmDeleteAll); Cause(err) != ErrInvalidID {
+		t.Errorf("delete all: expected %v, got %v", ErrInvalidID, err)
+	}
+}
+
+func TestHandleErrorUnavailable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{name: "dead conn", err: pgx.ErrDeadConn, expected: ErrUnavailable},
+		{name: "unexpected eof", err: io.ErrUnexpectedEOF, expected: ErrUnavailable},
+		{name: "refused", err: &net.OpError{Op: "dial", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}, expected: ErrUnavailable},
+		{name: "broken pipe", err: &net.OpError{Op: "write", Err: syscall.EPIPE}, expected: ErrUnavailable},
+		{name: "other net error", err: &net.OpError{Op: "read", Err: errors.New("boom")}, expected: ErrConnection},
+		{name: "logic error", err: pgx.PgError{Code: "23505"}, expected: ErrAlreadyExists},
+		{name: "archived", err: pgx.PgError{Code: "QV001"}, expected: ErrArchived},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := Cause(handleError(test.err)); err != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	id := uuid.MustFromString("053bffbcc41edad4853bea91fc42ea18")
+
+	for _, err := range []error{ErrSerializationFailure, ErrDeadlock, ErrUnavailable, ErrTemporary, wrapError("get", id, ErrUnavailable)} {
+		if !IsRetryable(err) {
+			t.Errorf("expected %v to be retryable", err)
+		}
+	}
+	for _, err := range []error{nil, ErrNotFound, ErrConnection, ErrClosed, errors.New("boom")} {
+		if IsRetryable(err) {
+			t.Errorf("expected %v not to be retryable", err)
+		}
+	}
+}
+
+func TestHandleErrorDeadlock(t *testing.T) {
+	pgerr := pgx.PgError{Code: "40P01", Detail: "Process 1 waits for ShareLock on transaction 2; blocked by process 3."}
+
+	err := wrapError("batch store", uuid.UUID{}, handleError(pgerr))
+	if Cause(err) != ErrDeadlock {
+		t.Fatalf("expected cause %v, got %v", ErrDeadlock, Cause(err))
+	}
+	if !IsRetryable(err) {
+		t.Errorf("expected deadlock to be retryable")
+	}
+	if expected := "batch store: deadlock detected: " + pgerr.Detail; err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+}
@@ -0,0 +1,186 @@
+package psql
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/jackc/pgx"
+	"github.com/wvh/uuid"
+)
+
+// ExportRecord is the serialised form of a dataset used for exports and imports, one per line in NDJSON streams.
+//
+// example:
+//
+//	enc := json.NewEncoder(w)
+//	err := db.EachDataset(ctx, func(dataset *models.Dataset) error {
+//		return enc.Encode(psql.NewExportRecord(dataset))
+//	})
+type ExportRecord struct {
+	Id         uuid.UUID       `json:"id"`
+	Creator    uuid.UUID       `json:"creator"`
+	Owner      uuid.UUID       `json:"owner"`
+	Created    time.Time       `json:"created"`
+	Modified   time.Time       `json:"modified"`
+	Synced     *time.Time      `json:"synced,omitempty"`
+	Seq        int64           `json:"seq"`
+	Published  bool            `json:"published"`
+	State      string          `json:"state,omitempty"`
+	MetaxId    string          `json:"metax_id,omitempty"`
+	ModifiedBy *uuid.UUID      `json:"modified_by,omitempty"`
+	Valid      bool            `json:"valid"`
+	Family     models.Family   `json:"family"`
+	Schema     string          `json:"schema"`
+	Blob       json.RawMessage `json:"blob"`
+}
+
+// NewExportRecord converts a dataset to its export form.
+func NewExportRecord(dataset *models.Dataset) *ExportRecord {
+	rec := &ExportRecord{
+		Id:        dataset.Id,
+		Creator:   dataset.Creator,
+		Owner:     dataset.Owner,
+		Created:   dataset.Created,
+		Modified:  dataset.Modified,
+		Seq:       dataset.Seq,
+		Published: dataset.Published,
+		State:     string(dataset.State),
+		MetaxId:   dataset.MetaxId,
+		Valid:     dataset.IsValid(),
+		Family:    dataset.Family(),
+		Schema:    dataset.Schema(),
+		Blob:      dataset.Blob(),
+	}
+	if !dataset.Synced.IsZero() {
+		synced := dataset.Synced
+		rec.Synced = &synced
+	}
+	if dataset.ModifiedBy != (uuid.UUID{}) {
+		by := dataset.ModifiedBy
+		rec.ModifiedBy = &by
+	}
+	if len(rec.Blob) == 0 {
+		rec.Blob = json.RawMessage("null")
+	}
+	return rec
+}
+
+// exportFetchSize is the number of rows fetched from the server-side cursor at a time.
+const exportFetchSize = 100
+
+// EachDataset calls fn for every dataset in the database, in constant memory, using a server-side cursor.
+// It stops at the first error returned by fn, or when the context is cancelled, and returns that error.
+// Soft-deleted datasets are skipped. It reads from the replica if one is configured; see WithReadConsistency.
+func (db *DB) EachDataset(ctx context.Context, fn func(*models.Dataset) error) error {
+	tx, err := db.beginRead(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DECLARE export NO SCROLL CURSOR FOR
+		SELECT id, creator, owner, created, modified, synced, seq, published, state, metax_id, modified_by, valid, family, schema, dataset_data(id, blob, blob_gz)
+		FROM datasets
+		WHERE deleted IS NULL
+		ORDER BY id`)
+	if err != nil {
+		return handleContextError(ctx, err)
+	}
+
+	for {
+		batch, err := tx.fetchDatasets("FETCH " + strconv.Itoa(exportFetchSize) + " FROM export")
+		if err != nil {
+			return handleContextError(ctx, err)
+		}
+
+		for _, dataset := range batch {
+			if err = fn(dataset); err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < exportFetchSize {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// fetchDatasets runs a query returning full dataset rows as selected by EachDataset.
+func (tx *Tx) fetchDatasets(sql string, args ...interface{}) ([]*models.Dataset, error) {
+	rows, err := tx.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*models.Dataset
+	for rows.Next() {
+		dataset, err := scanDataset(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, dataset)
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return list, nil
+}
+
+// scanDataset scans a full dataset row as selected by EachDataset; extra destinations are scanned from columns preceding the dataset columns.
+func scanDataset(rows *pgx.Rows, extra ...interface{}) (*models.Dataset, error) {
+	var (
+		created, modified, synced *time.Time
+
+		published *bool
+		state     *string
+		metaxId   *string
+		by        *[16]byte
+		valid     *bool
+		family    int
+		schema    string
+		blob      []byte
+	)
+
+	dataset := new(models.Dataset)
+	dest := append(extra, dataset.Id.Array(), dataset.Creator.Array(), dataset.Owner.Array(), &created, &modified, &synced, &dataset.Seq, &published, &state, &metaxId, &by, &valid, &family, &schema, &blob)
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	blob, err := decompressBlob(blob)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dataset.SetData(models.Family(family), schema, blob); err != nil {
+		return nil, err
+	}
+
+	dataset.Created, dataset.Modified, dataset.Synced = timeOrZero(created), timeOrZero(modified), timeOrZero(synced)
+	if published != nil {
+		dataset.Published = *published
+	}
+	if state != nil {
+		dataset.State = models.PublishState(*state)
+	}
+	if metaxId != nil {
+		dataset.MetaxId = *metaxId
+	}
+	if by != nil {
+		dataset.ModifiedBy = *by
+	}
+	if valid != nil {
+		dataset.SetValid(*valid)
+	}
+	return dataset, nil
+}
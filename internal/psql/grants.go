@@ -0,0 +1,177 @@
+package psql
+
+import (
+	"context"
+	"time"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/wvh/uuid"
+)
+
+// Permission is the kind of access a grant gives to a dataset.
+type Permission string
+
+// Permissions that can be granted on a dataset; write access includes read access.
+const (
+	PermRead  Permission = "read"
+	PermWrite Permission = "write"
+)
+
+// Grant gives another user access to a dataset owned by the given user, replacing an existing grant for that user.
+func (db *DB) Grant(id uuid.UUID, owner uuid.UUID, grantee uuid.UUID, perm Permission) error {
+	return db.GrantContext(context.Background(), id, owner, grantee, perm)
+}
+
+// GrantContext gives another user access to a dataset within the given context.
+func (db *DB) GrantContext(ctx context.Context, id uuid.UUID, owner uuid.UUID, grantee uuid.UUID, perm Permission) error {
+	if err := checkID(id); err != nil {
+		return wrapError("grant", id, err)
+	}
+
+	if perm != PermRead && perm != PermWrite {
+		return wrapError("grant", id, ErrInvalidPermission)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("grant", id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return wrapError("grant", id, handleContextError(ctx, err))
+	}
+
+	err = tx.Grant(id, grantee, perm)
+	if err != nil {
+		return wrapError("grant", id, handleContextError(ctx, err))
+	}
+
+	return wrapError("grant", id, tx.Commit())
+}
+
+// Grant gives another user access to a dataset, replacing an existing grant for that user.
+// It doesn't check ownership; use CheckOwner first for user requests.
+func (tx *Tx) Grant(id uuid.UUID, grantee uuid.UUID, perm Permission) error {
+	if err := checkID(id); err != nil {
+		return err
+	}
+
+	if perm != PermRead && perm != PermWrite {
+		return ErrInvalidPermission
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO dataset_grants(dataset, grantee, permission) VALUES ($1, $2, $3)
+		ON CONFLICT (dataset, grantee) DO UPDATE SET permission = EXCLUDED.permission`,
+		id.Array(), grantee.Array(), string(perm))
+	return err
+}
+
+// Revoke removes another user's access to a dataset owned by the given user. Revoking a grant that doesn't exist is not an error.
+func (db *DB) Revoke(id uuid.UUID, owner uuid.UUID, grantee uuid.UUID) error {
+	return db.RevokeContext(context.Background(), id, owner, grantee)
+}
+
+// RevokeContext removes another user's access to a dataset within the given context.
+func (db *DB) RevokeContext(ctx context.Context, id uuid.UUID, owner uuid.UUID, grantee uuid.UUID) error {
+	if err := checkID(id); err != nil {
+		return wrapError("revoke", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("revoke", id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return wrapError("revoke", id, handleContextError(ctx, err))
+	}
+
+	_, err = tx.Exec("DELETE FROM dataset_grants WHERE dataset = $1 AND grantee = $2", id.Array(), grantee.Array())
+	if err != nil {
+		return wrapError("revoke", id, handleContextError(ctx, err))
+	}
+
+	return wrapError("revoke", id, tx.Commit())
+}
+
+// ListSharedWith returns the datasets other users have granted the given user access to.
+func (db *DB) ListSharedWith(uid uuid.UUID) ([]*models.Dataset, error) {
+	return db.ListSharedWithContext(context.Background(), uid)
+}
+
+// ListSharedWithContext returns the datasets shared with the given user within the given context.
+// Datasets are ordered by creation date with the newest first.
+func (db *DB) ListSharedWithContext(ctx context.Context, uid uuid.UUID) (_ []*models.Dataset, err error) {
+	defer db.observe("list", time.Now(), &err)
+
+	tx, err := db.beginRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	list, err := tx.listDatasets(`
+		SELECT d.id, d.creator, d.owner, d.created, d.family, d.schema, d.valid
+		FROM datasets d
+		JOIN dataset_grants g ON g.dataset = d.id
+		WHERE g.grantee = $1 AND d.deleted IS NULL
+		ORDER BY d.created DESC, d.id`,
+		uid.Array())
+	if err != nil {
+		return nil, handleContextError(ctx, err)
+	}
+
+	return list, nil
+}
+
+// CheckAccess checks if a user may access a dataset, either as its owner or through a grant; write access requires a write grant.
+// It returns ErrNotFound if the record doesn't exist and ErrNotOwner if the user has no sufficient access,
+// with the same SetHideNotFoundAsNotOwner behaviour as CheckOwner.
+func (tx *Tx) CheckAccess(id uuid.UUID, uid uuid.UUID, needWrite bool) error {
+	var allowed bool
+	err := tx.QueryRow(`
+		SELECT owner = $2 OR EXISTS (
+			SELECT 1 FROM dataset_grants
+			WHERE dataset = $1 AND grantee = $2 AND (permission = 'write' OR NOT $3)
+		)
+		FROM datasets WHERE id = $1`,
+		id.Array(), uid.Array(), needWrite).Scan(&allowed)
+	if err != nil {
+		err = handleError(err)
+		if err == ErrNotFound && tx.hideNotFound {
+			return ErrNotOwner
+		}
+		return err
+	}
+
+	if !allowed {
+		return ErrNotOwner
+	}
+
+	return nil
+}
+
+// CheckAccess calls tx.CheckAccess to check if a user may read – or write – a dataset.
+func (db *DB) CheckAccess(id uuid.UUID, uid uuid.UUID, needWrite bool) error {
+	return db.CheckAccessContext(context.Background(), id, uid, needWrite)
+}
+
+// CheckAccessContext checks if a user may access a dataset within the given context.
+func (db *DB) CheckAccessContext(ctx context.Context, id uuid.UUID, uid uuid.UUID, needWrite bool) error {
+	if err := checkID(id); err != nil {
+		return wrapError("check access", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("check access", id, err)
+	}
+	defer tx.Rollback()
+
+	return wrapError("check access", id, handleContextError(ctx, tx.CheckAccess(id, uid, needWrite)))
+}
@@ -0,0 +1,68 @@
+package psql
+
+import (
+	"context"
+	"time"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/wvh/uuid"
+)
+
+// IdempotencyKeyTTL is the time an idempotency key is remembered; a request repeated later creates a new dataset.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// StoreIdempotent creates a new dataset unless the owner already used the idempotency key, in which case nothing is stored.
+// It returns the id of the dataset created with that key, which is the given dataset's id on first use.
+func (db *DB) StoreIdempotent(dataset *models.Dataset, idempotencyKey string) (uuid.UUID, error) {
+	return db.StoreIdempotentContext(context.Background(), dataset, idempotencyKey)
+}
+
+// StoreIdempotentContext creates a new dataset at most once per owner and idempotency key within the given context.
+// The key is recorded in the same transaction as the dataset, so concurrent requests with the same key can't both insert.
+func (db *DB) StoreIdempotentContext(ctx context.Context, dataset *models.Dataset, idempotencyKey string) (uuid.UUID, error) {
+	var id uuid.UUID
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return id, wrapError("create", dataset.Id, err)
+	}
+	defer tx.Rollback()
+
+	// an expired key is taken over as if it were new
+	ct, err := tx.Exec(`
+		INSERT INTO idempotency_keys(owner, key, dataset) VALUES ($1, $2, $3)
+		ON CONFLICT (owner, key) DO UPDATE SET dataset = EXCLUDED.dataset, created = now()
+		WHERE idempotency_keys.created < now() - $4 * interval '1 second'`,
+		dataset.Owner.Array(), idempotencyKey, dataset.Id.Array(), int64(IdempotencyKeyTTL/time.Second))
+	if err != nil {
+		return id, wrapError("create", dataset.Id, handleContextError(ctx, err))
+	}
+
+	if ct.RowsAffected() != 1 {
+		err = tx.QueryRow("SELECT dataset FROM idempotency_keys WHERE owner = $1 AND key = $2", dataset.Owner.Array(), idempotencyKey).Scan(id.Array())
+		return id, wrapError("create", dataset.Id, handleContextError(ctx, err))
+	}
+
+	if err = tx.Create(dataset); err != nil {
+		return id, wrapError("create", dataset.Id, handleContextError(ctx, err))
+	}
+
+	if err = tx.Commit(); err != nil {
+		return id, wrapError("create", dataset.Id, err)
+	}
+	return dataset.Id, nil
+}
+
+// PurgeIdempotencyKeys deletes idempotency keys older than IdempotencyKeyTTL and returns the number of keys deleted.
+func (db *DB) PurgeIdempotencyKeys() (int64, error) {
+	return db.PurgeIdempotencyKeysContext(context.Background())
+}
+
+// PurgeIdempotencyKeysContext deletes expired idempotency keys within the given context.
+func (db *DB) PurgeIdempotencyKeysContext(ctx context.Context) (int64, error) {
+	ct, err := db.pool.ExecEx(ctx, "DELETE FROM idempotency_keys WHERE created < now() - $1 * interval '1 second'", nil, int64(IdempotencyKeyTTL/time.Second))
+	if err != nil {
+		return 0, handleContextError(ctx, err)
+	}
+	return ct.RowsAffected(), nil
+}
@@ -1,6 +1,7 @@
 package psql
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/wvh/uuid"
@@ -12,12 +13,17 @@ import (
 // Note that while external ids are not guaranteed to be unique and might refer to multiple application users,
 // this function allows only unique registrations as it creates real (login) users mapped to external accounts.
 func (db *DB) RegisterIdentity(svc, id string) (uid uuid.UUID, isNew bool, err error) {
+	return db.RegisterIdentityContext(context.Background(), svc, id)
+}
+
+// RegisterIdentityContext gets or creates the application uid for an external identity within the given context.
+func (db *DB) RegisterIdentityContext(ctx context.Context, svc, id string) (uid uuid.UUID, isNew bool, err error) {
 	var tx *Tx
 
-	tx, err = db.Begin()
+	tx, err = db.BeginContext(ctx)
 	if err != nil {
 		fmt.Println("ERROR:", err)
-		return uid, isNew, handleError(err)
+		return uid, isNew, err
 	}
 	defer tx.Rollback()
 
@@ -30,7 +36,7 @@ func (db *DB) RegisterIdentity(svc, id string) (uid uuid.UUID, isNew bool, err e
 
 	err = tx.QueryRow(`SELECT uid, is_new FROM register_identity($1, $2, $3)`, uid.Array(), svc, id).Scan(uid.Array(), &isNew)
 	if err != nil {
-		return uid, isNew, handleError(err)
+		return uid, isNew, handleContextError(ctx, err)
 	}
 
 	return uid, isNew, tx.Commit()
@@ -40,10 +46,15 @@ func (db *DB) RegisterIdentity(svc, id string) (uid uuid.UUID, isNew bool, err e
 //
 // Note that identities need not be unique, though those used for login ought to be.
 func (db *DB) GetUidForIdentity(svc, id string) (uid uuid.UUID, err error) {
+	return db.GetUidForIdentityContext(context.Background(), svc, id)
+}
+
+// GetUidForIdentityContext gets the application uid for a given external service and identity within the given context.
+func (db *DB) GetUidForIdentityContext(ctx context.Context, svc, id string) (uid uuid.UUID, err error) {
 	// typecast is necessary for Postgresql to know the data type of variadic arguments in prepared statements
-	err = db.pool.QueryRow(`SELECT uid FROM identities WHERE extids @> jsonb_build_object($1::text, $2::text)`, svc, id).Scan(uid.Array())
+	err = db.pool.QueryRowEx(ctx, `SELECT uid FROM identities WHERE extids @> jsonb_build_object($1::text, $2::text)`, nil, svc, id).Scan(uid.Array())
 	if err != nil {
-		return uid, handleError(err)
+		return uid, handleContextError(ctx, err)
 	}
 
 	return uid, nil
@@ -51,9 +62,14 @@ func (db *DB) GetUidForIdentity(svc, id string) (uid uuid.UUID, err error) {
 
 // GetIdentityForUid gets the identity for a given uid and service.
 func (db *DB) GetIdentityForUid(svc string, uid uuid.UUID) (id string, err error) {
-	err = db.pool.QueryRow(`SELECT extids->>$1 FROM identities WHERE uid = $2`, svc, uid.Array()).Scan(&id)
+	return db.GetIdentityForUidContext(context.Background(), svc, uid)
+}
+
+// GetIdentityForUidContext gets the identity for a given uid and service within the given context.
+func (db *DB) GetIdentityForUidContext(ctx context.Context, svc string, uid uuid.UUID) (id string, err error) {
+	err = db.pool.QueryRowEx(ctx, `SELECT extids->>$1 FROM identities WHERE uid = $2`, nil, svc, uid.Array()).Scan(&id)
 	if err != nil {
-		return "", err
+		return "", handleContextError(ctx, err)
 	}
 
 	return id, nil
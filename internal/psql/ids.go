@@ -0,0 +1,74 @@
+package psql
+
+import (
+	"context"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/wvh/uuid"
+)
+
+// IDGenerator creates ids for new datasets. Implementations must be safe for concurrent use.
+type IDGenerator interface {
+	NewID() (uuid.UUID, error)
+}
+
+// IDGeneratorFunc adapts a plain function to the IDGenerator interface.
+type IDGeneratorFunc func() (uuid.UUID, error)
+
+// NewID calls f.
+func (f IDGeneratorFunc) NewID() (uuid.UUID, error) {
+	return f()
+}
+
+// SetIDGenerator sets the generator used for dataset ids by CreateNew and CloneNew; if nil, uuid.NewUUID is used.
+// It is not safe to call this function after initialisation.
+func (psql *DB) SetIDGenerator(gen IDGenerator) {
+	psql.idgen = gen
+}
+
+// newID returns a new dataset id from the configured generator.
+func (db *DB) newID() (uuid.UUID, error) {
+	if db.idgen == nil {
+		return uuid.NewUUID()
+	}
+	return db.idgen.NewID()
+}
+
+// CreateNew assigns a newly generated id to the dataset and creates it, returning the id.
+// Any id already set on the dataset is replaced.
+func (db *DB) CreateNew(dataset *models.Dataset) (uuid.UUID, error) {
+	return db.CreateNewContext(context.Background(), dataset)
+}
+
+// CreateNewContext assigns a new id to the dataset and creates it within the given context.
+func (db *DB) CreateNewContext(ctx context.Context, dataset *models.Dataset) (uuid.UUID, error) {
+	id, err := db.newID()
+	if err != nil {
+		return uuid.UUID{}, wrapError("create", uuid.UUID{}, err)
+	}
+
+	dataset.Id = id
+	if err = db.CreateContext(ctx, dataset); err != nil {
+		return uuid.UUID{}, err
+	}
+	return id, nil
+}
+
+// CloneNew copies a dataset as a draft owned by the given user to a newly generated id, which it returns.
+// See CloneAsDraft.
+func (db *DB) CloneNew(srcID uuid.UUID, owner uuid.UUID, blob []byte) (uuid.UUID, error) {
+	return db.CloneNewContext(context.Background(), srcID, owner, blob)
+}
+
+// CloneNewContext copies a dataset as a draft to a newly generated id within the given context.
+func (db *DB) CloneNewContext(ctx context.Context, srcID uuid.UUID, owner uuid.UUID, blob []byte) (uuid.UUID, error) {
+	id, err := db.newID()
+	if err != nil {
+		return uuid.UUID{}, wrapError("clone", srcID, err)
+	}
+
+	if err = db.CloneAsDraftContext(ctx, srcID, id, owner, blob); err != nil {
+		return uuid.UUID{}, err
+	}
+	return id, nil
+}
@@ -0,0 +1,38 @@
+package psql
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/wvh/uuid"
+)
+
+func TestNewID(t *testing.T) {
+	fixed := uuid.MustFromString("22222222222222222222222222222222")
+
+	db := &DB{}
+	if id, err := db.newID(); err != nil || id == (uuid.UUID{}) {
+		t.Errorf("default generator: expected random id, got %v, %v", id, err)
+	}
+
+	db.SetIDGenerator(IDGeneratorFunc(func() (uuid.UUID, error) { return fixed, nil }))
+	if id, err := db.newID(); err != nil || id != fixed {
+		t.Errorf("injected generator: expected %v, got %v, %v", fixed, id, err)
+	}
+}
+
+// TestCreateNewGeneratorError tests that a failing generator is reported before touching the database.
+func TestCreateNewGeneratorError(t *testing.T) {
+	failed := errors.New("no ids left")
+
+	db := &DB{}
+	db.SetIDGenerator(IDGeneratorFunc(func() (uuid.UUID, error) { return uuid.UUID{}, failed }))
+
+	if _, err := db.CreateNew(&models.Dataset{}); Cause(err) != failed {
+		t.Errorf("CreateNew: expected %v, got %v", failed, err)
+	}
+	if _, err := db.CloneNew(owner, owner, []byte(`{}`)); Cause(err) != failed {
+		t.Errorf("CloneNew: expected %v, got %v", failed, err)
+	}
+}
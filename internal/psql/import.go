@@ -0,0 +1,222 @@
+package psql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/wvh/uuid"
+)
+
+// DefaultImportChunkSize is the number of datasets stored per transaction by ImportStream.
+const DefaultImportChunkSize = 500
+
+// ConflictPolicy decides what ImportStream does with a dataset whose id already exists.
+type ConflictPolicy int
+
+const (
+	// ConflictError stops the import with an error.
+	ConflictError ConflictPolicy = iota
+
+	// ConflictSkip keeps the existing dataset.
+	ConflictSkip
+
+	// ConflictReplace overwrites the existing dataset with the imported one.
+	ConflictReplace
+)
+
+// ImportOptions holds the settings for ImportStream.
+type ImportOptions struct {
+	OnConflict ConflictPolicy
+
+	// ChunkSize is the number of datasets per transaction; it defaults to DefaultImportChunkSize.
+	ChunkSize int
+}
+
+// ImportResult holds the number of records processed by ImportStream.
+type ImportResult struct {
+	Inserted int `json:"inserted"`
+	Replaced int `json:"replaced"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
+}
+
+// ImportStream reads newline-delimited ExportRecord JSON objects and stores them as datasets, in chunked transactions.
+//
+// Records that can't be decoded are counted as failed and skipped. Database errors – and id collisions with ConflictError –
+// stop the import with a *BatchError holding the zero-based record number; chunks stored before that stay committed
+// and are included in the returned counts.
+func (db *DB) ImportStream(ctx context.Context, r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultImportChunkSize
+	}
+
+	result := new(ImportResult)
+	reader := bufio.NewReader(r)
+
+	var (
+		chunk []*models.Dataset
+		first int
+		index int
+	)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return result, readErr
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			dataset, err := decodeExportRecord(line)
+			if err != nil {
+				result.Failed++
+				db.logger.Debug().Err(err).Int("record", index).Msg("skipping invalid import record")
+			} else {
+				if len(chunk) == 0 {
+					first = index
+				}
+				chunk = append(chunk, dataset)
+			}
+			index++
+		}
+
+		if len(chunk) >= opts.ChunkSize || (readErr == io.EOF && len(chunk) > 0) {
+			if err := db.importChunk(ctx, chunk, first, opts.OnConflict, result); err != nil {
+				return result, err
+			}
+			chunk = chunk[:0]
+		}
+
+		if readErr == io.EOF {
+			return result, nil
+		}
+	}
+}
+
+// decodeExportRecord parses one line of an import stream into a dataset.
+func decodeExportRecord(line []byte) (*models.Dataset, error) {
+	var rec ExportRecord
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return nil, err
+	}
+
+	dataset := &models.Dataset{
+		Id:        rec.Id,
+		Creator:   rec.Creator,
+		Owner:     rec.Owner,
+		Created:   rec.Created,
+		Modified:  rec.Modified,
+		Seq:       rec.Seq,
+		Published: rec.Published,
+		State:     models.PublishState(rec.State),
+		MetaxId:   rec.MetaxId,
+	}
+	if rec.Synced != nil {
+		dataset.Synced = *rec.Synced
+	}
+	if rec.ModifiedBy != nil {
+		dataset.ModifiedBy = *rec.ModifiedBy
+	}
+	if err := dataset.SetData(rec.Family, rec.Schema, rec.Blob); err != nil {
+		return nil, err
+	}
+	dataset.SetValid(rec.Valid)
+
+	return dataset, nil
+}
+
+// importChunk stores a chunk of datasets in one transaction and adds the outcome to result once committed.
+// The first argument is the record number of the first dataset, used for error reporting.
+func (db *DB) importChunk(ctx context.Context, chunk []*models.Dataset, first int, policy ConflictPolicy, result *ImportResult) error {
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var counts ImportResult
+	for i, dataset := range chunk {
+		inserted, stored, err := tx.importDataset(dataset, policy)
+		if err != nil {
+			return &BatchError{Index: first + i, Err: handleContextError(ctx, err)}
+		}
+
+		switch {
+		case !stored:
+			counts.Skipped++
+		case inserted:
+			counts.Inserted++
+		default:
+			counts.Replaced++
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	result.Inserted += counts.Inserted
+	result.Replaced += counts.Replaced
+	result.Skipped += counts.Skipped
+	return nil
+}
+
+// importDataset inserts a dataset with all its metadata, handling an existing id according to the conflict policy.
+// It reports whether a new row was inserted and whether anything was stored at all. Zero timestamps are stored like in createWithMetadata.
+func (tx *Tx) importDataset(dataset *models.Dataset, policy ConflictPolicy) (inserted bool, stored bool, err error) {
+	var conflict string
+	switch policy {
+	case ConflictSkip:
+		conflict = "ON CONFLICT (id) DO NOTHING"
+	case ConflictReplace:
+		conflict = `ON CONFLICT (id) DO UPDATE SET
+			creator = EXCLUDED.creator, owner = EXCLUDED.owner, created = EXCLUDED.created, modified = EXCLUDED.modified,
+			synced = EXCLUDED.synced, seq = EXCLUDED.seq, published = EXCLUDED.published, state = EXCLUDED.state,
+			metax_id = EXCLUDED.metax_id, modified_by = EXCLUDED.modified_by, valid = EXCLUDED.valid, family = EXCLUDED.family, schema = EXCLUDED.schema,
+			blob = EXCLUDED.blob, origin = EXCLUDED.origin, deleted = NULL`
+	}
+
+	var metaxId, modifiedBy interface{}
+	if dataset.ModifiedBy != (uuid.UUID{}) {
+		modifiedBy = dataset.ModifiedBy.Array()
+	}
+	if dataset.MetaxId != "" {
+		metaxId = dataset.MetaxId
+	}
+	state := string(dataset.State)
+	if state == "" {
+		state = string(models.StateDraft)
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO datasets(id, creator, owner, created, modified, synced, seq, published, state, metax_id, modified_by, valid, family, schema, blob, origin)
+		VALUES($1, $2, $3, coalesce($4, now()), coalesce($5, now()), $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, '`+string(OriginImport)+`') `+conflict+`
+		RETURNING (xmax = 0)`,
+		dataset.Id.Array(),
+		dataset.Creator.Array(),
+		dataset.Owner.Array(),
+		timeOrNull(dataset.Created),
+		timeOrNull(dataset.Modified),
+		timeOrNull(dataset.Synced),
+		dataset.Seq,
+		dataset.Published,
+		state,
+		metaxId,
+		modifiedBy,
+		dataset.IsValid(),
+		int(dataset.Family()),
+		dataset.Schema(),
+		dataset.Blob(),
+	).Scan(&inserted)
+	if err != nil {
+		// DO NOTHING returns no row for a skipped dataset
+		if err = handleError(err); err == ErrNotFound {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+
+	return inserted, true, nil
+}
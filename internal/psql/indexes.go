@@ -1,22 +1,38 @@
 package psql
 
 import (
+	"context"
+
 	"github.com/wvh/uuid"
 )
 
 func (db *DB) LookupByQvainId(id uuid.UUID) (bool, error) {
+	return db.LookupByQvainIdContext(context.Background(), id)
+}
+
+// LookupByQvainIdContext checks if a dataset with the given Qvain id exists, within the given context.
+func (db *DB) LookupByQvainIdContext(ctx context.Context, id uuid.UUID) (bool, error) {
+	if err := checkID(id); err != nil {
+		return false, err
+	}
+
 	var exists bool
-	err := db.pool.QueryRow(`SELECT true FROM datasets WHERE id = $1 LIMIT 1`, id.Array()).Scan(&exists)
-	return exists, handleError(err)
+	err := db.pool.QueryRowEx(ctx, `SELECT true FROM datasets WHERE id = $1 LIMIT 1`, nil, id.Array()).Scan(&exists)
+	return exists, handleContextError(ctx, err)
 }
 
 // LookupByFairdataIdentifier returns the Qvain id for a given Fairdata identifier.
 func (db *DB) LookupByFairdataIdentifier(fdid string) (uuid.UUID, error) {
+	return db.LookupByFairdataIdentifierContext(context.Background(), fdid)
+}
+
+// LookupByFairdataIdentifierContext returns the Qvain id for a given Fairdata identifier within the given context.
+func (db *DB) LookupByFairdataIdentifierContext(ctx context.Context, fdid string) (uuid.UUID, error) {
 	var id uuid.UUID
 	//err := db.pool.QueryRow(`SELECT id FROM datasets WHERE family = 2 AND blob @> '{"identifier": $1}'`, `"` + fdid + `"`).Scan(&id)
-	err := db.pool.QueryRow(`SELECT id FROM datasets WHERE family = 2 AND blob @> jsonb_build_object('identifier', $1::text)`, fdid).Scan(id.Array())
+	err := db.pool.QueryRowEx(ctx, `SELECT id FROM datasets WHERE family = 2 AND blob @> jsonb_build_object('identifier', $1::text)`, nil, fdid).Scan(id.Array())
 	if err != nil {
-		return id, handleError(err)
+		return id, handleContextError(ctx, err)
 	}
 
 	return id, nil
@@ -0,0 +1,51 @@
+package psql
+
+import (
+	"context"
+
+	"github.com/jackc/pgx"
+)
+
+// IsolationLevel is the isolation level of a transaction.
+type IsolationLevel int
+
+// Transaction isolation levels; LevelDefault uses the server's default, which is usually read committed.
+const (
+	LevelDefault IsolationLevel = iota
+	LevelReadCommitted
+	LevelRepeatableRead
+	LevelSerializable
+)
+
+// String returns the SQL name of the isolation level, or an empty string for LevelDefault.
+func (level IsolationLevel) String() string {
+	switch level {
+	case LevelReadCommitted:
+		return string(pgx.ReadCommitted)
+	case LevelRepeatableRead:
+		return string(pgx.RepeatableRead)
+	case LevelSerializable:
+		return string(pgx.Serializable)
+	}
+	return ""
+}
+
+// txOptions returns the transaction options for the isolation level, or nil for the default level.
+func (level IsolationLevel) txOptions() *pgx.TxOptions {
+	if level == LevelDefault {
+		return nil
+	}
+	return &pgx.TxOptions{IsoLevel: pgx.TxIsoLevel(level.String())}
+}
+
+// BeginWithLevel starts a transaction with the given isolation level, without deadline or cancellation.
+func (psql *DB) BeginWithLevel(level IsolationLevel) (*Tx, error) {
+	return psql.BeginWithLevelContext(context.Background(), level)
+}
+
+// BeginWithLevelContext starts a transaction with the given isolation level, bound to the given context.
+// Repeatable read and serializable transactions can fail with ErrSerializationFailure when they conflict
+// with concurrent transactions; callers should be prepared to run them again.
+func (psql *DB) BeginWithLevelContext(ctx context.Context, level IsolationLevel) (*Tx, error) {
+	return psql.begin(ctx, psql.pool, level.txOptions())
+}
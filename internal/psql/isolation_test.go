@@ -0,0 +1,33 @@
+package psql
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx"
+)
+
+func TestIsolationLevelTxOptions(t *testing.T) {
+	tests := []struct {
+		level    IsolationLevel
+		expected pgx.TxIsoLevel
+	}{
+		{level: LevelReadCommitted, expected: pgx.ReadCommitted},
+		{level: LevelRepeatableRead, expected: pgx.RepeatableRead},
+		{level: LevelSerializable, expected: pgx.Serializable},
+	}
+
+	if opts := LevelDefault.txOptions(); opts != nil {
+		t.Errorf("expected nil options for default level, got %+v", opts)
+	}
+
+	for _, test := range tests {
+		opts := test.level.txOptions()
+		if opts == nil {
+			t.Errorf("%v: expected options, got nil", test.expected)
+			continue
+		}
+		if opts.IsoLevel != test.expected {
+			t.Errorf("expected isolation level %q, got %q", test.expected, opts.IsoLevel)
+		}
+	}
+}
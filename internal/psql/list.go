@@ -0,0 +1,365 @@
+package psql
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/wvh/uuid"
+)
+
+// MaxPageSize is the maximum number of datasets returned by a single paged listing.
+const MaxPageSize = 1000
+
+// clampLimit caps a requested page size to MaxPageSize; a non-positive limit also returns the maximum.
+func clampLimit(limit int) int {
+	if limit <= 0 || limit > MaxPageSize {
+		return MaxPageSize
+	}
+	return limit
+}
+
+// ListForUidPaged returns a page of datasets for a given user along with the total number of datasets that user owns.
+func (db *DB) ListForUidPaged(uid uuid.UUID, limit, offset int) ([]*models.Dataset, int, error) {
+	return db.ListForUidPagedContext(context.Background(), uid, limit, offset)
+}
+
+// ListForUidPagedContext returns a page of datasets for a given user, ordered by creation date with the newest first.
+// The limit is capped to MaxPageSize.
+func (db *DB) ListForUidPagedContext(ctx context.Context, uid uuid.UUID, limit, offset int) (_ []*models.Dataset, _ int, err error) {
+	defer db.observe("list", time.Now(), &err)
+
+	limit = clampLimit(limit)
+	if offset < 0 {
+		offset = 0
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	var total int
+	err = tx.QueryRow("SELECT COUNT(*) FROM datasets WHERE owner = $1 AND deleted IS NULL", uid.Array()).Scan(&total)
+	if err != nil {
+		return nil, 0, handleContextError(ctx, err)
+	}
+
+	list, err := tx.listDatasets(`
+		SELECT id, creator, owner, created, family, schema, valid
+		FROM datasets
+		WHERE owner = $1 AND deleted IS NULL
+		ORDER BY created DESC, id
+		LIMIT $2 OFFSET $3`,
+		uid.Array(), limit, offset)
+	if err != nil {
+		return nil, 0, handleContextError(ctx, err)
+	}
+
+	return list, total, nil
+}
+
+// SortField is a field a dataset listing can be ordered by.
+type SortField string
+
+// Fields to order listings by.
+const (
+	SortModified SortField = "modified"
+	SortCreated  SortField = "created"
+	SortTitle    SortField = "title"
+)
+
+// OrderBy sets the order of a dataset listing. The zero value orders by modification date, newest first.
+//
+// Ordering by title uses the generated `title` column, see the `dataset_title` function in schema.sql;
+// datasets without a title sort last regardless of direction.
+type OrderBy struct {
+	Field     SortField
+	Ascending bool
+}
+
+// sql returns the ORDER BY expression; the id is added as tie-breaker so the order is deterministic.
+func (order OrderBy) sql() (string, error) {
+	var expr string
+	switch order.Field {
+	case SortModified, "":
+		expr = "modified"
+	case SortCreated:
+		expr = "created"
+	case SortTitle:
+		expr = "title"
+	default:
+		return "", ErrInvalidOrder
+	}
+
+	if order.Ascending {
+		return expr + " ASC NULLS LAST, id ASC", nil
+	}
+	return expr + " DESC NULLS LAST, id DESC", nil
+}
+
+// listDatasets runs a query returning the columns (id, creator, owner, created, family, schema, valid) and builds a list of datasets without blob.
+func (tx *Tx) listDatasets(sql string, args ...interface{}) ([]*models.Dataset, error) {
+	var list []*models.Dataset
+
+	rows, err := tx.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dataset models.Dataset
+		var (
+			created *time.Time
+			family  int
+			schema  string
+			valid   bool
+		)
+		err = rows.Scan(dataset.Id.Array(), dataset.Creator.Array(), dataset.Owner.Array(), &created, &family, &schema, &valid)
+		if err != nil {
+			return nil, err
+		}
+		if created != nil {
+			dataset.Created = *created
+		}
+		err = dataset.SetData(models.Family(family), schema, nil)
+		if err != nil {
+			return nil, err
+		}
+		dataset.SetValid(valid)
+		list = append(list, &dataset)
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return list, nil
+}
+
+// ListFilter restricts a dataset listing; nil fields are not filtered on.
+type ListFilter struct {
+	Family    *models.Family
+	Schema    *string
+	Published *bool
+	Valid     *bool
+
+	// ExcludeService leaves out datasets harvested from Metax, for a list of the user's own editable datasets.
+	ExcludeService bool
+}
+
+// where returns SQL conditions for the set fields, each prefixed with AND, and appends their values to args.
+func (filter *ListFilter) where(args []interface{}) (string, []interface{}) {
+	var sql string
+
+	add := func(cond string, value interface{}) {
+		args = append(args, value)
+		sql += " AND " + cond + " = $" + strconv.Itoa(len(args))
+	}
+
+	if filter.Family != nil {
+		add("family", int(*filter.Family))
+	}
+	if filter.Schema != nil {
+		add("schema", *filter.Schema)
+	}
+	if filter.Published != nil {
+		add("coalesce(published, false)", *filter.Published)
+	}
+	if filter.Valid != nil {
+		add("coalesce(valid, false)", *filter.Valid)
+	}
+	if filter.ExcludeService {
+		args = append(args, string(OriginService))
+		sql += " AND origin <> $" + strconv.Itoa(len(args))
+	}
+
+	return sql, args
+}
+
+// ListForUidFiltered returns the datasets for a given user that match the filter.
+func (db *DB) ListForUidFiltered(uid uuid.UUID, filter ListFilter) ([]*models.Dataset, error) {
+	return db.ListForUidFilteredContext(context.Background(), uid, filter)
+}
+
+// ListForUidFilteredContext returns the datasets for a given user that match the filter, within the given context.
+// Datasets are ordered by creation date with the newest first.
+func (db *DB) ListForUidFilteredContext(ctx context.Context, uid uuid.UUID, filter ListFilter) (_ []*models.Dataset, err error) {
+	defer db.observe("list", time.Now(), &err)
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	where, args := filter.where([]interface{}{uid.Array()})
+	list, err := tx.listDatasets(`
+		SELECT id, creator, owner, created, family, schema, valid
+		FROM datasets
+		WHERE owner = $1 AND deleted IS NULL`+where+`
+		ORDER BY created DESC, id`,
+		args...)
+	if err != nil {
+		return nil, handleContextError(ctx, err)
+	}
+
+	return list, nil
+}
+
+// ListCursor holds the sort keys of the last dataset on a page; pass them to ListForUidAfter to fetch the next page.
+type ListCursor struct {
+	Created time.Time
+	Id      uuid.UUID
+}
+
+// ListForUidAfter returns a page of datasets for a given user created before the given cursor position.
+func (db *DB) ListForUidAfter(uid uuid.UUID, afterCreated time.Time, afterId uuid.UUID, limit int) ([]*models.Dataset, *ListCursor, error) {
+	return db.ListForUidAfterContext(context.Background(), uid, afterCreated, afterId, limit)
+}
+
+// ListForUidAfterContext returns a page of datasets for a given user using keyset pagination on (created, id),
+// which – unlike OFFSET – doesn't skip or repeat rows when datasets are added or removed between requests.
+// A zero afterCreated time starts from the newest dataset. The returned cursor is nil if the page is empty.
+func (db *DB) ListForUidAfterContext(ctx context.Context, uid uuid.UUID, afterCreated time.Time, afterId uuid.UUID, limit int) (_ []*models.Dataset, _ *ListCursor, err error) {
+	defer db.observe("list", time.Now(), &err)
+
+	limit = clampLimit(limit)
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var list []*models.Dataset
+	if afterCreated.IsZero() {
+		list, err = tx.listDatasets(`
+			SELECT id, creator, owner, created, family, schema, valid
+			FROM datasets
+			WHERE owner = $1 AND deleted IS NULL
+			ORDER BY created DESC, id DESC
+			LIMIT $2`,
+			uid.Array(), limit)
+	} else {
+		list, err = tx.listDatasets(`
+			SELECT id, creator, owner, created, family, schema, valid
+			FROM datasets
+			WHERE owner = $1 AND deleted IS NULL AND (created, id) < ($2, $3)
+			ORDER BY created DESC, id DESC
+			LIMIT $4`,
+			uid.Array(), afterCreated, afterId.Array(), limit)
+	}
+	if err != nil {
+		return nil, nil, handleContextError(ctx, err)
+	}
+
+	if len(list) == 0 {
+		return list, nil, nil
+	}
+
+	last := list[len(list)-1]
+	return list, &ListCursor{Created: last.Created, Id: last.Id}, nil
+}
+
+// DatasetCounts holds the number of datasets a user owns, broken down by state.
+type DatasetCounts struct {
+	Total     int `json:"total"`
+	Published int `json:"published"`
+	Drafts    int `json:"drafts"`
+	Invalid   int `json:"invalid"`
+}
+
+// CountForUid returns the number of datasets for a given user.
+func (db *DB) CountForUid(uid uuid.UUID) (*DatasetCounts, error) {
+	return db.CountForUidContext(context.Background(), uid)
+}
+
+// CountForUidContext returns the number of datasets for a given user within the given context.
+// Soft-deleted datasets are not counted. It reads from the replica if one is configured; see WithReadConsistency.
+func (db *DB) CountForUidContext(ctx context.Context, uid uuid.UUID) (_ *DatasetCounts, err error) {
+	defer db.observe("list", time.Now(), &err)
+
+	counts := new(DatasetCounts)
+
+	err = db.readPool(ctx).QueryRowEx(ctx, `
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE published),
+			COUNT(*) FILTER (WHERE NOT coalesce(published, false)),
+			COUNT(*) FILTER (WHERE NOT coalesce(valid, false))
+		FROM datasets
+		WHERE owner = $1 AND deleted IS NULL`,
+		nil, uid.Array(),
+	).Scan(&counts.Total, &counts.Published, &counts.Drafts, &counts.Invalid)
+	if err != nil {
+		return nil, handleContextError(ctx, err)
+	}
+
+	return counts, nil
+}
+
+// DistinctFamiliesForUid returns the dataset families a given user has datasets in, for filtering their dataset list.
+func (db *DB) DistinctFamiliesForUid(uid uuid.UUID) ([]models.Family, error) {
+	return db.DistinctFamiliesForUidContext(context.Background(), uid)
+}
+
+// DistinctFamiliesForUidContext returns the dataset families in use by a given user within the given context.
+// Soft-deleted datasets are not included; families are ordered by id.
+func (db *DB) DistinctFamiliesForUidContext(ctx context.Context, uid uuid.UUID) (_ []models.Family, err error) {
+	defer db.observe("list", time.Now(), &err)
+
+	rows, err := db.readPool(ctx).QueryEx(ctx, "SELECT DISTINCT family FROM datasets WHERE owner = $1 AND deleted IS NULL ORDER BY family", nil, uid.Array())
+	if err != nil {
+		return nil, handleContextError(ctx, err)
+	}
+	defer rows.Close()
+
+	var families []models.Family
+	for rows.Next() {
+		var family int
+		if err := rows.Scan(&family); err != nil {
+			return nil, handleContextError(ctx, err)
+		}
+		families = append(families, models.Family(family))
+	}
+
+	if rows.Err() != nil {
+		return nil, handleContextError(ctx, rows.Err())
+	}
+	return families, nil
+}
+
+// DistinctSchemasForUid returns the schemas a given user has datasets in, for filtering their dataset list.
+func (db *DB) DistinctSchemasForUid(uid uuid.UUID) ([]string, error) {
+	return db.DistinctSchemasForUidContext(context.Background(), uid)
+}
+
+// DistinctSchemasForUidContext returns the schemas in use by a given user within the given context.
+// Soft-deleted datasets are not included; schemas are ordered by name.
+func (db *DB) DistinctSchemasForUidContext(ctx context.Context, uid uuid.UUID) (_ []string, err error) {
+	defer db.observe("list", time.Now(), &err)
+
+	rows, err := db.readPool(ctx).QueryEx(ctx, "SELECT DISTINCT schema FROM datasets WHERE owner = $1 AND deleted IS NULL ORDER BY schema", nil, uid.Array())
+	if err != nil {
+		return nil, handleContextError(ctx, err)
+	}
+	defer rows.Close()
+
+	var schemas []string
+	for rows.Next() {
+		var schema string
+		if err := rows.Scan(&schema); err != nil {
+			return nil, handleContextError(ctx, err)
+		}
+		schemas = append(schemas, schema)
+	}
+
+	if rows.Err() != nil {
+		return nil, handleContextError(ctx, rows.Err())
+	}
+	return schemas, nil
+}
@@ -0,0 +1,71 @@
+package psql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+)
+
+func TestListFilterWhere(t *testing.T) {
+	family, schema, published := models.FamilyMetax, "metax-ida", true
+
+	tests := []struct {
+		name   string
+		filter ListFilter
+		sql    string
+		args   []interface{}
+	}{
+		{name: "empty", filter: ListFilter{}, sql: "", args: []interface{}{"uid"}},
+		{
+			name:   "family and published",
+			filter: ListFilter{Family: &family, Published: &published},
+			sql:    " AND family = $2 AND coalesce(published, false) = $3",
+			args:   []interface{}{"uid", 2, true},
+		},
+		{
+			name:   "schema",
+			filter: ListFilter{Schema: &schema},
+			sql:    " AND schema = $2",
+			args:   []interface{}{"uid", "metax-ida"},
+		},
+		{
+			name:   "exclude service",
+			filter: ListFilter{Schema: &schema, ExcludeService: true},
+			sql:    " AND schema = $2 AND origin <> $3",
+			args:   []interface{}{"uid", "metax-ida", "service"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sql, args := test.filter.where([]interface{}{"uid"})
+			if sql != test.sql {
+				t.Errorf("expected sql %q, got %q", test.sql, sql)
+			}
+			if !reflect.DeepEqual(args, test.args) {
+				t.Errorf("expected args %v, got %v", test.args, args)
+			}
+		})
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	tests := []struct {
+		order OrderBy
+		sql   string
+		err   error
+	}{
+		{order: OrderBy{}, sql: "modified DESC NULLS LAST, id DESC"},
+		{order: OrderBy{Field: SortCreated, Ascending: true}, sql: "created ASC NULLS LAST, id ASC"},
+		{order: OrderBy{Field: SortTitle}, sql: "title DESC NULLS LAST, id DESC"},
+		{order: OrderBy{Field: "owner"}, err: ErrInvalidOrder},
+	}
+
+	for _, test := range tests {
+		sql, err := test.order.sql()
+		if sql != test.sql || err != test.err {
+			t.Errorf("%+v: expected (%q, %v), got (%q, %v)", test.order, test.sql, test.err, sql, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package psql
+
+import (
+	"context"
+	"time"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/wvh/uuid"
+)
+
+// metaSelect selects the columns scanned by scanMeta; append the WHERE clause.
+const metaSelect = "SELECT id, creator, owner, family, schema, title, valid, published, created, modified, synced FROM datasets WHERE "
+
+// DatasetMeta holds the header fields of a dataset without its blob, for views and checks that don't need the metadata itself.
+// Timestamps are zero if not set in the database.
+type DatasetMeta struct {
+	Id      uuid.UUID
+	Creator uuid.UUID
+	Owner   uuid.UUID
+
+	Family models.Family
+	Schema string
+
+	// Title is extracted from the blob by the database; empty if the blob has no title.
+	Title string
+
+	Valid     bool
+	Published bool
+
+	Created  time.Time
+	Modified time.Time
+	Synced   time.Time
+}
+
+// Dataset converts the header fields to a dataset record with an empty `{}` blob.
+func (meta *DatasetMeta) Dataset() (*models.Dataset, error) {
+	dataset := &models.Dataset{
+		Id:        meta.Id,
+		Creator:   meta.Creator,
+		Owner:     meta.Owner,
+		Created:   meta.Created,
+		Modified:  meta.Modified,
+		Synced:    meta.Synced,
+		Published: meta.Published,
+	}
+
+	if err := dataset.SetData(meta.Family, meta.Schema, nil); err != nil {
+		return nil, err
+	}
+	dataset.SetValid(meta.Valid)
+	return dataset, nil
+}
+
+// rowScanner is satisfied by both *pgx.Row and *pgx.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMeta scans a row selected with metaSelect.
+func scanMeta(row rowScanner) (*DatasetMeta, error) {
+	var (
+		created, modified, synced *time.Time
+
+		family           int
+		title            *string
+		valid, published *bool
+	)
+
+	meta := new(DatasetMeta)
+	err := row.Scan(meta.Id.Array(), meta.Creator.Array(), meta.Owner.Array(), &family, &meta.Schema, &title, &valid, &published, &created, &modified, &synced)
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Family = models.Family(family)
+	if title != nil {
+		meta.Title = *title
+	}
+	meta.Valid = valid != nil && *valid
+	meta.Published = published != nil && *published
+	meta.Created, meta.Modified, meta.Synced = timeOrZero(created), timeOrZero(modified), timeOrZero(synced)
+	return meta, nil
+}
+
+// GetMeta retrieves the header fields of a dataset without fetching its blob.
+func (db *DB) GetMeta(id uuid.UUID) (*DatasetMeta, error) {
+	return db.GetMetaContext(context.Background(), id)
+}
+
+// GetMetaContext retrieves the header fields of a dataset within the given context.
+// It reads from the replica if one is configured; see WithReadConsistency.
+func (db *DB) GetMetaContext(ctx context.Context, id uuid.UUID) (_ *DatasetMeta, err error) {
+	defer db.observe("get", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return nil, wrapError("get", id, err)
+	}
+
+	meta, err := scanMeta(db.readPool(ctx).QueryRowEx(ctx, metaSelect+"id = $1 AND deleted IS NULL", nil, id.Array()))
+	if err != nil {
+		return nil, wrapError("get", id, handleContextError(ctx, err))
+	}
+	return meta, nil
+}
+
+// listMeta runs a query built from metaSelect and the given condition on the read pool and scans the header fields of each row.
+func (db *DB) listMeta(ctx context.Context, where string, args ...interface{}) ([]*DatasetMeta, error) {
+	rows, err := db.readPool(ctx).QueryEx(ctx, metaSelect+where, nil, args...)
+	if err != nil {
+		return nil, handleContextError(ctx, err)
+	}
+	defer rows.Close()
+
+	var list []*DatasetMeta
+	for rows.Next() {
+		meta, err := scanMeta(rows)
+		if err != nil {
+			return nil, handleContextError(ctx, err)
+		}
+		list = append(list, meta)
+	}
+
+	if rows.Err() != nil {
+		return nil, handleContextError(ctx, rows.Err())
+	}
+	return list, nil
+}
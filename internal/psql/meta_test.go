@@ -0,0 +1,33 @@
+package psql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDatasetMetaDataset(t *testing.T) {
+	meta := &DatasetMeta{
+		Id:        owner,
+		Creator:   owner,
+		Owner:     owner,
+		Family:    2,
+		Schema:    "metax-ida",
+		Valid:     true,
+		Published: true,
+		Created:   time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	dataset, err := meta.Dataset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dataset.Family() != 2 || dataset.Schema() != "metax-ida" || !dataset.IsValid() || !dataset.Published {
+		t.Errorf("header fields not copied: %+v", dataset)
+	}
+	if !dataset.Created.Equal(meta.Created) || !dataset.Modified.IsZero() {
+		t.Errorf("unexpected timestamps: created %v, modified %v", dataset.Created, dataset.Modified)
+	}
+	if string(dataset.Blob()) != "{}" {
+		t.Errorf("expected empty object, got %q", dataset.Blob())
+	}
+}
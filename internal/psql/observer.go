@@ -0,0 +1,36 @@
+package psql
+
+import (
+	"time"
+
+	"github.com/jackc/pgx"
+)
+
+// Observer is notified after each instrumented database operation, for instance to collect metrics.
+// The op name is the same as in errors returned by the operation, such as "get", "update" or "list";
+// err is the error returned to the caller, or nil on success. Implementations must be safe for concurrent use.
+type Observer interface {
+	ObserveQuery(op string, dur time.Duration, err error)
+}
+
+// SetObserver sets the observer notified of database operations; operations aren't observed if it is nil.
+// It is not safe to call this function after initialisation.
+func (psql *DB) SetObserver(observer Observer) {
+	psql.observer = observer
+}
+
+// observe reports an operation that started at the given time to the observer, if any.
+// It takes a pointer to the error so it can be deferred before the operation's result is known.
+//
+// Postgres errors that handleError doesn't translate usually point to a bug or a schema mismatch,
+// so they are also logged to the database logger; see SetLogger.
+func (db *DB) observe(op string, start time.Time, err *error) {
+	if pgerr, ok := Cause(*err).(pgx.PgError); ok {
+		db.logger.Error().Err(pgerr).Str("op", op).Str("code", pgerr.Code).Msg("unexpected database error")
+	}
+
+	if db.observer == nil {
+		return
+	}
+	db.observer.ObserveQuery(op, time.Since(start), *err)
+}
@@ -0,0 +1,54 @@
+package psql
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/rs/zerolog"
+	"github.com/wvh/uuid"
+)
+
+type recordingObserver struct {
+	ops  []string
+	errs []error
+}
+
+func (o *recordingObserver) ObserveQuery(op string, dur time.Duration, err error) {
+	o.ops = append(o.ops, op)
+	o.errs = append(o.errs, err)
+}
+
+func TestObserver(t *testing.T) {
+	observer := new(recordingObserver)
+	db := &DB{}
+	db.SetObserver(observer)
+
+	// fails on the nil id before touching the database
+	_, err := db.Get(uuid.UUID{})
+	if len(observer.ops) != 1 || observer.ops[0] != "get" {
+		t.Fatalf("expected one get operation, got %v", observer.ops)
+	}
+	if observer.errs[0] != err || Cause(observer.errs[0]) != ErrInvalidID {
+		t.Errorf("expected observed error %v, got %v", err, observer.errs[0])
+	}
+}
+
+func TestObserveLogsUnexpected(t *testing.T) {
+	var buf bytes.Buffer
+	db := &DB{logger: zerolog.New(&buf)}
+
+	err := wrapError("get", uuid.UUID{}, ErrNotFound)
+	db.observe("get", time.Now(), &err)
+	if buf.Len() != 0 {
+		t.Errorf("expected translated error not to be logged, got %s", buf.String())
+	}
+
+	err = wrapError("get", uuid.UUID{}, handleError(pgx.PgError{Code: "XX000", Message: "internal error"}))
+	db.observe("get", time.Now(), &err)
+	if !strings.Contains(buf.String(), `"code":"XX000"`) {
+		t.Errorf("expected untranslated postgres error to be logged, got %q", buf.String())
+	}
+}
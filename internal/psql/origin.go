@@ -0,0 +1,56 @@
+package psql
+
+import (
+	"context"
+	"time"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+)
+
+// Origin records how a dataset came into the database.
+type Origin string
+
+// Dataset origins, as stored in the `origin` column.
+const (
+	// OriginUser is a dataset created by a user in Qvain.
+	OriginUser Origin = "user"
+
+	// OriginService is a dataset harvested from Metax.
+	OriginService Origin = "service"
+
+	// OriginImport is a dataset restored from an export with ImportStream.
+	OriginImport Origin = "import"
+)
+
+// StoreFromService stores a new dataset harvested from an external service, keeping its metadata fields.
+// Unlike Create, the dataset is marked as OriginService, so it can be left out of a user's editable list with ListFilter.
+func (db *DB) StoreFromService(dataset *models.Dataset) error {
+	return db.StoreFromServiceContext(context.Background(), dataset)
+}
+
+// StoreFromServiceContext stores a new dataset harvested from an external service within the given context.
+// The sync time is set to now if it is zero.
+func (db *DB) StoreFromServiceContext(ctx context.Context, dataset *models.Dataset) (err error) {
+	defer db.observe("create", time.Now(), &err)
+
+	if err := checkID(dataset.Id); err != nil {
+		return wrapError("create", dataset.Id, err)
+	}
+
+	if dataset.Synced.IsZero() {
+		dataset.Synced = time.Now()
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("create", dataset.Id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.createWithMetadata(dataset)
+	if err != nil {
+		return wrapError("create", dataset.Id, handleContextError(ctx, err))
+	}
+
+	return wrapError("create", dataset.Id, tx.Commit())
+}
@@ -0,0 +1,61 @@
+package psql
+
+import (
+	"github.com/jackc/pgx"
+)
+
+// Names of statements prepared on every pool connection.
+// pgx executes a prepared statement when its name is passed instead of SQL, so these can be used with Query, QueryRow and Exec.
+const (
+	stmtGet        = "qvain_get"
+	stmtGetTx      = "qvain_get_tx"
+	stmtCheckOwner = "qvain_check_owner"
+	stmtGetFamily  = "qvain_get_family"
+	stmtUpdate     = "qvain_update"
+	stmtPatch      = "qvain_patch"
+)
+
+// datasetSelect selects the dataset columns scanned by getDataset; append a condition.
+// The blob of an archived dataset is read from cold storage, and that of a compressed dataset is returned compressed; see decompressBlob.
+const datasetSelect = "select id, creator, owner, created, modified, synced, seq, metax_id, modified_by, valid, family, schema, dataset_data(id, blob, blob_gz) from datasets where "
+
+// datasetIfChangedSelect is like datasetSelect for a dataset by id, but returns a NULL blob if the seq equals the second argument.
+const datasetIfChangedSelect = "select id, creator, owner, created, modified, synced, seq, metax_id, modified_by, valid, family, schema, case when seq = $2 then null else dataset_data(id, blob, blob_gz) end from datasets where id = $1 and deleted is null"
+
+// readStatements are the hot read-only queries, prepared on primary and replica connections.
+var readStatements = map[string]string{
+	stmtGet:        datasetSelect + "id = $1 and deleted is null",
+	stmtGetTx:      "select id, creator, owner, created, modified, synced, seq, metax_id, modified_by, family, schema, dataset_data(id, blob, blob_gz) from datasets where id=$1 and deleted is null",
+	stmtCheckOwner: "SELECT (owner = $2) FROM datasets WHERE id = $1 AND deleted IS NULL",
+	stmtGetFamily:  "SELECT family FROM datasets WHERE id = $1",
+}
+
+// writeStatements are the hot updates, prepared on primary connections only.
+var writeStatements = map[string]string{
+	stmtUpdate: "UPDATE datasets SET modified = now(), modified_by = $4, seq = seq + 1, blob = $2, valid = coalesce($3, valid) WHERE id = $1 AND deleted IS NULL",
+	stmtPatch:  "UPDATE datasets SET modified = now(), modified_by = $3, seq = seq + 1, blob = blob || $2 WHERE id = $1 AND deleted IS NULL",
+}
+
+// preparePrimary prepares all hot statements on a new primary connection.
+// It runs as the pool's AfterConnect hook, so statements are re-created whenever the pool reconnects.
+func preparePrimary(conn *pgx.Conn) error {
+	if err := prepare(conn, readStatements); err != nil {
+		return err
+	}
+	return prepare(conn, writeStatements)
+}
+
+// prepareReplica prepares the read-only statements on a new replica connection.
+func prepareReplica(conn *pgx.Conn) error {
+	return prepare(conn, readStatements)
+}
+
+// prepare prepares a set of named statements on a connection.
+func prepare(conn *pgx.Conn, statements map[string]string) error {
+	for name, sql := range statements {
+		if _, err := conn.Prepare(name, sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package psql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+)
+
+// BenchmarkGet compares fetching a dataset through the prepared statement with sending the SQL text each time.
+func BenchmarkGet(b *testing.B) {
+	if testing.Short() {
+		b.Skip("skipping benchmark in short mode")
+	}
+
+	db, err := NewPoolServiceFromEnv()
+	if err != nil {
+		b.Fatal("psql:", err)
+	}
+
+	dataset, err := models.NewDataset(owner)
+	if err != nil {
+		b.Fatal("models.NewDataset():", err)
+	}
+	dataset.SetData(1, "open test dataset", []byte(`{"title":"benchmark dataset"}`))
+	if err = db.Create(dataset); err != nil {
+		b.Fatal("db.Create():", err)
+	}
+	defer db.Delete(dataset.Id, nil)
+
+	ctx := context.Background()
+	for name, sql := range map[string]string{"prepared": stmtGet, "unprepared": readStatements[stmtGet]} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := db.getDataset(ctx, sql, dataset.Id.Array()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
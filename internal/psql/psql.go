@@ -6,18 +6,78 @@ import (
 	"errors"
 	"github.com/jackc/pgx"
 	"github.com/rs/zerolog"
+	"sync"
 	"time"
 )
 
 // DefaultPoolAcquireTimeout is the duration pgx waits for a connection to become available from the pool.
 const DefaultPoolAcquireTimeout = 10 * time.Second
 
+// DefaultPingTimeout is the maximum time Ping waits for the database to answer.
+const DefaultPingTimeout = 2 * time.Second
+
+// DefaultMaxRetries is the default number of times a transaction is retried after a serialization failure or deadlock.
+const DefaultMaxRetries = 3
+
+// DefaultMaxBlobBytes is the default limit on the size of a dataset blob.
+const DefaultMaxBlobBytes = 16 << 20
+
 // DB holds the database methods and configuration.
 type DB struct {
+	// MaxRetries is the number of times retryable transactions are retried after a serialization failure or deadlock.
+	// It is not safe to change this after initialisation.
+	MaxRetries int
+
+	// StatementTimeout limits the run time of each statement in transactions started by this handle; zero means no limit.
+	// It can be overridden per call with WithStatementTimeout. It is not safe to change this after initialisation.
+	StatementTimeout time.Duration
+
+	// Schema is the Postgres schema holding the tables, for instance to keep tenants apart in one database.
+	// It is set as search path on each connection; if empty, the server's default search path is used.
+	// It has to be set before the pool is initialised.
+	Schema string
+
+	// MaxBlobBytes is the maximum size of a dataset blob in bytes; larger blobs are refused with ErrBlobTooLarge.
+	// Zero means no limit. It is not safe to change this after initialisation.
+	MaxBlobBytes int
+
+	// CompressionThreshold is the blob size in bytes above which writes that replace a whole blob – creates, updates, upserts,
+	// clones and publications – store it gzip-compressed.
+	// Compressed blobs are read transparently, but can't be patched; see ErrCompressed. Zero disables compression.
+	// It is not safe to change this after initialisation.
+	CompressionThreshold int
+
 	config *pgx.ConnConfig
 	//poolConfig *pgx.ConnPoolConfig
 	pool   *pgx.ConnPool
 	logger zerolog.Logger
+
+	// optional read replica, nil if not configured
+	replica *pgx.ConnPool
+
+	// schema validation of dataset blobs
+	validator  Validator
+	validation bool
+
+	// optional limit on the number of datasets per owner
+	quota QuotaChecker
+
+	// optional hook for metrics on database operations
+	observer Observer
+
+	// generator for new dataset ids, uuid.NewUUID if nil
+	idgen IDGenerator
+
+	// reads recorded for the access time, nil unless TrackAccess was called
+	access *accessLog
+
+	// report missing datasets as not owned in owner-checked calls
+	hideNotFound bool
+
+	// in-flight transactions, tracked so Close can wait for them
+	mu       sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup
 }
 
 // NewService returns a database handle configured with the given connection string.
@@ -35,8 +95,11 @@ func NewService(connString string) (db *DB, err error) {
 // newService is the actual constructor that takes a ConnConfig populated by the calling function in whatever way.
 func newService(config *pgx.ConnConfig) (db *DB) {
 	db = &DB{
-		config: config,
-		logger: zerolog.Nop(),
+		config:       config,
+		logger:       zerolog.Nop(),
+		validation:   true,
+		MaxRetries:   DefaultMaxRetries,
+		MaxBlobBytes: DefaultMaxBlobBytes,
 	}
 	if true {
 		// self-referential, should be ok with the garbage collector...
@@ -57,14 +120,25 @@ func NewPoolService(connString string) (db *DB, err error) {
 	return
 }
 
-// NewPoolService creates a psql service using environment variables and initialises the connection pool.
-func NewPoolServiceFromEnv() (db *DB, err error) {
+// NewServiceFromEnv returns a database handle configured with libpq environment variables.
+// It does not try to connect, so options such as Schema can be set before calling InitPool.
+func NewServiceFromEnv() (db *DB, err error) {
 	connConfig, err := pgx.ParseEnvLibpq()
 	if err != nil {
 		return nil, err
 	}
 
 	db = newService(&connConfig)
+	return
+}
+
+// NewPoolService creates a psql service using environment variables and initialises the connection pool.
+func NewPoolServiceFromEnv() (db *DB, err error) {
+	db, err = NewServiceFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
 	err = db.InitPool()
 	return
 }
@@ -75,14 +149,22 @@ func (psql *DB) SetLogger(logger zerolog.Logger) {
 	psql.logger = logger
 }
 
+// SetHideNotFoundAsNotOwner makes owner-checked calls such as GetWithOwner return ErrNotOwner instead of ErrNotFound
+// for datasets that don't exist, so API users can't probe which dataset ids exist.
+// Calls without an owner check, such as Get, still return ErrNotFound.
+// It is not safe to call this function after initialisation.
+func (psql *DB) SetHideNotFoundAsNotOwner(hide bool) {
+	psql.hideNotFound = hide
+}
+
 // Connect returns a single database conn or an error.
 func (psql *DB) Connect() (*pgx.Conn, error) {
-	return pgx.Connect(*psql.config)
+	return pgx.Connect(psql.connConfig(*psql.config))
 }
 
 // MustConnect returns a single database conn and panics on failure.
 func (psql *DB) MustConnect() *pgx.Conn {
-	conn, err := pgx.Connect(*psql.config)
+	conn, err := pgx.Connect(psql.connConfig(*psql.config))
 	if err != nil {
 		panic(err)
 	}
@@ -90,35 +172,136 @@ func (psql *DB) MustConnect() *pgx.Conn {
 }
 
 // InitPool initialises a pool with default settings on the database object.
+// Frequently used statements are prepared on each connection the pool opens.
 func (psql *DB) InitPool() (err error) {
 	// default MaxConnections: 5
 	psql.pool, err = pgx.NewConnPool(pgx.ConnPoolConfig{
-		ConnConfig:     *psql.config,
+		ConnConfig:     psql.connConfig(*psql.config),
 		AcquireTimeout: DefaultPoolAcquireTimeout,
+		AfterConnect:   preparePrimary,
 	})
 	return err
 }
 
+// Tx wraps a pgx transaction together with the context it was started with.
+//
+// The query methods on Tx shadow those of the embedded pgx transaction so every statement honours the context;
+// Rollback doesn't use the context so a transaction can still be rolled back after its context has been cancelled.
 type Tx struct {
 	*pgx.Tx
+	ctx context.Context
+
+	// validator is nil if validation is disabled
+	validator Validator
+
+	// quota is nil if quotas aren't enforced
+	quota QuotaChecker
+
+	// hideNotFound makes CheckOwner return ErrNotOwner for missing datasets
+	hideNotFound bool
+
+	// maxBlobBytes limits the size of stored blobs; zero means no limit
+	maxBlobBytes int
+
+	// compressionThreshold is the size above which blobs are stored compressed; zero disables compression
+	compressionThreshold int
+
+	// allowCrossUserCreate lets inserts store datasets whose owner isn't their creator; see AllowCrossUserCreate
+	allowCrossUserCreate bool
+
+	// release marks the transaction as finished for Close
+	release func()
 }
 
+// Begin starts a transaction without deadline or cancellation.
 func (psql *DB) Begin() (*Tx, error) {
-	tx, err := psql.pool.Begin()
+	return psql.BeginContext(context.Background())
+}
+
+// BeginContext starts a transaction bound to the given context.
+// It returns ErrClosed if the database handle has been closed.
+func (psql *DB) BeginContext(ctx context.Context) (*Tx, error) {
+	return psql.begin(ctx, psql.pool, nil)
+}
+
+// begin starts a transaction on the given pool.
+func (psql *DB) begin(ctx context.Context, pool *pgx.ConnPool, opts *pgx.TxOptions) (*Tx, error) {
+	psql.mu.Lock()
+	if psql.closed {
+		psql.mu.Unlock()
+		return nil, ErrClosed
+	}
+	psql.inflight.Add(1)
+	psql.mu.Unlock()
+
+	tx, err := pool.BeginEx(ctx, opts)
 	if err != nil {
-		return nil, err
+		psql.inflight.Done()
+		return nil, handleContextError(ctx, err)
 	}
-	return &Tx{tx}, nil
+
+	var once sync.Once
+	res := &Tx{Tx: tx, ctx: ctx, quota: psql.quota, hideNotFound: psql.hideNotFound, maxBlobBytes: psql.MaxBlobBytes, compressionThreshold: psql.CompressionThreshold, release: func() { once.Do(psql.inflight.Done) }}
+	if psql.validation {
+		res.validator = psql.validator
+	}
+
+	if timeout := psql.statementTimeout(ctx); timeout > 0 {
+		if err = res.setStatementTimeout(timeout); err != nil {
+			res.Rollback()
+			return nil, handleContextError(ctx, err)
+		}
+	}
+	return res, nil
+}
+
+// Exec executes sql within the transaction using the transaction's context.
+func (tx *Tx) Exec(sql string, args ...interface{}) (pgx.CommandTag, error) {
+	return tx.Tx.ExecEx(tx.ctx, sql, nil, args...)
+}
+
+// Query runs a query within the transaction using the transaction's context.
+func (tx *Tx) Query(sql string, args ...interface{}) (*pgx.Rows, error) {
+	return tx.Tx.QueryEx(tx.ctx, sql, nil, args...)
+}
+
+// QueryRow runs a single-row query within the transaction using the transaction's context.
+func (tx *Tx) QueryRow(sql string, args ...interface{}) *pgx.Row {
+	return tx.Tx.QueryRowEx(tx.ctx, sql, nil, args...)
+}
+
+// Commit commits the transaction using the transaction's context.
+func (tx *Tx) Commit() error {
+	defer tx.release()
+	return handleContextError(tx.ctx, tx.Tx.CommitEx(tx.ctx))
+}
+
+// Rollback aborts the transaction; it is safe to call after Commit.
+func (tx *Tx) Rollback() error {
+	defer tx.release()
+	return tx.Tx.Rollback()
 }
 
 func (psql *DB) Version() (string, error) {
+	return psql.VersionContext(context.Background())
+}
+
+// VersionContext returns the database server version string.
+func (psql *DB) VersionContext(ctx context.Context) (string, error) {
 	var version string
 
-	err := psql.pool.QueryRow("select version()").Scan(&version)
-	return version, err
+	err := psql.pool.QueryRowEx(ctx, "select version()", nil).Scan(&version)
+	return version, handleContextError(ctx, err)
 }
 
 func (psql *DB) Check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return psql.CheckContext(ctx)
+}
+
+// CheckContext acquires a connection from the pool and pings the database.
+func (psql *DB) CheckContext(ctx context.Context) error {
 	conn, err := psql.pool.Acquire()
 	if err != nil {
 		return err
@@ -127,9 +310,66 @@ func (psql *DB) Check() error {
 	if !conn.IsAlive() {
 		return errors.New("connection is dead")
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	return handleContextError(ctx, conn.Ping(ctx))
+}
+
+// Close stops new transactions from being started, waits for those in progress to finish and closes the connection pool.
+// If the context expires first, the pool is closed anyway – aborting the remaining transactions – and the context's error is returned.
+func (psql *DB) Close(ctx context.Context) error {
+	psql.mu.Lock()
+	psql.closed = true
+	psql.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		psql.inflight.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if psql.pool != nil {
+		psql.pool.Close()
+	}
+	if psql.replica != nil {
+		psql.replica.Close()
+	}
+	return err
+}
+
+// Ping checks the database is reachable by running a trivial query on a pooled connection.
+// It gives up after DefaultPingTimeout or at the context's deadline, whichever comes first.
+func (psql *DB) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, DefaultPingTimeout)
 	defer cancel()
-	return conn.Ping(ctx)
+
+	var one int
+	err := psql.pool.QueryRowEx(ctx, "SELECT 1", nil).Scan(&one)
+	return handleContextError(ctx, err)
+}
+
+// PoolStats holds connection pool metrics.
+type PoolStats struct {
+	Max   int `json:"max"`
+	Open  int `json:"open"`
+	Idle  int `json:"idle"`
+	InUse int `json:"in_use"`
+}
+
+// Stats returns the current connection pool metrics.
+func (psql *DB) Stats() PoolStats {
+	stat := psql.pool.Stat()
+	return PoolStats{
+		Max:   stat.MaxConnections,
+		Open:  stat.CurrentConnections,
+		Idle:  stat.AvailableConnections,
+		InUse: stat.CurrentConnections - stat.AvailableConnections,
+	}
 }
 
 func (psql *DB) Log(plevel pgx.LogLevel, msg string, data map[string]interface{}) {
@@ -0,0 +1,30 @@
+package psql
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestClose(t *testing.T) {
+	db := &DB{}
+
+	// simulate a transaction in progress
+	db.inflight.Add(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := db.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected %v while a transaction is in progress, got %v", context.DeadlineExceeded, err)
+	}
+
+	if _, err := db.Begin(); err != ErrClosed {
+		t.Errorf("expected %v after Close, got %v", ErrClosed, err)
+	}
+
+	db.inflight.Done()
+	if err := db.Close(context.Background()); err != nil {
+		t.Errorf("expected no error once drained, got %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package psql
+
+import (
+	"context"
+	"time"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/wvh/uuid"
+)
+
+// BeginPublish moves a dataset to the publishing state before it is sent to Metax.
+// It returns ErrConflict if the dataset is already being published.
+func (db *DB) BeginPublish(id uuid.UUID, owner uuid.UUID) error {
+	return db.BeginPublishContext(context.Background(), id, owner)
+}
+
+// BeginPublishContext moves a dataset to the publishing state within the given context.
+func (db *DB) BeginPublishContext(ctx context.Context, id uuid.UUID, owner uuid.UUID) (err error) {
+	defer db.observe("begin publish", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return wrapError("begin publish", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("begin publish", id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return wrapError("begin publish", id, handleContextError(ctx, err))
+	}
+
+	ct, err := tx.Exec("UPDATE datasets SET state = $2 WHERE id = $1 AND state <> $2", id.Array(), string(models.StatePublishing))
+	if err != nil {
+		return wrapError("begin publish", id, handleContextError(ctx, err))
+	}
+
+	if ct.RowsAffected() != 1 {
+		return wrapError("begin publish", id, ErrConflict)
+	}
+
+	return wrapError("begin publish", id, tx.Commit())
+}
+
+// FinishPublish ends the publishing state of a dataset, moving it to published – recording the Metax identifier – or failed.
+// On success it returns the dataset's new sync time and sequence number; a failed publication leaves both untouched and returns
+// the zero Publication. Either outcome is added to the dataset's PublishHistory.
+// It returns ErrConflict if the dataset is not being published.
+func (db *DB) FinishPublish(id uuid.UUID, success bool, externalId string) (Publication, error) {
+	return db.FinishPublishContext(context.Background(), id, success, externalId)
+}
+
+// FinishPublishContext ends the publishing state of a dataset within the given context.
+func (db *DB) FinishPublishContext(ctx context.Context, id uuid.UUID, success bool, externalId string) (pub Publication, err error) {
+	defer db.observe("finish publish", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return pub, wrapError("finish publish", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return pub, wrapError("finish publish", id, err)
+	}
+	defer tx.Rollback()
+
+	state, err := tx.getState(id)
+	if err != nil {
+		return pub, wrapError("finish publish", id, handleContextError(ctx, err))
+	}
+
+	if state != models.StatePublishing {
+		return pub, wrapError("finish publish", id, ErrConflict)
+	}
+
+	if success {
+		pub, err = tx.MarkPublished(id, externalId, time.Now())
+	} else {
+		_, err = tx.Exec("UPDATE datasets SET state = $2 WHERE id = $1", id.Array(), string(models.StateFailed))
+		if err == nil {
+			err = tx.recordPublishEvent(id, externalId, false)
+		}
+	}
+	if err != nil {
+		return Publication{}, wrapError("finish publish", id, handleContextError(ctx, err))
+	}
+
+	if err = tx.Commit(); err != nil {
+		return Publication{}, wrapError("finish publish", id, err)
+	}
+	return pub, nil
+}
+
+// getState returns the publication state of a dataset.
+func (tx *Tx) getState(id uuid.UUID) (models.PublishState, error) {
+	var state string
+	err := tx.QueryRow("SELECT state FROM datasets WHERE id = $1", id.Array()).Scan(&state)
+	if err != nil {
+		return "", handleError(err)
+	}
+
+	return models.PublishState(state), nil
+}
+
+// Publication holds the sync time and sequence number of a dataset after it was marked as published,
+// so clients can refresh their copy without fetching the dataset again.
+type Publication struct {
+	Synced time.Time
+	Seq    int64
+}
+
+// MarkPublished moves a dataset to the published state, keeping the published flag in sync, and returns the new sync time and seq.
+// An empty externalId leaves a previously stored Metax identifier untouched. The publication is added to the dataset's PublishHistory.
+//
+// Publishing bumps the sequence number like any other change, so caches keyed on seq are invalidated
+// and the changes feed picks up the new state.
+func (tx *Tx) MarkPublished(id uuid.UUID, externalId string, synced time.Time) (Publication, error) {
+	return tx.markPublished(id, externalId, &synced)
+}
+
+// markPublished is MarkPublished with an optional sync time; the stored sync time is left as is if synced is nil.
+func (tx *Tx) markPublished(id uuid.UUID, externalId string, synced *time.Time) (Publication, error) {
+	var (
+		pub       Publication
+		newSynced *time.Time
+	)
+	err := tx.QueryRow(`UPDATE datasets SET state = $2, published = true, synced = coalesce($3, synced), seq = seq + 1, metax_id = coalesce(nullif($4, ''), metax_id) WHERE id = $1 AND deleted IS NULL RETURNING synced, seq`,
+		id.Array(), string(models.StatePublished), synced, externalId).Scan(&newSynced, &pub.Seq)
+	if err != nil {
+		return Publication{}, handleError(err)
+	}
+
+	if err = tx.recordPublishEvent(id, externalId, true); err != nil {
+		return Publication{}, err
+	}
+
+	pub.Synced = timeOrZero(newSynced)
+	return pub, nil
+}
+
+// BatchPublish marks several datasets as published in one transaction, for instance after re-publishing them to Metax.
+// If owner is not nil, datasets not owned by that user are skipped with ErrNotOwner.
+//
+// It returns a slice with an error – or nil – for each id, so the caller can report how many datasets were published,
+// and an error if the batch as a whole failed.
+func (db *DB) BatchPublish(ids []uuid.UUID, owner *uuid.UUID) ([]error, error) {
+	return db.BatchPublishContext(context.Background(), ids, owner)
+}
+
+// BatchPublishContext marks several datasets as published within the given context.
+// Each dataset is updated within its own savepoint so a failing dataset doesn't abort the transaction.
+func (db *DB) BatchPublishContext(ctx context.Context, ids []uuid.UUID, owner *uuid.UUID) ([]error, error) {
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	errs := make([]error, len(ids))
+	for i, id := range ids {
+		if _, err = tx.Exec("SAVEPOINT batch_item"); err != nil {
+			return nil, handleContextError(ctx, err)
+		}
+
+		if owner != nil {
+			err = tx.CheckOwner(id, *owner)
+		}
+		if err == nil {
+			_, err = tx.MarkPublished(id, "", now)
+		}
+		if err != nil {
+			errs[i] = handleContextError(ctx, err)
+			if _, err = tx.Exec("ROLLBACK TO SAVEPOINT batch_item"); err != nil {
+				return nil, handleContextError(ctx, err)
+			}
+			continue
+		}
+
+		if _, err = tx.Exec("RELEASE SAVEPOINT batch_item"); err != nil {
+			return nil, handleContextError(ctx, err)
+		}
+	}
+
+	return errs, tx.Commit()
+}
+
+// PublishEvent is an attempt to publish a dataset, as recorded by FinishPublish, StorePublished and MarkPublished.
+type PublishEvent struct {
+	// Uid is the owner of the dataset at the time of publication.
+	Uid       uuid.UUID
+	MetaxId   string
+	Published time.Time
+	Success   bool
+}
+
+// recordPublishEvent adds a publication attempt to the history of a dataset.
+// An empty metaxId records the identifier stored for the dataset, if any.
+func (tx *Tx) recordPublishEvent(id uuid.UUID, metaxId string, success bool) error {
+	_, err := tx.Exec(`
+		INSERT INTO publish_events(dataset, uid, metax_id, success)
+		SELECT id, owner, coalesce(nullif($2, ''), metax_id), $3 FROM datasets WHERE id = $1`,
+		id.Array(), metaxId, success)
+	return handleError(err)
+}
+
+// PublishHistory returns every attempt to publish a dataset, so support can tell when it last reached Metax and whether that worked.
+func (db *DB) PublishHistory(id uuid.UUID) ([]PublishEvent, error) {
+	return db.PublishHistoryContext(context.Background(), id)
+}
+
+// PublishHistoryContext returns the publication attempts of a dataset within the given context, most recent first.
+// It reads from the replica if one is configured; see WithReadConsistency.
+func (db *DB) PublishHistoryContext(ctx context.Context, id uuid.UUID) (_ []PublishEvent, err error) {
+	defer db.observe("publish history", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return nil, wrapError("publish history", id, err)
+	}
+
+	rows, err := db.readPool(ctx).QueryEx(ctx, "SELECT uid, metax_id, published, success FROM publish_events WHERE dataset = $1 ORDER BY published DESC, id DESC", nil, id.Array())
+	if err != nil {
+		return nil, wrapError("publish history", id, handleContextError(ctx, err))
+	}
+	defer rows.Close()
+
+	var events []PublishEvent
+	for rows.Next() {
+		var (
+			event   PublishEvent
+			uid     *[16]byte
+			metaxId *string
+		)
+		if err := rows.Scan(&uid, &metaxId, &event.Published, &event.Success); err != nil {
+			return nil, wrapError("publish history", id, handleContextError(ctx, err))
+		}
+		if uid != nil {
+			event.Uid = *uid
+		}
+		if metaxId != nil {
+			event.MetaxId = *metaxId
+		}
+		events = append(events, event)
+	}
+
+	if rows.Err() != nil {
+		return nil, wrapError("publish history", id, handleContextError(ctx, rows.Err()))
+	}
+	return events, nil
+}
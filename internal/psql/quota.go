@@ -0,0 +1,55 @@
+package psql
+
+import (
+	"github.com/wvh/uuid"
+)
+
+// quotaLockSpace is the first key of the advisory locks serialising quota checks per owner.
+const quotaLockSpace = 0x7175
+
+// QuotaChecker decides whether an owner may store another dataset.
+// It is given the number of datasets the owner currently has, excluding soft-deleted ones,
+// and should return ErrQuotaExceeded – or another error – to refuse the new dataset.
+type QuotaChecker interface {
+	CheckQuota(owner uuid.UUID, count int) error
+}
+
+// CountQuota is a QuotaChecker allowing each owner at most Max datasets.
+type CountQuota struct {
+	Max int
+}
+
+// CheckQuota returns ErrQuotaExceeded if the owner already has Max datasets or more.
+func (q CountQuota) CheckQuota(owner uuid.UUID, count int) error {
+	if count >= q.Max {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// SetQuotaChecker sets the checker consulted before new datasets are stored; quotas aren't enforced if it is nil.
+// It is not safe to call this function after initialisation.
+func (psql *DB) SetQuotaChecker(checker QuotaChecker) {
+	psql.quota = checker
+}
+
+// checkQuota counts the owner's datasets and asks the quota checker whether another one may be added.
+// It takes a transaction-scoped advisory lock on the owner first, so concurrent inserts for the same owner can't both pass the check.
+func (tx *Tx) checkQuota(owner uuid.UUID) error {
+	if tx.quota == nil {
+		return nil
+	}
+
+	_, err := tx.Exec("SELECT pg_advisory_xact_lock($1, hashtext($2::uuid::text))", quotaLockSpace, owner.Array())
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRow("SELECT COUNT(*) FROM datasets WHERE owner = $1 AND deleted IS NULL", owner.Array()).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	return tx.quota.CheckQuota(owner, count)
+}
@@ -0,0 +1,60 @@
+package psql
+
+import (
+	"context"
+
+	"github.com/jackc/pgx"
+)
+
+// ReadConsistency selects which database a read-only query runs against.
+type ReadConsistency int
+
+const (
+	// ReadEventual allows reads from the replica, if one is configured; results may lag behind recent writes.
+	ReadEventual ReadConsistency = iota
+
+	// ReadStrong forces reads to go to the primary database.
+	ReadStrong
+)
+
+// consistencyKey is the context key for the read consistency of a call.
+type consistencyKey struct{}
+
+// WithReadConsistency returns a context that makes read-only methods called with it use the given consistency.
+// Use ReadStrong to read your own writes, for instance right after creating or updating a dataset.
+func WithReadConsistency(ctx context.Context, consistency ReadConsistency) context.Context {
+	return context.WithValue(ctx, consistencyKey{}, consistency)
+}
+
+// InitReplicaPool initialises a pool for a read replica; read-only methods will use it unless ReadStrong consistency is asked for.
+// Without a replica pool all queries go to the primary.
+func (psql *DB) InitReplicaPool(connString string) (err error) {
+	connConfig, err := pgx.ParseConnectionString(connString)
+	if err != nil {
+		return err
+	}
+	connConfig.Logger = psql
+
+	psql.replica, err = pgx.NewConnPool(pgx.ConnPoolConfig{
+		ConnConfig:     psql.connConfig(connConfig),
+		AcquireTimeout: DefaultPoolAcquireTimeout,
+		AfterConnect:   prepareReplica,
+	})
+	return err
+}
+
+// readPool returns the pool read-only queries should use for the given context.
+func (psql *DB) readPool(ctx context.Context) *pgx.ConnPool {
+	if psql.replica == nil {
+		return psql.pool
+	}
+	if consistency, ok := ctx.Value(consistencyKey{}).(ReadConsistency); ok && consistency == ReadStrong {
+		return psql.pool
+	}
+	return psql.replica
+}
+
+// beginRead starts a read-only transaction on the pool chosen by readPool.
+func (psql *DB) beginRead(ctx context.Context) (*Tx, error) {
+	return psql.begin(ctx, psql.readPool(ctx), &pgx.TxOptions{AccessMode: pgx.ReadOnly})
+}
@@ -0,0 +1,57 @@
+package psql
+
+import (
+	"context"
+	"time"
+)
+
+// retryBackoff is the initial wait before retrying a transaction; it doubles with each attempt.
+const retryBackoff = 10 * time.Millisecond
+
+// isConflict returns true for errors caused by concurrent transactions, which might succeed if run again.
+func isConflict(err error) bool {
+	err = Cause(err)
+	return err == ErrSerializationFailure || err == ErrDeadlock
+}
+
+// IsRetryable checks if an error returned by this package is transient, so the operation might succeed if tried again later:
+// a conflict with a concurrent transaction, or a database that is temporarily unavailable.
+// Callers should back off before retrying an unavailable database.
+func IsRetryable(err error) bool {
+	if isConflict(err) {
+		return true
+	}
+
+	switch Cause(err) {
+	case ErrUnavailable, ErrTemporary:
+		return true
+	}
+	return false
+}
+
+// withRetry runs a transaction closure for the named operation, retrying up to db.MaxRetries times with exponential backoff
+// if it fails with a serialization failure or deadlock. The closure should return errors converted by handleError.
+// Deadlocks are logged with the operation name and the server's description, as they are hard to reproduce.
+func (db *DB) withRetry(ctx context.Context, op string, f func() error) error {
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if !isConflict(err) {
+			return err
+		}
+
+		if Cause(err) == ErrDeadlock {
+			db.logger.Warn().Err(err).Str("op", op).Int("attempt", attempt+1).Msg("deadlock detected")
+		}
+		if attempt >= db.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,39 @@
+package psql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestWithRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		errs     []error
+		expected error
+		calls    int
+	}{
+		{name: "success", errs: []error{nil}, expected: nil, calls: 1},
+		{name: "not retryable", errs: []error{ErrNotFound}, expected: ErrNotFound, calls: 1},
+		{name: "retried", errs: []error{ErrSerializationFailure, ErrDeadlock, nil}, expected: nil, calls: 3},
+		{name: "gave up", errs: []error{ErrDeadlock, ErrDeadlock, ErrDeadlock}, expected: ErrDeadlock, calls: 3},
+	}
+
+	db := &DB{MaxRetries: 2, logger: zerolog.Nop()}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			err := db.withRetry(context.Background(), "test", func() error {
+				calls++
+				return test.errs[calls-1]
+			})
+			if err != test.expected {
+				t.Errorf("expected error %v, got %v", test.expected, err)
+			}
+			if calls != test.calls {
+				t.Errorf("expected %d calls, got %d", test.calls, calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package psql
+
+import (
+	"context"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+)
+
+// registryValidator adapts a models.SchemaRegistry to the Validator interface.
+type registryValidator struct {
+	registry *models.SchemaRegistry
+}
+
+// Validate returns the violations of the blob against the named schema.
+func (v registryValidator) Validate(schema string, blob []byte) ([]string, error) {
+	err := v.registry.Validate(schema, blob)
+	if serr, ok := err.(*models.SchemaError); ok {
+		return serr.Violations, nil
+	}
+	return nil, err
+}
+
+// SetSchemaRegistry validates dataset blobs against the schemas in the registry, replacing any validator set before.
+// It is not safe to call this function after initialisation.
+func (psql *DB) SetSchemaRegistry(registry *models.SchemaRegistry) {
+	psql.validator = registryValidator{registry: registry}
+}
+
+// LoadSchemas adds the schema definitions stored in the `schemas` table to the registry.
+func (db *DB) LoadSchemas(registry *models.SchemaRegistry) error {
+	return db.LoadSchemasContext(context.Background(), registry)
+}
+
+// LoadSchemasContext adds the schema definitions stored in the database to the registry within the given context.
+// Definitions that fail to compile abort the load; schemas added before the failure stay in the registry.
+func (db *DB) LoadSchemasContext(ctx context.Context, registry *models.SchemaRegistry) error {
+	rows, err := db.pool.QueryEx(ctx, "SELECT name, version, definition FROM schemas ORDER BY name, version", nil)
+	if err != nil {
+		return handleContextError(ctx, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			name       string
+			version    int
+			definition []byte
+		)
+		if err = rows.Scan(&name, &version, &definition); err != nil {
+			return handleContextError(ctx, err)
+		}
+		if err = registry.Add(name, version, definition); err != nil {
+			return err
+		}
+	}
+
+	return handleContextError(ctx, rows.Err())
+}
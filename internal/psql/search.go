@@ -0,0 +1,77 @@
+package psql
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/wvh/uuid"
+)
+
+// SearchForUid returns the datasets of a given user matching a full-text query, best matches first.
+func (db *DB) SearchForUid(uid uuid.UUID, query string, limit int) ([]*models.Dataset, error) {
+	return db.SearchForUidContext(context.Background(), uid, query, limit)
+}
+
+// SearchForUidContext returns the datasets of a given user matching a full-text query within the given context.
+//
+// The query is matched with plainto_tsquery against the `search` column, which is generated from the blob paths
+// the `dataset_search_vector` function selects for the dataset's schema; see schema.sql to change the searched fields.
+// Results are ranked by ts_rank and the limit is capped to MaxPageSize. An empty query returns no results.
+// It reads from the replica if one is configured; see WithReadConsistency.
+func (db *DB) SearchForUidContext(ctx context.Context, uid uuid.UUID, query string, limit int) (_ []*models.Dataset, err error) {
+	defer db.observe("search", time.Now(), &err)
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, nil
+	}
+	limit = clampLimit(limit)
+
+	tx, err := db.beginRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	list, err := tx.listDatasets(`
+		SELECT id, creator, owner, created, family, schema, valid
+		FROM datasets, plainto_tsquery('simple', $2) query
+		WHERE owner = $1 AND deleted IS NULL AND search @@ query
+		ORDER BY ts_rank(search, query) DESC, created DESC, id
+		LIMIT $3`,
+		uid.Array(), query, limit)
+	if err != nil {
+		return nil, handleContextError(ctx, err)
+	}
+
+	return list, nil
+}
+
+// FindForUidByPathValue returns the header fields of a user's datasets whose blob has the given string value at the given path,
+// for faceted filtering; the path is a list of object keys and array indices as for the `#>>` operator, e.g. ["language", "0", "identifier"].
+func (db *DB) FindForUidByPathValue(uid uuid.UUID, path []string, value string) ([]*DatasetMeta, error) {
+	return db.FindForUidByPathValueContext(context.Background(), uid, path, value)
+}
+
+// FindForUidByPathValueContext returns a user's datasets with the given value at the given path within the given context,
+// most recently modified first. It returns ErrInvalidKey if the path is empty or has an empty element.
+//
+// The match compares the text form of the value at the path, so numbers and booleans match their JSON representation.
+// The path is a query parameter, which expression indexes can't serve; the query relies on the owner index to limit the rows scanned.
+// It reads from the replica if one is configured; see WithReadConsistency.
+func (db *DB) FindForUidByPathValueContext(ctx context.Context, uid uuid.UUID, path []string, value string) (_ []*DatasetMeta, err error) {
+	defer db.observe("search", time.Now(), &err)
+
+	if len(path) == 0 {
+		return nil, ErrInvalidKey
+	}
+	for _, key := range path {
+		if key == "" {
+			return nil, ErrInvalidKey
+		}
+	}
+
+	return db.listMeta(ctx, "owner = $1 AND deleted IS NULL AND blob #>> $2 = $3 ORDER BY modified DESC, id", uid.Array(), path, value)
+}
@@ -0,0 +1,15 @@
+package psql
+
+import (
+	"testing"
+)
+
+func TestFindForUidByPathValueInvalidPath(t *testing.T) {
+	db := &DB{}
+
+	for _, path := range [][]string{nil, {}, {"language", ""}} {
+		if _, err := db.FindForUidByPathValue(owner, path, "fin"); err != ErrInvalidKey {
+			t.Errorf("%q: expected ErrInvalidKey, got %v", path, err)
+		}
+	}
+}
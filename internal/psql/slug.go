@@ -0,0 +1,100 @@
+package psql
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/wvh/uuid"
+)
+
+// MaxSlugLength is the maximum length of a dataset slug.
+const MaxSlugLength = 64
+
+// slugConstraint is the unique index that keeps slugs unique per owner.
+const slugConstraint = "idx_datasets_slug"
+
+// normaliseSlug lowercases a slug and joins its words with single hyphens, so "My Cool_Dataset" becomes "my-cool-dataset".
+// It returns ErrInvalidSlug if the result is empty, too long, or contains characters other than ASCII letters, digits and hyphens.
+func normaliseSlug(slug string) (string, error) {
+	words := strings.FieldsFunc(strings.ToLower(slug), func(r rune) bool {
+		return r == '-' || r == '_' || r == ' ' || r == '\t'
+	})
+	slug = strings.Join(words, "-")
+
+	if slug == "" || len(slug) > MaxSlugLength {
+		return "", ErrInvalidSlug
+	}
+	for _, r := range slug {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return "", ErrInvalidSlug
+		}
+	}
+	return slug, nil
+}
+
+// SetSlug gives a dataset owned by the given user a human-readable handle for shareable links, replacing any previous one.
+// The slug is normalised and the normalised form is returned. It returns ErrInvalidSlug if the slug isn't valid,
+// and ErrSlugTaken if another dataset of the same owner already has it.
+func (db *DB) SetSlug(id uuid.UUID, owner uuid.UUID, slug string) (string, error) {
+	return db.SetSlugContext(context.Background(), id, owner, slug)
+}
+
+// SetSlugContext sets the slug of a dataset within the given context.
+func (db *DB) SetSlugContext(ctx context.Context, id uuid.UUID, owner uuid.UUID, slug string) (_ string, err error) {
+	defer db.observe("set slug", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return "", wrapError("set slug", id, err)
+	}
+
+	slug, err = normaliseSlug(slug)
+	if err != nil {
+		return "", wrapError("set slug", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return "", wrapError("set slug", id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return "", wrapError("set slug", id, handleContextError(ctx, err))
+	}
+
+	_, err = tx.Exec("UPDATE datasets SET slug = $2 WHERE id = $1", id.Array(), slug)
+	if err != nil {
+		err = handleContextError(ctx, err)
+		if cerr, ok := err.(*ConstraintError); ok && cerr.Constraint == slugConstraint {
+			err = ErrSlugTaken
+		}
+		return "", wrapError("set slug", id, err)
+	}
+
+	return slug, wrapError("set slug", id, tx.Commit())
+}
+
+// GetBySlug retrieves a dataset by its owner and slug; the slug is normalised before the lookup.
+func (db *DB) GetBySlug(owner uuid.UUID, slug string) (*models.Dataset, error) {
+	return db.GetBySlugContext(context.Background(), owner, slug)
+}
+
+// GetBySlugContext retrieves a dataset by its owner and slug within the given context.
+// It reads from the replica if one is configured; see WithReadConsistency.
+func (db *DB) GetBySlugContext(ctx context.Context, owner uuid.UUID, slug string) (_ *models.Dataset, err error) {
+	defer db.observe("get", time.Now(), &err)
+
+	slug, err = normaliseSlug(slug)
+	if err != nil {
+		return nil, wrapError("get", uuid.UUID{}, err)
+	}
+
+	res, err := db.getDataset(ctx, datasetSelect+"owner = $1 and slug = $2 and deleted is null", owner.Array(), slug)
+	if err != nil {
+		return nil, wrapError("get", uuid.UUID{}, err)
+	}
+	return res, nil
+}
@@ -0,0 +1,30 @@
+package psql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormaliseSlug(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+		err error
+	}{
+		{in: "my-cool-dataset", out: "my-cool-dataset"},
+		{in: "My Cool_Dataset", out: "my-cool-dataset"},
+		{in: "  --climate   2019-- ", out: "climate-2019"},
+		{in: "", err: ErrInvalidSlug},
+		{in: " - _ ", err: ErrInvalidSlug},
+		{in: "kesä-data", err: ErrInvalidSlug},
+		{in: "a/b", err: ErrInvalidSlug},
+		{in: strings.Repeat("a", MaxSlugLength+1), err: ErrInvalidSlug},
+	}
+
+	for _, test := range tests {
+		out, err := normaliseSlug(test.in)
+		if err != test.err || out != test.out {
+			t.Errorf("%q: expected (%q, %v), got (%q, %v)", test.in, test.out, test.err, out, err)
+		}
+	}
+}
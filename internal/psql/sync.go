@@ -0,0 +1,77 @@
+package psql
+
+import (
+	"context"
+	"time"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/wvh/uuid"
+)
+
+// ListUnsynced returns up to limit published datasets that were modified since they were last synced to external services.
+func (db *DB) ListUnsynced(limit int) ([]*models.Dataset, error) {
+	return db.ListUnsyncedContext(context.Background(), limit)
+}
+
+// ListUnsyncedContext returns published datasets needing a sync within the given context, least recently modified first.
+// The limit is capped to MaxPageSize.
+func (db *DB) ListUnsyncedContext(ctx context.Context, limit int) ([]*models.Dataset, error) {
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	list, err := tx.fetchDatasets(`
+		SELECT id, creator, owner, created, modified, synced, seq, published, state, metax_id, modified_by, valid, family, schema, dataset_data(id, blob, blob_gz)
+		FROM datasets
+		WHERE published AND deleted IS NULL AND (synced IS NULL OR synced < modified)
+		ORDER BY modified, id
+		LIMIT $1`,
+		clampLimit(limit))
+	if err != nil {
+		return nil, handleContextError(ctx, err)
+	}
+
+	return list, nil
+}
+
+// ListOutOfSyncForUid returns the header fields of a user's published datasets that have changes not yet synced to external services,
+// so the UI can mark them as having pending changes. These are the user's datasets ListUnsynced would return.
+func (db *DB) ListOutOfSyncForUid(uid uuid.UUID) ([]*DatasetMeta, error) {
+	return db.ListOutOfSyncForUidContext(context.Background(), uid)
+}
+
+// ListOutOfSyncForUidContext returns a user's out-of-sync datasets within the given context, most recently modified first.
+// It reads from the replica if one is configured; see WithReadConsistency.
+func (db *DB) ListOutOfSyncForUidContext(ctx context.Context, uid uuid.UUID) (_ []*DatasetMeta, err error) {
+	defer db.observe("list", time.Now(), &err)
+
+	return db.listMeta(ctx, "owner = $1 AND published AND deleted IS NULL AND (synced IS NULL OR synced < modified) ORDER BY modified DESC, id", uid.Array())
+}
+
+// SyncStore saves a dataset blob as returned by an external service and marks the dataset as synced.
+func (db *DB) SyncStore(id uuid.UUID, blob []byte) error {
+	return db.SyncStoreContext(context.Background(), id, blob)
+}
+
+// SyncStoreContext saves a dataset blob from an external service within the given context.
+// The blob isn't validated, as it is the service's version of the dataset.
+func (db *DB) SyncStoreContext(ctx context.Context, id uuid.UUID, blob []byte) error {
+	if err := checkID(id); err != nil {
+		return wrapError("sync store", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("sync store", id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.updateByService(id, blob)
+	if err != nil {
+		return wrapError("sync store", id, handleContextError(ctx, err))
+	}
+
+	return wrapError("sync store", id, tx.Commit())
+}
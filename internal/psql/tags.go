@@ -0,0 +1,155 @@
+package psql
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/wvh/uuid"
+)
+
+// normaliseTag lowercases and trims a tag; it returns ErrInvalidTag if nothing is left.
+func normaliseTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", ErrInvalidTag
+	}
+	return tag, nil
+}
+
+// AddTag adds a tag to a dataset owned by the given user. Tags are lowercased; adding a tag twice has no effect.
+func (db *DB) AddTag(id uuid.UUID, owner uuid.UUID, tag string) error {
+	return db.AddTagContext(context.Background(), id, owner, tag)
+}
+
+// AddTagContext adds a tag to a dataset within the given context.
+func (db *DB) AddTagContext(ctx context.Context, id uuid.UUID, owner uuid.UUID, tag string) error {
+	return db.setTag(ctx, "add tag", id, owner, tag,
+		"UPDATE datasets SET tags = array_append(tags, $2) WHERE id = $1 AND NOT tags @> ARRAY[$2]")
+}
+
+// RemoveTag removes a tag from a dataset owned by the given user. Removing a tag the dataset doesn't have is not an error.
+func (db *DB) RemoveTag(id uuid.UUID, owner uuid.UUID, tag string) error {
+	return db.RemoveTagContext(context.Background(), id, owner, tag)
+}
+
+// RemoveTagContext removes a tag from a dataset within the given context.
+func (db *DB) RemoveTagContext(ctx context.Context, id uuid.UUID, owner uuid.UUID, tag string) error {
+	return db.setTag(ctx, "remove tag", id, owner, tag,
+		"UPDATE datasets SET tags = array_remove(tags, $2) WHERE id = $1 AND tags @> ARRAY[$2]")
+}
+
+// setTag runs a tag update query taking the dataset id and normalised tag, after checking ownership.
+func (db *DB) setTag(ctx context.Context, op string, id uuid.UUID, owner uuid.UUID, tag string, sql string) error {
+	if err := checkID(id); err != nil {
+		return wrapError(op, id, err)
+	}
+
+	tag, err := normaliseTag(tag)
+	if err != nil {
+		return wrapError(op, id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError(op, id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return wrapError(op, id, handleContextError(ctx, err))
+	}
+
+	_, err = tx.Exec(sql, id.Array(), tag)
+	if err != nil {
+		return wrapError(op, id, handleContextError(ctx, err))
+	}
+
+	return wrapError(op, id, tx.Commit())
+}
+
+// AddTagMany adds a tag to those of the given datasets that are owned by the user, for tagging a selection at once.
+// It returns the number of datasets that got the tag; datasets that already have it, or aren't owned by the user, are skipped.
+func (db *DB) AddTagMany(ids []uuid.UUID, owner uuid.UUID, tag string) (int64, error) {
+	return db.AddTagManyContext(context.Background(), ids, owner, tag)
+}
+
+// AddTagManyContext adds a tag to several datasets within the given context.
+func (db *DB) AddTagManyContext(ctx context.Context, ids []uuid.UUID, owner uuid.UUID, tag string) (int64, error) {
+	return db.setTagMany(ctx, "add tag", ids, owner, tag,
+		"UPDATE datasets SET tags = array_append(tags, $2) WHERE id = ANY($1) AND owner = $3 AND deleted IS NULL AND NOT tags @> ARRAY[$2]")
+}
+
+// RemoveTagMany removes a tag from those of the given datasets that are owned by the user.
+// It returns the number of datasets the tag was removed from.
+func (db *DB) RemoveTagMany(ids []uuid.UUID, owner uuid.UUID, tag string) (int64, error) {
+	return db.RemoveTagManyContext(context.Background(), ids, owner, tag)
+}
+
+// RemoveTagManyContext removes a tag from several datasets within the given context.
+func (db *DB) RemoveTagManyContext(ctx context.Context, ids []uuid.UUID, owner uuid.UUID, tag string) (int64, error) {
+	return db.setTagMany(ctx, "remove tag", ids, owner, tag,
+		"UPDATE datasets SET tags = array_remove(tags, $2) WHERE id = ANY($1) AND owner = $3 AND deleted IS NULL AND tags @> ARRAY[$2]")
+}
+
+// setTagMany runs a tag update query taking an array of dataset ids, the normalised tag and the owner, and returns the number of rows changed.
+// Ownership is part of the query, so datasets owned by someone else are silently left alone.
+func (db *DB) setTagMany(ctx context.Context, op string, ids []uuid.UUID, owner uuid.UUID, tag string, sql string) (_ int64, err error) {
+	defer db.observe(op, time.Now(), &err)
+
+	tag, err = normaliseTag(tag)
+	if err != nil {
+		return 0, wrapError(op, uuid.UUID{}, err)
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	arrays, err := idArrays(op, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	ct, err := db.pool.ExecEx(ctx, sql, nil, arrays, tag, owner.Array())
+	if err != nil {
+		return 0, wrapError(op, uuid.UUID{}, handleContextError(ctx, err))
+	}
+	return ct.RowsAffected(), nil
+}
+
+// ListForUidByTag returns the datasets for a given user that have the given tag.
+func (db *DB) ListForUidByTag(uid uuid.UUID, tag string) ([]*models.Dataset, error) {
+	return db.ListForUidByTagContext(context.Background(), uid, tag)
+}
+
+// ListForUidByTagContext returns the datasets for a given user with the given tag within the given context.
+// Datasets are ordered by creation date with the newest first.
+func (db *DB) ListForUidByTagContext(ctx context.Context, uid uuid.UUID, tag string) (_ []*models.Dataset, err error) {
+	defer db.observe("list", time.Now(), &err)
+
+	tag, err = normaliseTag(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.beginRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	list, err := tx.listDatasets(`
+		SELECT id, creator, owner, created, family, schema, valid
+		FROM datasets
+		WHERE owner = $1 AND deleted IS NULL AND tags @> ARRAY[$2]
+		ORDER BY created DESC, id`,
+		uid.Array(), tag)
+	if err != nil {
+		return nil, handleContextError(ctx, err)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,41 @@
+package psql
+
+import (
+	"testing"
+
+	"github.com/wvh/uuid"
+)
+
+func TestNormaliseTag(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+		err error
+	}{
+		{in: "Climate", out: "climate"},
+		{in: "  field work ", out: "field work"},
+		{in: "   ", err: ErrInvalidTag},
+		{in: "", err: ErrInvalidTag},
+	}
+
+	for _, test := range tests {
+		out, err := normaliseTag(test.in)
+		if err != test.err || out != test.out {
+			t.Errorf("%q: expected (%q, %v), got (%q, %v)", test.in, test.out, test.err, out, err)
+		}
+	}
+}
+
+func TestSetTagManyEmpty(t *testing.T) {
+	db := &DB{}
+
+	n, err := db.AddTagMany(nil, uuid.UUID{}, "climate")
+	if err != nil || n != 0 {
+		t.Errorf("expected (0, nil) for no ids, got (%d, %v)", n, err)
+	}
+
+	_, err = db.RemoveTagMany(nil, uuid.UUID{}, "  ")
+	if Cause(err) != ErrInvalidTag {
+		t.Errorf("expected ErrInvalidTag, got %v", err)
+	}
+}
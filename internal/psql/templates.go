@@ -0,0 +1,107 @@
+package psql
+
+import (
+	"context"
+	"time"
+
+	"github.com/wvh/uuid"
+)
+
+// SetTemplate flags a dataset owned by the given user as a template, which other users can copy with CopyToUser, or clears the flag.
+func (db *DB) SetTemplate(id uuid.UUID, owner uuid.UUID, isTemplate bool) error {
+	return db.SetTemplateContext(context.Background(), id, owner, isTemplate)
+}
+
+// SetTemplateContext sets or clears the template flag of a dataset within the given context.
+func (db *DB) SetTemplateContext(ctx context.Context, id uuid.UUID, owner uuid.UUID, isTemplate bool) (err error) {
+	defer db.observe("set template", time.Now(), &err)
+
+	if err := checkID(id); err != nil {
+		return wrapError("set template", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("set template", id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return wrapError("set template", id, handleContextError(ctx, err))
+	}
+
+	_, err = tx.Exec("UPDATE datasets SET is_template = $2 WHERE id = $1", id.Array(), isTemplate)
+	if err != nil {
+		return wrapError("set template", id, handleContextError(ctx, err))
+	}
+
+	return wrapError("set template", id, tx.Commit())
+}
+
+// CopyToUser copies a dataset into the account of the given user as a new unpublished draft created and owned by that user,
+// and returns its newly generated id. Family, schema and blob are copied; publication state, tags, slug and template flag are not.
+// Users can copy their own datasets and datasets flagged as template; other datasets return ErrNotOwner.
+func (db *DB) CopyToUser(srcID uuid.UUID, newOwner uuid.UUID) (uuid.UUID, error) {
+	return db.CopyToUserContext(context.Background(), srcID, newOwner)
+}
+
+// CopyToUserContext copies a dataset into the account of the given user within the given context.
+// The copy counts towards the user's quota and is validated like a new dataset.
+func (db *DB) CopyToUserContext(ctx context.Context, srcID uuid.UUID, newOwner uuid.UUID) (_ uuid.UUID, err error) {
+	defer db.observe("copy", time.Now(), &err)
+
+	if err := checkID(srcID); err != nil {
+		return uuid.UUID{}, wrapError("copy", srcID, err)
+	}
+
+	newID, err := db.newID()
+	if err != nil {
+		return uuid.UUID{}, wrapError("copy", srcID, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return uuid.UUID{}, wrapError("copy", srcID, err)
+	}
+	defer tx.Rollback()
+
+	var (
+		owner      uuid.UUID
+		isTemplate bool
+	)
+	err = tx.QueryRow("SELECT owner, is_template FROM datasets WHERE id = $1 AND deleted IS NULL", srcID.Array()).Scan(owner.Array(), &isTemplate)
+	if err != nil {
+		return uuid.UUID{}, wrapError("copy", srcID, handleContextError(ctx, err))
+	}
+	if owner != newOwner && !isTemplate {
+		return uuid.UUID{}, wrapError("copy", srcID, ErrNotOwner)
+	}
+
+	if err = tx.checkQuota(newOwner); err != nil {
+		return uuid.UUID{}, wrapError("copy", srcID, handleContextError(ctx, err))
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO datasets(id, creator, owner, published, synced, family, schema, blob, blob_gz, compressed)
+		(SELECT $2, $3, $3, false, NULL, family, schema, dataset_blob(id, blob), blob_gz, compressed FROM datasets WHERE id = $1)`,
+		srcID.Array(), newID.Array(), newOwner.Array())
+	if err != nil {
+		return uuid.UUID{}, wrapError("copy", srcID, handleContextError(ctx, err))
+	}
+
+	err = tx.checkStoredSize(newID)
+	if err != nil {
+		return uuid.UUID{}, wrapError("copy", srcID, handleContextError(ctx, err))
+	}
+
+	err = tx.validateStored(newID)
+	if err != nil {
+		return uuid.UUID{}, wrapError("copy", srcID, handleContextError(ctx, err))
+	}
+
+	if err = tx.Commit(); err != nil {
+		return uuid.UUID{}, wrapError("copy", srcID, err)
+	}
+	return newID, nil
+}
@@ -0,0 +1,28 @@
+package psql
+
+import (
+	"strings"
+
+	"github.com/jackc/pgx"
+)
+
+// connConfig returns a copy of the connection configuration with the search path set to the configured Schema, if any,
+// so unqualified table names in queries resolve to that schema.
+func (psql *DB) connConfig(config pgx.ConnConfig) pgx.ConnConfig {
+	if psql.Schema == "" {
+		return config
+	}
+
+	params := make(map[string]string, len(config.RuntimeParams)+1)
+	for k, v := range config.RuntimeParams {
+		params[k] = v
+	}
+	params["search_path"] = quoteIdentifier(psql.Schema)
+	config.RuntimeParams = params
+	return config
+}
+
+// quoteIdentifier quotes a name for use as SQL identifier.
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
@@ -0,0 +1,81 @@
+package psql
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/jackc/pgx"
+)
+
+func TestConnConfig(t *testing.T) {
+	base := pgx.ConnConfig{RuntimeParams: map[string]string{"application_name": "qvain"}}
+
+	db := &DB{}
+	if config := db.connConfig(base); config.RuntimeParams["search_path"] != "" {
+		t.Errorf("no schema: expected no search path, got %q", config.RuntimeParams["search_path"])
+	}
+
+	db.Schema = `tenant"a`
+	config := db.connConfig(base)
+	if path := config.RuntimeParams["search_path"]; path != `"tenant""a"` {
+		t.Errorf("search path: expected %q, got %q", `"tenant""a"`, path)
+	}
+	if config.RuntimeParams["application_name"] != "qvain" {
+		t.Error("existing runtime parameters were not kept")
+	}
+	if _, ok := base.RuntimeParams["search_path"]; ok {
+		t.Error("original runtime parameters were modified")
+	}
+}
+
+// TestSchemaIsolation tests that datasets created in one schema are not visible from another.
+func TestSchemaIsolation(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	admin, err := NewPoolServiceFromEnv()
+	if err != nil {
+		t.Fatal("psql:", err)
+	}
+
+	tenants := []string{"qvain_test_tenant_a", "qvain_test_tenant_b"}
+	dbs := make([]*DB, len(tenants))
+	for i, schema := range tenants {
+		_, err = admin.pool.Exec("CREATE SCHEMA " + quoteIdentifier(schema) + "; CREATE TABLE " + quoteIdentifier(schema) + ".datasets (LIKE public.datasets INCLUDING ALL)")
+		if err != nil {
+			t.Fatal("create schema:", err)
+		}
+		defer admin.pool.Exec("DROP SCHEMA " + quoteIdentifier(schema) + " CASCADE")
+
+		dbs[i], err = NewServiceFromEnv()
+		if err != nil {
+			t.Fatal("psql:", err)
+		}
+		dbs[i].Schema = schema
+		if err = dbs[i].InitPool(); err != nil {
+			t.Fatal("psql:", err)
+		}
+	}
+
+	dataset, err := models.NewDataset(owner)
+	if err != nil {
+		t.Fatal("models.NewDataset():", err)
+	}
+	dataset.SetData(1, "open test dataset", []byte(`{"title":"tenant test"}`))
+
+	if err = dbs[0].Create(dataset); err != nil {
+		t.Fatal("db.Create():", err)
+	}
+
+	if _, err = dbs[0].Get(dataset.Id); err != nil {
+		t.Errorf("own schema: expected dataset, got %v", err)
+	}
+	if _, err = dbs[1].Get(dataset.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("other schema: expected %v, got %v", ErrNotFound, err)
+	}
+	if _, err = admin.Get(dataset.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("default schema: expected %v, got %v", ErrNotFound, err)
+	}
+}
@@ -0,0 +1,31 @@
+package psql
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// statementTimeoutKey is the context key for a per-call statement timeout.
+type statementTimeoutKey struct{}
+
+// WithStatementTimeout returns a context that makes methods called with it use the given statement timeout
+// instead of DB.StatementTimeout. A zero duration disables the timeout for the call.
+func WithStatementTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, statementTimeoutKey{}, timeout)
+}
+
+// statementTimeout returns the statement timeout for a call: the context's override if set, the database default otherwise.
+func (psql *DB) statementTimeout(ctx context.Context) time.Duration {
+	if timeout, ok := ctx.Value(statementTimeoutKey{}).(time.Duration); ok {
+		return timeout
+	}
+	return psql.StatementTimeout
+}
+
+// setStatementTimeout limits the run time of each statement in the transaction; statements running longer fail with ErrTimeout.
+func (tx *Tx) setStatementTimeout(timeout time.Duration) error {
+	// SET doesn't take parameters
+	_, err := tx.Exec("SET LOCAL statement_timeout = " + strconv.FormatInt(int64(timeout/time.Millisecond), 10))
+	return err
+}
@@ -0,0 +1,119 @@
+package psql
+
+import (
+	"context"
+	"time"
+
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/wvh/uuid"
+)
+
+// Creator is the display information of a dataset's creator.
+// Name and Email are empty if the creator hasn't logged in since user info started being recorded.
+type Creator struct {
+	Id    uuid.UUID `json:"id"`
+	Name  string    `json:"name,omitempty"`
+	Email string    `json:"email,omitempty"`
+}
+
+// DatasetWithCreator is a dataset listing entry with its creator's display information.
+type DatasetWithCreator struct {
+	Dataset *models.Dataset
+	Creator Creator
+}
+
+// UpdateUserInfo records the display name and email address of a user, for instance on login.
+func (db *DB) UpdateUserInfo(uid uuid.UUID, name, email string) error {
+	return db.UpdateUserInfoContext(context.Background(), uid, name, email)
+}
+
+// UpdateUserInfoContext records the display name and email address of a user within the given context.
+func (db *DB) UpdateUserInfoContext(ctx context.Context, uid uuid.UUID, name, email string) error {
+	_, err := db.pool.ExecEx(ctx, `
+		INSERT INTO users(id, name, email) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, email = EXCLUDED.email, updated = now()`,
+		nil, uid.Array(), name, email)
+	return handleContextError(ctx, err)
+}
+
+// checkUser returns ErrUnknownUser if the given uid isn't a registered application user.
+func (tx *Tx) checkUser(uid uuid.UUID) error {
+	if uid == (uuid.UUID{}) {
+		return ErrUnknownUser
+	}
+
+	var exists bool
+	err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM identities WHERE uid = $1)", uid.Array()).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUnknownUser
+	}
+	return nil
+}
+
+// ListForUidWithCreator returns the datasets for a given user along with the name and email of each dataset's creator.
+func (db *DB) ListForUidWithCreator(uid uuid.UUID) ([]DatasetWithCreator, error) {
+	return db.ListForUidWithCreatorContext(context.Background(), uid)
+}
+
+// ListForUidWithCreatorContext returns the datasets for a given user with creator information within the given context.
+// Datasets are ordered by creation date with the newest first.
+func (db *DB) ListForUidWithCreatorContext(ctx context.Context, uid uuid.UUID) ([]DatasetWithCreator, error) {
+	tx, err := db.beginRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT d.id, d.creator, d.owner, d.created, d.family, d.schema, d.valid, u.name, u.email
+		FROM datasets d
+		LEFT JOIN users u ON u.id = d.creator
+		WHERE d.owner = $1 AND d.deleted IS NULL
+		ORDER BY d.created DESC, d.id`,
+		uid.Array())
+	if err != nil {
+		return nil, handleContextError(ctx, err)
+	}
+	defer rows.Close()
+
+	var list []DatasetWithCreator
+	for rows.Next() {
+		var (
+			dataset     models.Dataset
+			created     *time.Time
+			family      int
+			schema      string
+			valid       bool
+			name, email *string
+		)
+		err = rows.Scan(dataset.Id.Array(), dataset.Creator.Array(), dataset.Owner.Array(), &created, &family, &schema, &valid, &name, &email)
+		if err != nil {
+			return nil, handleContextError(ctx, err)
+		}
+		if created != nil {
+			dataset.Created = *created
+		}
+		if err = dataset.SetData(models.Family(family), schema, nil); err != nil {
+			return nil, err
+		}
+		dataset.SetValid(valid)
+
+		entry := DatasetWithCreator{Dataset: &dataset, Creator: Creator{Id: dataset.Creator}}
+		if name != nil {
+			entry.Creator.Name = *name
+		}
+		if email != nil {
+			entry.Creator.Email = *email
+		}
+		list = append(list, entry)
+	}
+
+	if rows.Err() != nil {
+		return nil, handleContextError(ctx, rows.Err())
+	}
+
+	return list, nil
+}
@@ -0,0 +1,293 @@
+package psql
+
+import (
+	"context"
+	"strings"
+
+	"github.com/CSCfi/qvain-api/pkg/jsonschema"
+	"github.com/wvh/uuid"
+)
+
+// Validator checks a dataset blob against the schema with the given name and returns a list of violations.
+// It should return jsonschema.ErrUnknownSchema if it has no schema by that name; such datasets are stored but not marked valid.
+//
+// A *jsonschema.Registry satisfies this interface.
+type Validator interface {
+	Validate(schema string, blob []byte) ([]string, error)
+}
+
+// FieldViolation is a single schema violation; Path is a JSON pointer to the offending value, `/` for the document root.
+type FieldViolation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// String formats the violation as reported by the validator.
+func (v FieldViolation) String() string {
+	return v.Path + ": " + v.Message
+}
+
+// parseViolation splits a violation of the form `pointer: message` as returned by the jsonschema package.
+// A violation without pointer is reported for the document root.
+func parseViolation(violation string) FieldViolation {
+	if strings.HasPrefix(violation, "/") {
+		if sep := strings.Index(violation, ": "); sep >= 0 {
+			return FieldViolation{Path: violation[:sep], Message: violation[sep+2:]}
+		}
+	}
+	return FieldViolation{Path: "/", Message: violation}
+}
+
+// ValidationError is returned when a dataset blob doesn't conform to its schema.
+// It lists the violations by field, so clients can point out the offending values;
+// use errors.As to get at it through the operation annotations.
+type ValidationError struct {
+	Schema     string
+	Violations []FieldViolation
+}
+
+// newValidationError builds a ValidationError from the validator's violation strings.
+func newValidationError(schema string, violations []string) *ValidationError {
+	verr := &ValidationError{Schema: schema, Violations: make([]FieldViolation, len(violations))}
+	for i := range violations {
+		verr.Violations[i] = parseViolation(violations[i])
+	}
+	return verr
+}
+
+// Error satisfies Go's Error interface.
+func (e *ValidationError) Error() string {
+	violations := make([]string, len(e.Violations))
+	for i := range e.Violations {
+		violations[i] = e.Violations[i].String()
+	}
+	return "validation failed: " + strings.Join(violations, "; ")
+}
+
+// SetValidator sets the validator used to check dataset blobs before they are saved.
+// It is not safe to call this function after initialisation.
+func (psql *DB) SetValidator(validator Validator) {
+	psql.validator = validator
+}
+
+// SetValidation enables or disables schema validation, for instance to speed up tests or bulk imports.
+// Validation is enabled by default but has no effect until a validator is set.
+// It is not safe to call this function after initialisation.
+func (psql *DB) SetValidation(enabled bool) {
+	psql.validation = enabled
+}
+
+// Validate checks a blob against the named schema without storing anything, for instance to give feedback while a dataset is edited.
+// It runs the same checks as Create: ErrInvalidJson is returned for malformed JSON, ErrBlobTooLarge for oversized blobs
+// and a *ValidationError if the blob doesn't conform to the schema. Like Create, it returns nil if validation is disabled
+// or the schema is unknown.
+func (db *DB) Validate(schema string, blob []byte) error {
+	if err := checkBlob(blob); err != nil {
+		return err
+	}
+
+	// a bare transaction value carries the same settings as the ones BeginContext starts, without touching the database
+	tx := &Tx{maxBlobBytes: db.MaxBlobBytes}
+	if db.validation {
+		tx.validator = db.validator
+	}
+
+	if err := tx.checkBlobSize(len(blob)); err != nil {
+		return err
+	}
+
+	_, err := tx.validate(schema, blob)
+	return err
+}
+
+// validate checks a blob against the named schema.
+// It returns nil if validation is disabled or the schema is unknown, a pointer to true if the blob is valid,
+// and a *ValidationError if it isn't.
+func (tx *Tx) validate(schema string, blob []byte) (*bool, error) {
+	if tx.validator == nil {
+		return nil, nil
+	}
+
+	violations, err := tx.validator.Validate(schema, blob)
+	if err == jsonschema.ErrUnknownSchema {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ErrInvalidJson
+	}
+
+	if len(violations) > 0 {
+		return nil, newValidationError(schema, violations)
+	}
+
+	valid := true
+	return &valid, nil
+}
+
+// validateForUpdate looks up the schema of an existing dataset and validates a new blob for it.
+func (tx *Tx) validateForUpdate(id uuid.UUID, blob []byte) (*bool, error) {
+	if tx.validator == nil {
+		return nil, nil
+	}
+
+	schema, err := tx.getSchema(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.validate(schema, blob)
+}
+
+// validateStored validates the blob as currently stored in the transaction and updates the valid column.
+// Use this after operations that compute the new blob in the database, such as patches.
+func (tx *Tx) validateStored(id uuid.UUID) error {
+	if tx.validator == nil {
+		return nil
+	}
+
+	var (
+		schema string
+		blob   []byte
+	)
+	err := tx.QueryRow("SELECT schema, "+storedBlob+" FROM datasets WHERE id = $1", id.Array()).Scan(&schema, &blob)
+	if err != nil {
+		return err
+	}
+
+	blob, err = decompressBlob(blob)
+	if err != nil {
+		return err
+	}
+
+	valid, err := tx.validate(schema, blob)
+	if err != nil || valid == nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE datasets SET valid = $2 WHERE id = $1", id.Array(), *valid)
+	return err
+}
+
+// revalidateBatchSize is the number of datasets revalidated per transaction, to avoid locking all of a user's datasets at once.
+const revalidateBatchSize = 100
+
+// RevalidateForUid validates all datasets of a user against the current schemas and updates their valid flag,
+// returning the number of datasets whose flag changed. Use this after deploying stricter schemas.
+// Datasets with an unknown schema are left alone; nothing is done if no validator is set.
+func (db *DB) RevalidateForUid(uid uuid.UUID) (int, error) {
+	return db.RevalidateForUidContext(context.Background(), uid)
+}
+
+// RevalidateForUidContext validates all datasets of a user and updates their valid flag within the given context.
+// Datasets are processed in batches, each in its own transaction; an error leaves earlier batches committed.
+func (db *DB) RevalidateForUidContext(ctx context.Context, uid uuid.UUID) (int, error) {
+	if db.validator == nil || !db.validation {
+		return 0, nil
+	}
+
+	var ids [][16]byte
+	rows, err := db.pool.QueryEx(ctx, "SELECT id FROM datasets WHERE owner = $1 AND deleted IS NULL ORDER BY id", nil, uid.Array())
+	if err != nil {
+		return 0, handleContextError(ctx, err)
+	}
+	for rows.Next() {
+		var id [16]byte
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, handleContextError(ctx, err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return 0, handleContextError(ctx, rows.Err())
+	}
+
+	flipped := 0
+	for start := 0; start < len(ids); start += revalidateBatchSize {
+		end := start + revalidateBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		n, err := db.revalidate(ctx, ids[start:end])
+		flipped += n
+		if err != nil {
+			return flipped, err
+		}
+	}
+
+	return flipped, nil
+}
+
+// revalidate validates a batch of datasets in one transaction and returns the number of changed valid flags.
+func (db *DB) revalidate(ctx context.Context, ids [][16]byte) (int, error) {
+	type record struct {
+		id     [16]byte
+		schema string
+		blob   []byte
+		valid  bool
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var records []record
+	rows, err := tx.Query("SELECT id, schema, "+storedBlob+", coalesce(valid, false) FROM datasets WHERE id = any($1) FOR UPDATE", ids)
+	if err != nil {
+		return 0, handleContextError(ctx, err)
+	}
+	for rows.Next() {
+		var rec record
+		if err = rows.Scan(&rec.id, &rec.schema, &rec.blob, &rec.valid); err != nil {
+			rows.Close()
+			return 0, handleContextError(ctx, err)
+		}
+		records = append(records, rec)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return 0, handleContextError(ctx, rows.Err())
+	}
+
+	flipped := 0
+	for _, rec := range records {
+		var valid bool
+
+		blob, err := decompressBlob(rec.blob)
+		if err != nil {
+			return 0, err
+		}
+
+		isValid, err := tx.validate(rec.schema, blob)
+		switch {
+		case err != nil:
+			// violations or a blob that isn't valid JSON
+			valid = false
+		case isValid == nil:
+			// unknown schema
+			continue
+		default:
+			valid = *isValid
+		}
+
+		if valid == rec.valid {
+			continue
+		}
+
+		_, err = tx.Exec("UPDATE datasets SET valid = $2 WHERE id = $1", rec.id, valid)
+		if err != nil {
+			return 0, handleContextError(ctx, err)
+		}
+		flipped++
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return flipped, nil
+}
@@ -0,0 +1,75 @@
+package psql
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/CSCfi/qvain-api/pkg/jsonschema"
+	"github.com/wvh/uuid"
+)
+
+func TestValidationError(t *testing.T) {
+	verr := newValidationError("test", []string{
+		"/: missing required property \"title\"",
+		"/keywords/1: expected string, got number",
+		"invalid number",
+	})
+
+	expected := []FieldViolation{
+		{Path: "/", Message: "missing required property \"title\""},
+		{Path: "/keywords/1", Message: "expected string, got number"},
+		{Path: "/", Message: "invalid number"},
+	}
+	if !reflect.DeepEqual(verr.Violations, expected) {
+		t.Errorf("expected %v, got %v", expected, verr.Violations)
+	}
+
+	err := wrapError("update", uuid.MustFromString("053bffbcc41edad4853bea91fc42ea18"), verr)
+	var ve *ValidationError
+	if !errors.As(err, &ve) || ve != verr {
+		t.Errorf("expected errors.As to find the validation error in %v", err)
+	}
+}
+
+// titleValidator requires a top-level title and knows only the "test" schema.
+type titleValidator struct{}
+
+func (titleValidator) Validate(schema string, blob []byte) ([]string, error) {
+	if schema != "test" {
+		return nil, jsonschema.ErrUnknownSchema
+	}
+	if !bytes.Contains(blob, []byte(`"title"`)) {
+		return []string{`/: missing required property "title"`}, nil
+	}
+	return nil, nil
+}
+
+func TestValidate(t *testing.T) {
+	db := &DB{validation: true, MaxBlobBytes: 32}
+	db.SetValidator(titleValidator{})
+
+	if err := db.Validate("test", []byte(`{"title":"a"}`)); err != nil {
+		t.Errorf("valid blob: expected no error, got %v", err)
+	}
+	if err := db.Validate("other", []byte(`{}`)); err != nil {
+		t.Errorf("unknown schema: expected no error, got %v", err)
+	}
+	if err := db.Validate("test", []byte(`{"title":`)); err != ErrInvalidJson {
+		t.Errorf("malformed blob: expected %v, got %v", ErrInvalidJson, err)
+	}
+	if err := db.Validate("test", []byte(`{"title":"a very long title that doesn't fit"}`)); err != ErrBlobTooLarge {
+		t.Errorf("large blob: expected %v, got %v", ErrBlobTooLarge, err)
+	}
+
+	var verr *ValidationError
+	if err := db.Validate("test", []byte(`{}`)); !errors.As(err, &verr) || len(verr.Violations) != 1 {
+		t.Errorf("invalid blob: expected a validation error, got %v", err)
+	}
+
+	db.SetValidation(false)
+	if err := db.Validate("test", []byte(`{}`)); err != nil {
+		t.Errorf("validation disabled: expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package psql
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/CSCfi/qvain-api/pkg/jsonpatch"
+	"github.com/wvh/uuid"
+)
+
+// DatasetVersion is an earlier blob of a dataset from the version history.
+//
+// The `datasets_archive` trigger saves the previous blob whenever a dataset's blob changes,
+// so Seq is the sequence number the dataset had while it held this blob.
+type DatasetVersion struct {
+	Id    uuid.UUID
+	Seq   int64
+	Saved time.Time
+	Blob  json.RawMessage
+}
+
+// GetVersion retrieves an earlier version of a dataset by sequence number.
+func (db *DB) GetVersion(id uuid.UUID, seq int64) (*DatasetVersion, error) {
+	return db.GetVersionContext(context.Background(), id, seq)
+}
+
+// GetVersionContext retrieves an earlier version of a dataset within the given context.
+func (db *DB) GetVersionContext(ctx context.Context, id uuid.UUID, seq int64) (*DatasetVersion, error) {
+	if err := checkID(id); err != nil {
+		return nil, wrapError("get version", id, err)
+	}
+
+	var blob []byte
+
+	version := &DatasetVersion{Id: id, Seq: seq}
+	err := db.pool.QueryRowEx(ctx, "SELECT saved, "+storedBlob+" FROM dataset_versions WHERE id = $1 AND seq = $2", nil, id.Array(), seq).Scan(&version.Saved, &blob)
+	if err != nil {
+		return nil, wrapError("get version", id, handleContextError(ctx, err))
+	}
+
+	blob, err = decompressBlob(blob)
+	if err != nil {
+		return nil, wrapError("get version", id, err)
+	}
+	version.Blob = blob
+
+	return version, nil
+}
+
+// Rollback restores an earlier version of a dataset if the owner matches.
+// The restored blob is saved as a new version, so the rollback itself can be undone.
+func (db *DB) Rollback(id uuid.UUID, toSeq int64, owner uuid.UUID) error {
+	return db.RollbackContext(context.Background(), id, toSeq, owner)
+}
+
+// RollbackContext restores an earlier version of a dataset within the given context.
+func (db *DB) RollbackContext(ctx context.Context, id uuid.UUID, toSeq int64, owner uuid.UUID) error {
+	if err := checkID(id); err != nil {
+		return wrapError("rollback", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return wrapError("rollback", id, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.CheckOwner(id, owner)
+	if err != nil {
+		return wrapError("rollback", id, handleContextError(ctx, err))
+	}
+
+	var blob []byte
+	err = tx.QueryRow("SELECT "+storedBlob+" FROM dataset_versions WHERE id = $1 AND seq = $2", id.Array(), toSeq).Scan(&blob)
+	if err != nil {
+		return wrapError("rollback", id, handleContextError(ctx, err))
+	}
+
+	blob, err = decompressBlob(blob)
+	if err != nil {
+		return wrapError("rollback", id, err)
+	}
+
+	err = tx.Update(id, blob, &owner)
+	if err != nil {
+		return wrapError("rollback", id, handleContextError(ctx, err))
+	}
+
+	return wrapError("rollback", id, tx.Commit())
+}
+
+// PruneVersions deletes all but the newest `keep` versions of a dataset from the history and returns the number deleted.
+func (db *DB) PruneVersions(id uuid.UUID, keep int) (int64, error) {
+	return db.PruneVersionsContext(context.Background(), id, keep)
+}
+
+// PruneVersionsContext deletes all but the newest `keep` versions of a dataset within the given context.
+func (db *DB) PruneVersionsContext(ctx context.Context, id uuid.UUID, keep int) (int64, error) {
+	if err := checkID(id); err != nil {
+		return 0, wrapError("prune versions", id, err)
+	}
+
+	if keep < 0 {
+		keep = 0
+	}
+
+	ct, err := db.pool.ExecEx(ctx, `
+		DELETE FROM dataset_versions
+		WHERE id = $1 AND seq NOT IN (
+			SELECT seq FROM dataset_versions WHERE id = $1 ORDER BY seq DESC LIMIT $2
+		)`,
+		nil, id.Array(), keep)
+	if err != nil {
+		return 0, wrapError("prune versions", id, handleContextError(ctx, err))
+	}
+
+	return ct.RowsAffected(), nil
+}
+
+// DiffVersions returns an RFC 6902 JSON Patch document describing the changes from one version of a dataset to another.
+// Either sequence number can also be the dataset's current one. It returns ErrNotFound if either version is missing.
+func (db *DB) DiffVersions(id uuid.UUID, fromSeq, toSeq int64) (json.RawMessage, error) {
+	return db.DiffVersionsContext(context.Background(), id, fromSeq, toSeq)
+}
+
+// DiffVersionsContext returns a JSON Patch document describing the changes between two versions within the given context.
+func (db *DB) DiffVersionsContext(ctx context.Context, id uuid.UUID, fromSeq, toSeq int64) (json.RawMessage, error) {
+	if err := checkID(id); err != nil {
+		return nil, wrapError("diff versions", id, err)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return nil, wrapError("diff versions", id, err)
+	}
+	defer tx.Rollback()
+
+	from, err := tx.versionBlob(id, fromSeq)
+	if err != nil {
+		return nil, wrapError("diff versions", id, handleContextError(ctx, err))
+	}
+
+	to, err := tx.versionBlob(id, toSeq)
+	if err != nil {
+		return nil, wrapError("diff versions", id, handleContextError(ctx, err))
+	}
+
+	patch, err := jsonpatch.Diff(from, to)
+	if err != nil {
+		return nil, wrapError("diff versions", id, ErrInvalidJson)
+	}
+
+	return patch, nil
+}
+
+// versionBlob returns the blob of a dataset version from the history or, failing that, the current blob if the sequence number matches.
+func (tx *Tx) versionBlob(id uuid.UUID, seq int64) ([]byte, error) {
+	var blob []byte
+	err := tx.QueryRow(`
+		SELECT `+storedBlob+` FROM dataset_versions WHERE id = $1 AND seq = $2
+		UNION ALL
+		SELECT dataset_data(id, blob, blob_gz) FROM datasets WHERE id = $1 AND seq = $2
+		LIMIT 1`,
+		id.Array(), seq).Scan(&blob)
+	if err != nil {
+		return nil, err
+	}
+
+	return decompressBlob(blob)
+}
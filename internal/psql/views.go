@@ -1,6 +1,7 @@
 package psql
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/CSCfi/qvain-api/pkg/models"
@@ -12,14 +13,19 @@ var apiEmptyList = json.RawMessage([]byte(`[]`))
 
 // ViewDatasetsByOwner builds a JSON array with the datasets for a given owner.
 func (db *DB) ViewDatasetsByOwner(owner uuid.UUID) (json.RawMessage, error) {
+	return db.ViewDatasetsByOwnerContext(context.Background(), owner)
+}
+
+// ViewDatasetsByOwnerContext builds a JSON array with the datasets for a given owner within the given context.
+func (db *DB) ViewDatasetsByOwnerContext(ctx context.Context, owner uuid.UUID) (json.RawMessage, error) {
 	var result json.RawMessage
 
 	// note that if there are no results, json_agg will return NULL;
 	// we could also catch NULLs by wrapping json_agg with coalesce: coalesce(json_agg(result), '[]')
-	err := db.pool.QueryRow(`
+	err := db.pool.QueryRowEx(ctx, `
 		SELECT json_agg(result) "by_owner"
 		FROM (
-			SELECT id, owner, created, modified, seq, published,
+			SELECT id, owner, created, modified, seq, published, state,
 				blob#>'{identifier}' identifier,
 				blob#>'{research_dataset,title}' title,
 				blob#>'{research_dataset,description}' description,
@@ -28,11 +34,11 @@ func (db *DB) ViewDatasetsByOwner(owner uuid.UUID) (json.RawMessage, error) {
 				blob#>'{next_dataset_version,identifier}' "next",
 				jsonb_array_length(coalesce(blob#>'{dataset_version_set}', '[]')) versions
 			FROM datasets
-			WHERE owner = $1
+			WHERE owner = $1 AND deleted IS NULL
 		) result
-	`, owner.Array()).Scan(&result)
+	`, nil, owner.Array()).Scan(&result)
 	if err != nil {
-		return apiEmptyList, handleError(err)
+		return apiEmptyList, handleContextError(ctx, err)
 	}
 
 	// this shouldn't happen, result should be a literal null or array; return an error?
@@ -51,18 +57,24 @@ func (db *DB) ViewDatasetsByOwner(owner uuid.UUID) (json.RawMessage, error) {
 
 // ViewVersions returns a (JSON) array with existing versions for a given dataset and owner.
 func (db *DB) ViewVersions(owner uuid.UUID, dataset uuid.UUID) (json.RawMessage, error) {
+	return db.ViewVersionsContext(context.Background(), owner, dataset)
+}
+
+// ViewVersionsContext returns a (JSON) array with existing versions for a given dataset and owner within the given context.
+func (db *DB) ViewVersionsContext(ctx context.Context, owner uuid.UUID, dataset uuid.UUID) (json.RawMessage, error) {
 	var (
 		isOwner   bool
 		jsonArray json.RawMessage
 	)
 
-	err := db.pool.QueryRow(
+	err := db.pool.QueryRowEx(ctx,
 		`SELECT owner = $1 "is_owner", CASE WHEN owner = $1 AND jsonb_array_length(blob->'dataset_version_set') > 0 THEN blob->'dataset_version_set' ELSE '[]'::jsonb END versions FROM datasets WHERE id = $2`,
+		nil,
 		owner.Array(),
 		dataset.Array(),
 	).Scan(&isOwner, &jsonArray)
 	if err != nil {
-		return apiEmptyList, handleError(err)
+		return apiEmptyList, handleContextError(ctx, err)
 	}
 
 	if !isOwner {
@@ -73,7 +85,16 @@ func (db *DB) ViewVersions(owner uuid.UUID, dataset uuid.UUID) (json.RawMessage,
 }
 
 func (db *DB) ViewDatasetWithOwner(id uuid.UUID, owner uuid.UUID, svc string) (json.RawMessage, error) {
-	tx, err := db.Begin()
+	return db.ViewDatasetWithOwnerContext(context.Background(), id, owner, svc)
+}
+
+// ViewDatasetWithOwnerContext returns the API view of a dataset if the owner matches, within the given context.
+func (db *DB) ViewDatasetWithOwnerContext(ctx context.Context, id uuid.UUID, owner uuid.UUID, svc string) (json.RawMessage, error) {
+	if err := checkID(id); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.BeginContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -81,12 +102,12 @@ func (db *DB) ViewDatasetWithOwner(id uuid.UUID, owner uuid.UUID, svc string) (j
 
 	err = tx.CheckOwner(id, owner)
 	if err != nil {
-		return nil, err
+		return nil, handleContextError(ctx, err)
 	}
 
 	famId, err := tx.getFamily(id)
 	if err != nil {
-		return nil, err
+		return nil, handleContextError(ctx, err)
 	}
 
 	family, err := models.LookupFamily(famId)
@@ -94,10 +115,13 @@ func (db *DB) ViewDatasetWithOwner(id uuid.UUID, owner uuid.UUID, svc string) (j
 		return nil, err
 	}
 
+	var record json.RawMessage
 	if family.IsPartial() {
-		return tx.viewDataset(id, family.Key(), svc)
+		record, err = tx.viewDataset(id, family.Key(), svc)
+	} else {
+		record, err = tx.viewDataset(id, "", svc)
 	}
-	return tx.viewDataset(id, "", svc)
+	return record, handleContextError(ctx, err)
 }
 
 func (tx *Tx) viewDataset(id uuid.UUID, key string, svc string) (json.RawMessage, error) {
@@ -111,23 +135,23 @@ func (tx *Tx) viewDataset(id uuid.UUID, key string, svc string) (json.RawMessage
 		err = tx.QueryRow(`
 		SELECT row_to_json(result) "record"
 		FROM (
-			SELECT id, created, modified, seq, synced, published,
+			SELECT id, created, modified, seq, synced, published, state,
 				family AS type, schema, blob AS dataset,
 				(SELECT extids->$2 FROM identities WHERE uid = creator) AS creator,
 				(SELECT extids->$2 FROM identities WHERE uid = owner) AS owner
 			FROM datasets
-			WHERE id = $1) result
+			WHERE id = $1 AND deleted IS NULL) result
 		`, id.Array(), svc).Scan(&record)
 	} else {
 		err = tx.QueryRow(`
 		SELECT row_to_json(result) "record"
 		FROM (
-			SELECT id, created, modified, seq, synced, published,
+			SELECT id, created, modified, seq, synced, published, state,
 				family AS type, schema, blob#>$2 AS dataset,
 				(SELECT extids->$3 FROM identities WHERE uid = creator) AS creator,
 				(SELECT extids->$3 FROM identities WHERE uid = owner) AS owner
 			FROM datasets
-			WHERE id = $1) result
+			WHERE id = $1 AND deleted IS NULL) result
 		`, id.Array(), []string{key}, svc).Scan(&record)
 	}
 	if err != nil {
@@ -138,11 +162,20 @@ func (tx *Tx) viewDataset(id uuid.UUID, key string, svc string) (json.RawMessage
 }
 
 func (db *DB) ExportAsJson(id uuid.UUID) (json.RawMessage, error) {
+	return db.ExportAsJsonContext(context.Background(), id)
+}
+
+// ExportAsJsonContext returns the full database record of a dataset as JSON within the given context.
+func (db *DB) ExportAsJsonContext(ctx context.Context, id uuid.UUID) (json.RawMessage, error) {
+	if err := checkID(id); err != nil {
+		return nil, err
+	}
+
 	var dataset json.RawMessage
 
-	err := db.pool.QueryRow(`SELECT row_to_json(datasets) FROM datasets WHERE id = $1`, id.Array()).Scan(&dataset)
+	err := db.pool.QueryRowEx(ctx, `SELECT row_to_json(datasets) FROM datasets WHERE id = $1`, nil, id.Array()).Scan(&dataset)
 	if err != nil {
-		return nil, handleError(err)
+		return nil, handleContextError(ctx, err)
 	}
 
 	return dataset, nil
@@ -0,0 +1,158 @@
+package psql
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/wvh/uuid"
+)
+
+// WatchChannel is the Postgres notification channel the datasets trigger publishes changes on.
+const WatchChannel = "dataset_changes"
+
+// watchReconnectDelay is the time to wait between attempts to re-establish a dropped listen connection.
+const watchReconnectDelay = time.Second
+
+// errInvalidEvent is returned when a notification payload can't be parsed.
+var errInvalidEvent = errors.New("invalid dataset event")
+
+// Dataset event operations.
+const (
+	EventInsert = "insert"
+	EventUpdate = "update"
+	EventDelete = "delete"
+
+	// EventReset is sent after the listen connection has been re-established;
+	// notifications sent while it was down are lost, so listeners should drop all cached datasets.
+	EventReset = "reset"
+)
+
+// DatasetEvent describes a change to a dataset as published by the `notify_dataset_change` trigger.
+type DatasetEvent struct {
+	Id uuid.UUID
+	Op string
+}
+
+// Watch listens for dataset changes from all API instances and sends them on the returned channel.
+//
+// It uses a dedicated connection outside the pool. If that connection drops, Watch reconnects and sends an EventReset.
+// The channel is closed when ctx is cancelled.
+func (db *DB) Watch(ctx context.Context) (<-chan DatasetEvent, error) {
+	conn, err := db.listen(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan DatasetEvent)
+	go db.watch(ctx, conn, events)
+	return events, nil
+}
+
+// listen opens a new connection and subscribes to the dataset notification channel.
+func (db *DB) listen(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := pgx.Connect(db.connConfig(*db.config))
+	if err != nil {
+		return nil, handleContextError(ctx, err)
+	}
+
+	if err = conn.Listen(WatchChannel); err != nil {
+		conn.Close()
+		return nil, handleContextError(ctx, err)
+	}
+	return conn, nil
+}
+
+// watch forwards notifications until the context is cancelled, reconnecting when the connection is lost.
+func (db *DB) watch(ctx context.Context, conn *pgx.Conn, events chan<- DatasetEvent) {
+	defer close(events)
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			conn.Close()
+			conn = nil
+			if ctx.Err() != nil {
+				return
+			}
+			db.logger.Warn().Err(err).Msg("lost dataset notification connection")
+
+			if conn = db.relisten(ctx); conn == nil {
+				return
+			}
+			if !send(ctx, events, DatasetEvent{Op: EventReset}) {
+				return
+			}
+			continue
+		}
+
+		event, err := parseEvent(notification.Payload)
+		if err != nil {
+			db.logger.Debug().Str("payload", notification.Payload).Msg("ignoring invalid dataset notification")
+			continue
+		}
+		if !send(ctx, events, event) {
+			return
+		}
+	}
+}
+
+// relisten tries to re-establish the listen connection until it succeeds or the context is cancelled, in which case it returns nil.
+func (db *DB) relisten(ctx context.Context) *pgx.Conn {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watchReconnectDelay):
+		}
+
+		conn, err := db.listen(ctx)
+		if err == nil {
+			db.logger.Info().Msg("re-established dataset notification connection")
+			return conn
+		}
+		db.logger.Debug().Err(err).Msg("failed to re-establish dataset notification connection")
+	}
+}
+
+// send delivers an event unless the context is cancelled first.
+func send(ctx context.Context, events chan<- DatasetEvent, event DatasetEvent) bool {
+	select {
+	case events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// parseEvent parses a notification payload of the form `operation:id`.
+func parseEvent(payload string) (DatasetEvent, error) {
+	var event DatasetEvent
+
+	sep := strings.IndexByte(payload, ':')
+	if sep < 0 {
+		return event, errInvalidEvent
+	}
+
+	switch op := payload[:sep]; op {
+	case EventInsert, EventUpdate, EventDelete:
+		event.Op = op
+	default:
+		return event, errInvalidEvent
+	}
+
+	id, err := uuid.FromString(payload[sep+1:])
+	if err != nil {
+		return event, err
+	}
+	event.Id = id
+
+	return event, nil
+}
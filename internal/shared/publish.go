@@ -38,6 +38,17 @@ func Publish(api *metax.MetaxService, db *psql.DB, id uuid.UUID, owner uuid.UUID
 		return
 	}
 
+	err = db.BeginPublish(id, owner)
+	if err != nil {
+		return
+	}
+	defer func() {
+		// the publish state is set by StorePublished on success
+		if err != nil {
+			db.FinishPublish(id, false, "")
+		}
+	}()
+
 	fmt.Fprintln(os.Stderr, "About to publish:", id)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -70,7 +81,7 @@ func Publish(api *metax.MetaxService, db *psql.DB, id uuid.UUID, owner uuid.UUID
 		synced = time.Now()
 	}
 
-	err = db.StorePublished(id, res, synced)
+	_, err = db.StorePublished(id, res, versionId, synced)
 	if err != nil {
 		//return err
 		return
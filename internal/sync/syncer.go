@@ -0,0 +1,197 @@
+// Package sync pushes published datasets that changed since their last sync to Metax and stores the Metax version back.
+package sync
+
+import (
+	"context"
+	"time"
+
+	"github.com/CSCfi/qvain-api/internal/psql"
+	"github.com/CSCfi/qvain-api/pkg/metax"
+	"github.com/CSCfi/qvain-api/pkg/models"
+	"github.com/rs/zerolog"
+)
+
+// Defaults for a Syncer.
+const (
+	DefaultMaxInFlight = 4
+	DefaultBatchSize   = 100
+	DefaultMaxRetries  = 3
+	DefaultBackoff     = time.Second
+)
+
+// Syncer reconciles published datasets with Metax.
+type Syncer struct {
+	db     *psql.DB
+	api    *metax.MetaxService
+	logger zerolog.Logger
+
+	maxInFlight int
+	batchSize   int
+	maxRetries  int
+	backoff     time.Duration
+}
+
+// SyncerOption configures a Syncer.
+type SyncerOption func(*Syncer)
+
+// WithLogger sets the logger for the syncer.
+func WithLogger(logger zerolog.Logger) SyncerOption {
+	return func(s *Syncer) {
+		s.logger = logger
+	}
+}
+
+// WithMaxInFlight sets the maximum number of datasets sent to Metax concurrently.
+func WithMaxInFlight(n int) SyncerOption {
+	return func(s *Syncer) {
+		if n > 0 {
+			s.maxInFlight = n
+		}
+	}
+}
+
+// WithBatchSize sets the maximum number of datasets synced per pass.
+func WithBatchSize(n int) SyncerOption {
+	return func(s *Syncer) {
+		if n > 0 {
+			s.batchSize = n
+		}
+	}
+}
+
+// WithBackoff sets the number of retries after a Metax server error or transient database error and the delay before the first retry;
+// the delay doubles with each attempt.
+func WithBackoff(retries int, delay time.Duration) SyncerOption {
+	return func(s *Syncer) {
+		s.maxRetries = retries
+		s.backoff = delay
+	}
+}
+
+// NewSyncer returns a syncer that pushes datasets from the database to the given Metax service.
+func NewSyncer(db *psql.DB, api *metax.MetaxService, params ...SyncerOption) *Syncer {
+	s := &Syncer{
+		db:          db,
+		api:         api,
+		logger:      zerolog.Nop(),
+		maxInFlight: DefaultMaxInFlight,
+		batchSize:   DefaultBatchSize,
+		maxRetries:  DefaultMaxRetries,
+		backoff:     DefaultBackoff,
+	}
+
+	for _, param := range params {
+		param(s)
+	}
+	return s
+}
+
+// Run does one sync pass over published datasets that were modified since they were last synced.
+// It returns the number of datasets synced; datasets that fail are logged and left for the next pass.
+// An error is only returned if the datasets to sync couldn't be listed or the context was cancelled.
+func (s *Syncer) Run(ctx context.Context) (int, error) {
+	datasets, err := s.db.ListUnsyncedContext(ctx, s.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	// the semaphore limits concurrent requests; filling it up at the end waits for all of them
+	sem := make(chan struct{}, s.maxInFlight)
+	results := make(chan bool, len(datasets))
+
+	for _, dataset := range datasets {
+		if ctx.Err() != nil {
+			break
+		}
+		sem <- struct{}{}
+
+		go func(dataset *models.Dataset) {
+			defer func() { <-sem }()
+
+			err := s.sync(ctx, dataset)
+			if err != nil {
+				s.logger.Warn().Err(err).Str("id", dataset.Id.String()).Msg("failed to sync dataset")
+			}
+			results <- err == nil
+		}(dataset)
+	}
+
+	for i := 0; i < cap(sem); i++ {
+		sem <- struct{}{}
+	}
+	close(results)
+
+	synced := 0
+	for ok := range results {
+		if ok {
+			synced++
+		}
+	}
+	return synced, ctx.Err()
+}
+
+// RunEvery runs a sync pass at the given interval until the context is cancelled.
+func (s *Syncer) RunEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.Run(ctx)
+		if err != nil && ctx.Err() == nil {
+			s.logger.Error().Err(err).Msg("sync pass failed")
+		} else if n > 0 {
+			s.logger.Info().Int("synced", n).Msg("synced datasets to metax")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sync sends one dataset to Metax and stores the response, retrying with exponential backoff on Metax server errors
+// and transient database errors. If only storing the response failed, Metax isn't called again.
+func (s *Syncer) sync(ctx context.Context, dataset *models.Dataset) error {
+	var (
+		res []byte
+		err error
+	)
+	delay := s.backoff
+
+	for attempt := 0; ; attempt++ {
+		if res == nil {
+			res, err = s.api.Store(ctx, dataset.Blob())
+		}
+		if err == nil {
+			err = s.db.SyncStoreContext(ctx, dataset.Id, res)
+			if err == nil {
+				return nil
+			}
+		}
+
+		if !isRetryable(err) || attempt >= s.maxRetries {
+			return err
+		}
+
+		s.logger.Debug().Err(err).Str("id", dataset.Id.String()).Dur("delay", delay).Msg("transient error, retrying")
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// isRetryable checks if the error is a Metax 5xx response or a transient database error.
+func isRetryable(err error) bool {
+	return isServerError(err) || psql.IsRetryable(err)
+}
+
+// isServerError checks if the error is a Metax 5xx response.
+func isServerError(err error) bool {
+	apiErr, ok := err.(*metax.ApiError)
+	return ok && apiErr.StatusCode() >= 500
+}
@@ -0,0 +1,106 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// diffOp is a patch operation as produced by Diff; unlike operation it doesn't need to tell null from a missing value.
+type diffOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Diff returns a patch document that turns JSON document a into b when applied to it.
+//
+// Objects are compared key by key and arrays index by index, with elements added or removed at the end;
+// the result is correct but not necessarily minimal, as moves and insertions in the middle of arrays are not detected.
+func Diff(a []byte, b []byte) ([]byte, error) {
+	from, err := decode(a)
+	if err != nil {
+		return nil, err
+	}
+	to, err := decode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := diff(from, to, "", []diffOp{})
+	return json.Marshal(ops)
+}
+
+// diff appends the operations needed to change value a at path into b.
+func diff(a, b interface{}, path string, ops []diffOp) []diffOp {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for _, key := range sortedKeys(x) {
+			child := path + "/" + escapeToken(key)
+			if v, ok := y[key]; ok {
+				ops = diff(x[key], v, child, ops)
+			} else {
+				ops = append(ops, diffOp{Op: "remove", Path: child})
+			}
+		}
+		for _, key := range sortedKeys(y) {
+			if _, ok := x[key]; !ok {
+				ops = append(ops, diffOp{Op: "add", Path: path + "/" + escapeToken(key), Value: replacement(y[key])})
+			}
+		}
+		return ops
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		common := len(x)
+		if len(y) < common {
+			common = len(y)
+		}
+		for i := 0; i < common; i++ {
+			ops = diff(x[i], y[i], path+"/"+strconv.Itoa(i), ops)
+		}
+		// remove from the end so earlier indexes stay valid
+		for i := len(x) - 1; i >= common; i-- {
+			ops = append(ops, diffOp{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+		}
+		for i := common; i < len(y); i++ {
+			ops = append(ops, diffOp{Op: "add", Path: path + "/-", Value: replacement(y[i])})
+		}
+		return ops
+	}
+
+	if equal(a, b) {
+		return ops
+	}
+	return append(ops, diffOp{Op: "replace", Path: path, Value: replacement(b)})
+}
+
+// replacement makes sure a null value is marshalled instead of omitted from the operation.
+func replacement(v interface{}) interface{} {
+	if v == nil {
+		return json.RawMessage("null")
+	}
+	return v
+}
+
+// sortedKeys returns the keys of an object in sorted order so diffs are deterministic.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escapeToken escapes a key for use as a JSON pointer reference token.
+func escapeToken(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
@@ -0,0 +1,76 @@
+package jsonpatch
+
+import (
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected string
+	}{
+		{
+			name:     "equal",
+			a:        `{"a":[1,{"b":2}]}`,
+			b:        `{"a":[1,{"b":2.0}]}`,
+			expected: `[]`,
+		},
+		{
+			name:     "object keys",
+			a:        `{"a":1,"b":2,"c/d":3}`,
+			b:        `{"a":1,"b":null,"e":{"f":true}}`,
+			expected: `[{"op":"replace","path":"/b","value":null},{"op":"remove","path":"/c~1d"},{"op":"add","path":"/e","value":{"f":true}}]`,
+		},
+		{
+			name:     "array grows",
+			a:        `{"a":[1,2]}`,
+			b:        `{"a":[1,3,4,null]}`,
+			expected: `[{"op":"replace","path":"/a/1","value":3},{"op":"add","path":"/a/-","value":4},{"op":"add","path":"/a/-","value":null}]`,
+		},
+		{
+			name:     "array shrinks",
+			a:        `{"a":[1,2,3]}`,
+			b:        `{"a":[1]}`,
+			expected: `[{"op":"remove","path":"/a/2"},{"op":"remove","path":"/a/1"}]`,
+		},
+		{
+			name:     "type change",
+			a:        `{"a":{"b":1}}`,
+			b:        `{"a":["b"]}`,
+			expected: `[{"op":"replace","path":"/a","value":["b"]}]`,
+		},
+		{
+			name:     "root",
+			a:        `1`,
+			b:        `"x"`,
+			expected: `[{"op":"replace","path":"","value":"x"}]`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patch, err := Diff([]byte(test.a), []byte(test.b))
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+			if string(patch) != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, patch)
+			}
+
+			// applying the diff should give the second document
+			res, err := Apply([]byte(test.a), patch)
+			if err != nil {
+				t.Fatal("error applying diff:", err)
+			}
+			patch, err = Diff(res, []byte(test.b))
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+			if string(patch) != `[]` {
+				t.Errorf("applied diff differs from expected document: %s", patch)
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+// Package jsonpatch applies RFC 6902 JSON Patch and RFC 7386 JSON Merge Patch documents to JSON values.
+/*
+example:
+	doc := []byte(`{"title":{"en":"old"},"tags":["a"]}`)
+	patch := []byte(`[
+		{"op":"test","path":"/title/en","value":"old"},
+		{"op":"replace","path":"/title/en","value":"new"},
+		{"op":"add","path":"/tags/-","value":"b"}
+	]`)
+
+	res, err := Apply(doc, patch)
+	// res: {"tags":["a","b"],"title":{"en":"new"}}
+*/
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Errors returned when applying a patch.
+var (
+	ErrInvalidPatch   = errors.New("invalid patch document")
+	ErrInvalidOp      = errors.New("invalid patch operation")
+	ErrInvalidPointer = errors.New("invalid JSON pointer")
+	ErrInvalidIndex   = errors.New("invalid array index")
+	ErrPathNotFound   = errors.New("path not found")
+	ErrTestFailed     = errors.New("test operation failed")
+)
+
+// operation is a single RFC 6902 patch operation.
+// Value is a RawMessage instead of a pointer so an explicit null can be told apart from a missing value.
+type operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Apply applies the patch document to the JSON document doc and returns the resulting document.
+// The patch is applied atomically: if any operation fails, an error is returned and doc is left untouched.
+func Apply(doc []byte, patch []byte) ([]byte, error) {
+	var ops []operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, ErrInvalidPatch
+	}
+
+	root, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range ops {
+		root, err = ops[i].apply(root)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(root)
+}
+
+// decode unmarshals a JSON value keeping numbers as json.Number so they survive the round trip unchanged.
+func decode(data []byte) (interface{}, error) {
+	var v interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// apply runs one operation against the document root and returns the new root.
+func (op *operation) apply(root interface{}) (interface{}, error) {
+	if op.Path == nil {
+		return nil, ErrInvalidOp
+	}
+
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, ErrInvalidOp
+		}
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, ErrInvalidOp
+		}
+		switch op.Op {
+		case "add":
+			return add(root, path, value)
+		case "replace":
+			return replace(root, path, value)
+		default:
+			current, err := get(root, path)
+			if err != nil {
+				return nil, err
+			}
+			if !equal(current, value) {
+				return nil, ErrTestFailed
+			}
+			return root, nil
+		}
+	case "remove":
+		root, _, err = remove(root, path)
+		return root, err
+	case "move", "copy":
+		if op.From == nil {
+			return nil, ErrInvalidOp
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if *op.Path == *op.From {
+				return root, nil
+			}
+			// a value can't be moved into one of its own children
+			if strings.HasPrefix(*op.Path, *op.From+"/") {
+				return nil, ErrInvalidOp
+			}
+			var value interface{}
+			root, value, err = remove(root, from)
+			if err != nil {
+				return nil, err
+			}
+			return add(root, path, value)
+		}
+		value, err := get(root, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, path, deepCopy(value))
+	}
+
+	return nil, ErrInvalidOp
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, ErrInvalidPointer
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(tokens[i], "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// parseIndex converts a reference token to an array index in the range [0, max].
+func parseIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, ErrInvalidIndex
+	}
+	for _, c := range token {
+		if c < '0' || c > '9' {
+			return 0, ErrInvalidIndex
+		}
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i > max {
+		return 0, ErrInvalidIndex
+	}
+	return i, nil
+}
+
+// get returns the value at path.
+func get(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, ErrPathNotFound
+			}
+			node = child
+		case []interface{}:
+			i, err := parseIndex(token, len(n)-1)
+			if err != nil {
+				return nil, ErrPathNotFound
+			}
+			node = n[i]
+		default:
+			return nil, ErrPathNotFound
+		}
+	}
+	return node, nil
+}
+
+// update walks to the container holding the last token of path and replaces it with what fn returns.
+// Containers are rebuilt on the way back up because inserting into or removing from a slice creates a new slice.
+func update(node interface{}, path []string, fn func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[path[0]]
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+		child, err := update(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[path[0]] = child
+		return n, nil
+	case []interface{}:
+		i, err := parseIndex(path[0], len(n)-1)
+		if err != nil {
+			return nil, ErrPathNotFound
+		}
+		child, err := update(n[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	}
+
+	return nil, ErrPathNotFound
+}
+
+// add inserts value at path; array elements after the index are shifted and "-" appends.
+func add(root interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(root, path, func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			c[token] = value
+			return c, nil
+		case []interface{}:
+			if token == "-" {
+				return append(c, value), nil
+			}
+			i, err := parseIndex(token, len(c))
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		}
+		return nil, ErrPathNotFound
+	})
+}
+
+// replace overwrites the existing value at path.
+func replace(root interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(root, path, func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			if _, ok := c[token]; !ok {
+				return nil, ErrPathNotFound
+			}
+			c[token] = value
+			return c, nil
+		case []interface{}:
+			i, err := parseIndex(token, len(c)-1)
+			if err != nil {
+				return nil, ErrPathNotFound
+			}
+			c[i] = value
+			return c, nil
+		}
+		return nil, ErrPathNotFound
+	})
+}
+
+// remove deletes the value at path, returning the new root and the removed value.
+func remove(root interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, ErrInvalidOp
+	}
+
+	var removed interface{}
+	root, err := update(root, path, func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			value, ok := c[token]
+			if !ok {
+				return nil, ErrPathNotFound
+			}
+			removed = value
+			delete(c, token)
+			return c, nil
+		case []interface{}:
+			i, err := parseIndex(token, len(c)-1)
+			if err != nil {
+				return nil, ErrPathNotFound
+			}
+			removed = c[i]
+			return append(c[:i], c[i+1:]...), nil
+		}
+		return nil, ErrPathNotFound
+	})
+	return root, removed, err
+}
+
+// deepCopy copies decoded JSON containers so a copied value doesn't alias its source.
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k := range v {
+			m[k] = deepCopy(v[k])
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i := range v {
+			a[i] = deepCopy(v[i])
+		}
+		return a
+	}
+	return value
+}
+
+// equal compares two decoded JSON values; numbers are compared by value, so 1 equals 1.0.
+func equal(a, b interface{}) bool {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k := range x {
+			if v, ok := y[k]; !ok || !equal(x[k], v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		fx, errx := x.Float64()
+		fy, erry := y.Float64()
+		return errx == nil && erry == nil && fx == fy
+	}
+	return a == b
+}
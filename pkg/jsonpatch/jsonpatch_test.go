@@ -0,0 +1,124 @@
+package jsonpatch
+
+import (
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		patch    string
+		expected string
+		err      error
+	}{
+		{
+			name:     "add key",
+			doc:      `{"a":1}`,
+			patch:    `[{"op":"add","path":"/b","value":{"c":[1,2]}}]`,
+			expected: `{"a":1,"b":{"c":[1,2]}}`,
+		},
+		{
+			name:     "add nested array element",
+			doc:      `{"a":{"b":[1,3]}}`,
+			patch:    `[{"op":"add","path":"/a/b/1","value":2},{"op":"add","path":"/a/b/-","value":4}]`,
+			expected: `{"a":{"b":[1,2,3,4]}}`,
+		},
+		{
+			name:     "add null",
+			doc:      `{}`,
+			patch:    `[{"op":"add","path":"/a","value":null}]`,
+			expected: `{"a":null}`,
+		},
+		{
+			name:     "remove",
+			doc:      `{"a":{"b":1,"c":2},"d":[1,2,3]}`,
+			patch:    `[{"op":"remove","path":"/a/b"},{"op":"remove","path":"/d/0"}]`,
+			expected: `{"a":{"c":2},"d":[2,3]}`,
+		},
+		{
+			name:     "replace",
+			doc:      `{"a":{"b":1}}`,
+			patch:    `[{"op":"replace","path":"/a/b","value":"x"}]`,
+			expected: `{"a":{"b":"x"}}`,
+		},
+		{
+			name:     "move",
+			doc:      `{"a":{"b":1},"c":{}}`,
+			patch:    `[{"op":"move","from":"/a/b","path":"/c/d"}]`,
+			expected: `{"a":{},"c":{"d":1}}`,
+		},
+		{
+			name:     "copy",
+			doc:      `{"a":{"b":[1]}}`,
+			patch:    `[{"op":"copy","from":"/a","path":"/c"},{"op":"add","path":"/c/b/-","value":2}]`,
+			expected: `{"a":{"b":[1]},"c":{"b":[1,2]}}`,
+		},
+		{
+			name:     "test passes",
+			doc:      `{"a":{"b":1.0},"c~d":"x/y"}`,
+			patch:    `[{"op":"test","path":"/a/b","value":1},{"op":"test","path":"/c~0d","value":"x/y"}]`,
+			expected: `{"a":{"b":1.0},"c~d":"x/y"}`,
+		},
+		{
+			name:  "test fails",
+			doc:   `{"a":{"b":1}}`,
+			patch: `[{"op":"replace","path":"/a/b","value":2},{"op":"test","path":"/a/b","value":1}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "missing path",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"replace","path":"/b","value":2}]`,
+			err:   ErrPathNotFound,
+		},
+		{
+			name:  "missing parent",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"add","path":"/b/c","value":2}]`,
+			err:   ErrPathNotFound,
+		},
+		{
+			name:  "index out of range",
+			doc:   `{"a":[1]}`,
+			patch: `[{"op":"add","path":"/a/2","value":2}]`,
+			err:   ErrInvalidIndex,
+		},
+		{
+			name:  "move into child",
+			doc:   `{"a":{"b":1}}`,
+			patch: `[{"op":"move","from":"/a","path":"/a/b/c"}]`,
+			err:   ErrInvalidOp,
+		},
+		{
+			name:  "unknown op",
+			doc:   `{}`,
+			patch: `[{"op":"frobnicate","path":"/a"}]`,
+			err:   ErrInvalidOp,
+		},
+		{
+			name:  "missing value",
+			doc:   `{}`,
+			patch: `[{"op":"add","path":"/a"}]`,
+			err:   ErrInvalidOp,
+		},
+		{
+			name:  "not a patch",
+			doc:   `{}`,
+			patch: `{"op":"add"}`,
+			err:   ErrInvalidPatch,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := Apply([]byte(test.doc), []byte(test.patch))
+			if err != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if test.err == nil && string(res) != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, res)
+			}
+		})
+	}
+}
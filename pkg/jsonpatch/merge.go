@@ -0,0 +1,44 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+)
+
+// MergePatch applies an RFC 7386 JSON Merge Patch document to the JSON document doc and returns the resulting document.
+// Objects in the patch are merged recursively into the document, a null value removes the key, and any other value,
+// including arrays, replaces the target value as a whole.
+func MergePatch(doc []byte, patch []byte) ([]byte, error) {
+	value, err := decode(patch)
+	if err != nil {
+		return nil, ErrInvalidPatch
+	}
+
+	root, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(merge(root, value))
+}
+
+// merge merges patch into target following RFC 7386 and returns the result; target is modified in place if it is an object.
+func merge(target, patch interface{}) interface{} {
+	obj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	doc, ok := target.(map[string]interface{})
+	if !ok {
+		doc = make(map[string]interface{}, len(obj))
+	}
+
+	for key, value := range obj {
+		if value == nil {
+			delete(doc, key)
+			continue
+		}
+		doc[key] = merge(doc[key], value)
+	}
+	return doc
+}
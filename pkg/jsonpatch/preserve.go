@@ -0,0 +1,50 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+)
+
+// Preserve copies the values at the given paths from the document from into doc and returns the resulting document.
+// Each path is a list of object keys. Missing objects on a path are created in doc; if a path doesn't exist in from,
+// it is removed from doc, so both documents end up with the same value at every path.
+func Preserve(doc []byte, from []byte, paths [][]string) ([]byte, error) {
+	root, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := decode(from)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		value, err := get(source, path)
+		switch err {
+		case nil:
+			root = set(root, path, value)
+		case ErrPathNotFound:
+			if removed, _, err := remove(root, path); err == nil {
+				root = removed
+			}
+		default:
+			return nil, err
+		}
+	}
+
+	return json.Marshal(root)
+}
+
+// set stores value at a path of object keys, replacing anything on the way that isn't an object.
+func set(node interface{}, path []string, value interface{}) interface{} {
+	if len(path) == 0 {
+		return value
+	}
+
+	obj, ok := node.(map[string]interface{})
+	if !ok {
+		obj = make(map[string]interface{})
+	}
+	obj[path[0]] = set(obj[path[0]], path[1:], value)
+	return obj
+}
@@ -0,0 +1,44 @@
+package jsonpatch
+
+import (
+	"testing"
+)
+
+func TestPreserve(t *testing.T) {
+	from := `{"identifier":"urn:1","research_dataset":{"title":"old","preferred_identifier":"urn:p"},"n":1}`
+	paths := [][]string{{"identifier"}, {"research_dataset", "preferred_identifier"}, {"state"}}
+
+	tests := []struct {
+		name     string
+		doc      string
+		expected string
+	}{
+		{
+			name:     "dropped by client",
+			doc:      `{"research_dataset":{"title":"new"}}`,
+			expected: `{"identifier":"urn:1","research_dataset":{"preferred_identifier":"urn:p","title":"new"}}`,
+		},
+		{
+			name:     "changed by client",
+			doc:      `{"identifier":"urn:2","research_dataset":{"title":"new","preferred_identifier":"urn:x"},"state":"x"}`,
+			expected: `{"identifier":"urn:1","research_dataset":{"preferred_identifier":"urn:p","title":"new"}}`,
+		},
+		{
+			name:     "parent replaced by client",
+			doc:      `{"research_dataset":"gone"}`,
+			expected: `{"identifier":"urn:1","research_dataset":{"preferred_identifier":"urn:p"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := Preserve([]byte(test.doc), []byte(from), paths)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(res) != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, res)
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+// Package jsonschema validates JSON documents against a subset of JSON Schema (draft 7).
+//
+// Supported keywords are: type, enum, const, properties, required, additionalProperties, items,
+// minItems, maxItems, minLength, maxLength, pattern, minimum and maximum. Other keywords – including $ref – are ignored.
+/*
+example:
+	reg := NewRegistry()
+	if err := reg.Add("simple", []byte(`{"type":"object","required":["title"]}`)); err != nil {
+		log.Fatal(err)
+	}
+
+	violations, err := reg.Validate("simple", []byte(`{}`))
+	// violations: ["/: missing required property \"title\""]
+*/
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Errors returned by this package.
+var (
+	ErrUnknownSchema = errors.New("unknown schema")
+	ErrInvalidSchema = errors.New("invalid schema")
+)
+
+// Schema is a compiled JSON schema.
+type Schema struct {
+	Type                 types              `json:"type"`
+	Enum                 []interface{}      `json:"enum"`
+	Const                *json.RawMessage   `json:"const"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *additional        `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Pattern              string             `json:"pattern"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+
+	constValue interface{}
+	pattern    *regexp.Regexp
+}
+
+// types holds the allowed type names; the keyword can be a single string or an array.
+type types []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *types) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*t = types{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// additional holds the additionalProperties keyword, which is either a boolean or a schema.
+type additional struct {
+	allowed bool
+	schema  *Schema
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *additional) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &a.allowed); err == nil {
+		return nil
+	}
+	a.allowed = true
+	a.schema = new(Schema)
+	return json.Unmarshal(b, a.schema)
+}
+
+// Compile parses a JSON schema document.
+func Compile(data []byte) (*Schema, error) {
+	schema := new(Schema)
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, ErrInvalidSchema
+	}
+	if err := schema.compile(); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// compile prepares regular expressions and constants for the schema and its sub-schemas.
+func (s *Schema) compile() (err error) {
+	if s.Pattern != "" {
+		if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+			return ErrInvalidSchema
+		}
+	}
+	if s.Const != nil {
+		if s.constValue, err = decode(*s.Const); err != nil {
+			return ErrInvalidSchema
+		}
+	}
+	for _, sub := range s.Properties {
+		if err = sub.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		if err = s.Items.compile(); err != nil {
+			return err
+		}
+	}
+	if s.AdditionalProperties != nil && s.AdditionalProperties.schema != nil {
+		return s.AdditionalProperties.schema.compile()
+	}
+	return nil
+}
+
+// Validate checks a JSON document against the schema and returns a list of violations.
+// An error is only returned if the document isn't valid JSON.
+func (s *Schema) Validate(doc []byte) ([]string, error) {
+	v, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []string
+	s.validate(v, "", &violations)
+	return violations, nil
+}
+
+// decode unmarshals a JSON value keeping numbers as json.Number.
+func decode(data []byte) (interface{}, error) {
+	var v interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// typeOf returns the JSON schema type name of a decoded value.
+func typeOf(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := x.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+// has checks if a value's type is in the list of allowed types; integers are also numbers.
+func (t types) has(actual string) bool {
+	for _, name := range t {
+		if name == actual || (name == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// validate appends violations for value v at the given JSON pointer.
+func (s *Schema) validate(v interface{}, path string, violations *[]string) {
+	report := func(format string, args ...interface{}) {
+		p := path
+		if p == "" {
+			p = "/"
+		}
+		*violations = append(*violations, p+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(s.Type) > 0 && !s.Type.has(typeOf(v)) {
+		report("expected %s, got %s", strings.Join(s.Type, " or "), typeOf(v))
+		return
+	}
+
+	if s.Enum != nil {
+		found := false
+		for _, e := range s.Enum {
+			if equal(v, normalise(e)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report("value not in enum")
+		}
+	}
+
+	if s.Const != nil && !equal(v, s.constValue) {
+		report("value does not match const")
+	}
+
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := x[name]; !ok {
+				report("missing required property %q", name)
+			}
+		}
+		for name, value := range x {
+			child := path + "/" + escape(name)
+			if sub, ok := s.Properties[name]; ok {
+				sub.validate(value, child, violations)
+			} else if s.AdditionalProperties != nil {
+				if !s.AdditionalProperties.allowed {
+					report("additional property %q not allowed", name)
+				} else if s.AdditionalProperties.schema != nil {
+					s.AdditionalProperties.schema.validate(value, child, violations)
+				}
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(x) < *s.MinItems {
+			report("expected at least %d items, got %d", *s.MinItems, len(x))
+		}
+		if s.MaxItems != nil && len(x) > *s.MaxItems {
+			report("expected at most %d items, got %d", *s.MaxItems, len(x))
+		}
+		if s.Items != nil {
+			for i := range x {
+				s.Items.validate(x[i], fmt.Sprintf("%s/%d", path, i), violations)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(x)
+		if s.MinLength != nil && n < *s.MinLength {
+			report("expected length of at least %d, got %d", *s.MinLength, n)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			report("expected length of at most %d, got %d", *s.MaxLength, n)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(x) {
+			report("does not match pattern %q", s.Pattern)
+		}
+	case json.Number:
+		f, err := x.Float64()
+		if err != nil {
+			report("invalid number")
+			return
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			report("expected minimum of %v, got %v", *s.Minimum, f)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			report("expected maximum of %v, got %v", *s.Maximum, f)
+		}
+	}
+}
+
+// escape escapes a property name for use as a JSON pointer reference token.
+func escape(name string) string {
+	return strings.Replace(strings.Replace(name, "~", "~0", -1), "/", "~1", -1)
+}
+
+// normalise converts float64 numbers from a schema decoded without UseNumber to json.Number.
+func normalise(v interface{}) interface{} {
+	switch x := v.(type) {
+	case float64:
+		return json.Number(fmt.Sprint(x))
+	case []interface{}:
+		for i := range x {
+			x[i] = normalise(x[i])
+		}
+	case map[string]interface{}:
+		for k := range x {
+			x[k] = normalise(x[k])
+		}
+	}
+	return v
+}
+
+// equal compares two decoded JSON values; numbers are compared by value.
+func equal(a, b interface{}) bool {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k := range x {
+			if v, ok := y[k]; !ok || !equal(x[k], v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fx, errx := x.Float64()
+		fy, erry := y.Float64()
+		return x == y || (errx == nil && erry == nil && fx == fy)
+	}
+	return a == b
+}
+
+// Registry holds compiled schemas by name. It is safe for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	schemas map[string]*Schema
+}
+
+// NewRegistry creates an empty schema registry.
+func NewRegistry() *Registry {
+	return &Registry{schemas: make(map[string]*Schema)}
+}
+
+// Add compiles a schema and registers it under the given name, replacing any existing schema with that name.
+func (reg *Registry) Add(name string, data []byte) error {
+	schema, err := Compile(data)
+	if err != nil {
+		return err
+	}
+
+	reg.mu.Lock()
+	reg.schemas[name] = schema
+	reg.mu.Unlock()
+	return nil
+}
+
+// LoadDir registers all `*.json` files in a directory, using the file name without extension as schema name.
+func (reg *Registry) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range files {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		if err := reg.Add(strings.TrimSuffix(filepath.Base(fn), ".json"), data); err != nil {
+			return fmt.Errorf("%s: %s", fn, err)
+		}
+	}
+	return nil
+}
+
+// Lookup returns the schema registered under the given name.
+func (reg *Registry) Lookup(name string) (*Schema, error) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	if schema, ok := reg.schemas[name]; ok {
+		return schema, nil
+	}
+	return nil, ErrUnknownSchema
+}
+
+// Validate validates a document against the named schema. It returns ErrUnknownSchema if no such schema exists.
+func (reg *Registry) Validate(name string, doc []byte) ([]string, error) {
+	schema, err := reg.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return schema.Validate(doc)
+}
@@ -0,0 +1,118 @@
+package jsonschema
+
+import (
+	"testing"
+)
+
+const testSchema = `{
+	"type": "object",
+	"required": ["title", "version"],
+	"additionalProperties": false,
+	"properties": {
+		"title": {"type": "string", "minLength": 1, "maxLength": 10},
+		"version": {"type": "integer", "minimum": 1},
+		"state": {"enum": ["draft", "published"]},
+		"id": {"type": "string", "pattern": "^urn:"},
+		"keywords": {"type": "array", "maxItems": 2, "items": {"type": "string"}},
+		"extra": {"type": ["object", "null"], "additionalProperties": {"type": "number"}}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	schema, err := Compile([]byte(testSchema))
+	if err != nil {
+		t.Fatal("compile:", err)
+	}
+
+	tests := []struct {
+		name       string
+		doc        string
+		violations []string
+	}{
+		{
+			name: "valid",
+			doc:  `{"title":"test","version":1,"state":"draft","id":"urn:x","keywords":["a","b"],"extra":{"x":1.5}}`,
+		},
+		{
+			name: "null type",
+			doc:  `{"title":"test","version":2,"extra":null}`,
+		},
+		{
+			name:       "missing required",
+			doc:        `{"title":"test"}`,
+			violations: []string{`/: missing required property "version"`},
+		},
+		{
+			name:       "wrong type",
+			doc:        `{"title":"test","version":1.5}`,
+			violations: []string{`/version: expected integer, got number`},
+		},
+		{
+			name:       "additional property",
+			doc:        `{"title":"test","version":1,"other":true}`,
+			violations: []string{`/: additional property "other" not allowed`},
+		},
+		{
+			name:       "nested",
+			doc:        `{"title":"","version":0,"keywords":["a",1,"c"],"extra":{"a/b":"x"}}`,
+			violations: []string{`/title: expected length of at least 1, got 0`, `/version: expected minimum of 1, got 0`, `/keywords: expected at most 2 items, got 3`, `/keywords/1: expected string, got integer`, `/extra/a~1b: expected number, got string`},
+		},
+		{
+			name:       "enum and pattern",
+			doc:        `{"title":"test","version":1,"state":"deleted","id":"doi:x"}`,
+			violations: []string{`/state: value not in enum`, `/id: does not match pattern "^urn:"`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			violations, err := schema.Validate([]byte(test.doc))
+			if err != nil {
+				t.Fatal("validate:", err)
+			}
+			if !sameElements(violations, test.violations) {
+				t.Errorf("expected violations %q, got %q", test.violations, violations)
+			}
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	reg := NewRegistry()
+	if err := reg.Add("test", []byte(testSchema)); err != nil {
+		t.Fatal("add:", err)
+	}
+
+	if err := reg.Add("broken", []byte(`{"type":`)); err != ErrInvalidSchema {
+		t.Errorf("expected %v, got %v", ErrInvalidSchema, err)
+	}
+
+	if _, err := reg.Validate("missing", []byte(`{}`)); err != ErrUnknownSchema {
+		t.Errorf("expected %v, got %v", ErrUnknownSchema, err)
+	}
+
+	violations, err := reg.Validate("test", []byte(`{"title":"test","version":1}`))
+	if err != nil || len(violations) > 0 {
+		t.Errorf("expected valid document, got %q (%v)", violations, err)
+	}
+}
+
+// sameElements compares two string slices ignoring order, as object keys are visited in random order.
+func sameElements(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := make(map[string]int)
+	for _, s := range a {
+		count[s]++
+	}
+	for _, s := range b {
+		count[s]--
+	}
+	for _, n := range count {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
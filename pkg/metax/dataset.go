@@ -12,7 +12,7 @@ import (
 
 const (
 	// MetaxDatasetFamily is the dataset type for Fairdata datasets.
-	MetaxDatasetFamily = 2
+	MetaxDatasetFamily = models.FamilyMetax
 
 	// appIdent is the ident used to recognise our application's Editor metadata.
 	appIdent = "qvain"
@@ -26,6 +26,7 @@ var noRecords []MetaxRecord
 
 func init() {
 	models.RegisterFamily(MetaxDatasetFamily, "metax", NewMetaxDataset, LoadMetaxDataset, []string{"research_dataset", "contracts"})
+	models.SetFamilySchemas(MetaxDatasetFamily, SchemaIda, SchemaAtt)
 }
 
 // MetaxDataset wraps a models.Dataset.
@@ -49,7 +50,7 @@ func LoadMetaxDataset(ds *models.Dataset) models.TypedDataset {
 }
 
 // CreateData creates a dataset from template and merges set fields.
-func (dataset *MetaxDataset) CreateData(family int, schema string, blob []byte, extra map[string]string) error {
+func (dataset *MetaxDataset) CreateData(family models.Family, schema string, blob []byte, extra map[string]string) error {
 	if family == 0 {
 		return errors.New("need schema family")
 	}
@@ -96,7 +97,7 @@ func (dataset *MetaxDataset) CreateData(family int, schema string, blob []byte,
 }
 
 // UpdateData creates a partial dataset JSON blob to patch an existing one with.
-func (dataset *MetaxDataset) UpdateData(family int, schema string, blob []byte, extra map[string]string) error {
+func (dataset *MetaxDataset) UpdateData(family models.Family, schema string, blob []byte, extra map[string]string) error {
 	if family == 0 {
 		return errors.New("need schema family")
 	}
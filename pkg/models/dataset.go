@@ -1,6 +1,8 @@
 package models
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"time"
 
@@ -13,19 +15,43 @@ var (
 	errNeedDataset = errors.New("need dataset blob")
 )
 
+// PublishState is the state of a dataset in the publication workflow.
+type PublishState string
+
+// Publication states; a dataset starts out as a draft and moves to publishing while it is being sent to Metax.
+const (
+	StateDraft      PublishState = "draft"
+	StatePublishing PublishState = "publishing"
+	StatePublished  PublishState = "published"
+	StateFailed     PublishState = "failed"
+)
+
 type Dataset struct {
 	Id      uuid.UUID
 	Creator uuid.UUID
 	Owner   uuid.UUID
 
+	// Timestamps are zero if not set in the database; Synced in particular is zero for datasets that were never synchronised.
+	// The database layer stores a zero timestamp as NULL, or as the current time for Created and Modified.
 	Created  time.Time
 	Modified time.Time
 	Synced   time.Time
 
+	// Seq is incremented on every change and can be used to detect concurrent modifications.
+	Seq int64
+
 	Published bool
-	valid     bool
+	State     PublishState
 
-	family int
+	// MetaxId is the identifier assigned by Metax on publication; empty if the dataset has never been published.
+	MetaxId string
+
+	// ModifiedBy is the user who last edited the blob; zero if unknown or the last change came from a service.
+	ModifiedBy uuid.UUID
+
+	valid bool
+
+	family Family
 	schema string
 	blob   []byte
 }
@@ -48,16 +74,17 @@ func NewDataset(creator uuid.UUID) (*Dataset, error) {
 }
 
 // SetData sets the schema family and name as well as the metadata blob.
-// It is an error not to provide the appropriate schema family and name.
-func (ds *Dataset) SetData(family int, schema string, blob []byte) error {
+// It is an error not to provide the appropriate schema family and name. A nil or empty blob, such as a NULL value from the database,
+// is stored as an empty JSON object.
+func (ds *Dataset) SetData(family Family, schema string, blob []byte) error {
 	if family < 0 {
 		return errNeedFamily
 	}
 	if schema == "" {
 		return errNeedSchema
 	}
-	if blob == nil {
-		blob = []byte("")
+	if len(blob) == 0 {
+		blob = []byte("{}")
 	}
 	ds.family = family
 	ds.schema = schema
@@ -67,16 +94,16 @@ func (ds *Dataset) SetData(family int, schema string, blob []byte) error {
 }
 
 // CreateData allows dataset types to override what happens on dataset creation.
-func (ds *Dataset) CreateData(family int, schema string, blob []byte, extra map[string]string) error {
+func (ds *Dataset) CreateData(family Family, schema string, blob []byte, extra map[string]string) error {
 	return ds.SetData(family, schema, blob)
 }
 
 // UpdateData allows dataset types to override what happens on update of an existing dataset.
-func (ds *Dataset) UpdateData(family int, schema string, blob []byte, extra map[string]string) error {
+func (ds *Dataset) UpdateData(family Family, schema string, blob []byte, extra map[string]string) error {
 	return ds.SetData(family, schema, blob)
 }
 
-func (ds *Dataset) Family() int {
+func (ds *Dataset) Family() Family {
 	return ds.family
 }
 
@@ -88,6 +115,31 @@ func (ds *Dataset) Blob() []byte {
 	return ds.blob
 }
 
+// CanonicalBlob returns the blob with object keys sorted and insignificant whitespace removed,
+// so equal documents give equal bytes however they were stored, for instance for hashing or ETags.
+// Numbers and strings are kept as written; an empty blob is returned as `{}`.
+func (ds *Dataset) CanonicalBlob() ([]byte, error) {
+	if len(ds.blob) == 0 {
+		return []byte("{}"), nil
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(ds.blob))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	// encoding/json sorts map keys; don't escape HTML so the result stays identical to the input text
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
 func (ds *Dataset) SetValid(valid bool) {
 	ds.valid = valid
 }
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestSetDataEmptyBlob(t *testing.T) {
+	for _, blob := range [][]byte{nil, {}} {
+		ds := new(Dataset)
+		if err := ds.SetData(1, "test", blob); err != nil {
+			t.Fatal(err)
+		}
+		if string(ds.Blob()) != "{}" {
+			t.Errorf("%#v: expected empty object, got %q", blob, ds.Blob())
+		}
+	}
+
+	ds := new(Dataset)
+	if err := ds.SetData(1, "", nil); err != errNeedSchema {
+		t.Errorf("expected %v, got %v", errNeedSchema, err)
+	}
+}
+
+func TestCanonicalBlob(t *testing.T) {
+	tests := []struct {
+		blob     string
+		expected string
+	}{
+		{blob: ``, expected: `{}`},
+		{blob: `{ "b": 1, "a": {"d": [3, 1.50], "c": null} }`, expected: `{"a":{"c":null,"d":[3,1.50]},"b":1}`},
+		{blob: "{\n\t\"title\": \"<a & b>\",\n\t\"id\": 12345678901234567890\n}", expected: `{"id":12345678901234567890,"title":"<a & b>"}`},
+	}
+
+	for _, test := range tests {
+		ds := &Dataset{blob: []byte(test.blob)}
+		canonical, err := ds.CanonicalBlob()
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.blob, err)
+			continue
+		}
+		if string(canonical) != test.expected {
+			t.Errorf("%q: expected %s, got %s", test.blob, test.expected, canonical)
+		}
+	}
+
+	ds := &Dataset{blob: []byte(`{"a":`)}
+	if _, err := ds.CanonicalBlob(); err == nil {
+		t.Error("expected error for malformed blob")
+	}
+}
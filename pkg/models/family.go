@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strconv"
 	"strings"
 
 	"github.com/wvh/uuid"
@@ -12,36 +13,118 @@ type NewFunc func(uuid.UUID) (TypedDataset, error)
 // LoadFunc is a constructor function that wraps a base dataset returning a typed dataset satisfying the TypedDataset interface.
 type LoadFunc func(*Dataset) TypedDataset
 
+// Family identifies a dataset type; it is stored as an integer in the database.
+type Family int
+
+// Known dataset types. Packages register the types they implement, so a constant being defined doesn't mean it is registered.
+const (
+	FamilyUntyped Family = 0
+	FamilyOpen    Family = 1
+
+	// FamilyMetax is registered by package metax.
+	FamilyMetax Family = 2
+)
+
+// String returns the registered name of the dataset type for logging, or its number if it isn't registered.
+func (family Family) String() string {
+	if fam, err := LookupFamily(family); err == nil {
+		return fam.Name
+	}
+	return "family " + strconv.Itoa(int(family))
+}
+
 // SchemaFamily defines a dataset type.
 type SchemaFamily struct {
-	Id          int
+	Id          Family
 	Name        string
 	NewFunc     NewFunc
 	LoadFunc    LoadFunc
 	publicPaths []string
+	schemas     []string
+	parent      *SchemaFamily
+	children    []*SchemaFamily
+}
+
+// Parent returns the family this family specialises, or nil if it is a top-level family.
+func (fam *SchemaFamily) Parent() *SchemaFamily {
+	return fam.parent
+}
+
+// Children returns the families that specialise this family, ordered by id.
+func (fam *SchemaFamily) Children() []*SchemaFamily {
+	children := make([]*SchemaFamily, len(fam.children))
+	copy(children, fam.children)
+	return children
+}
+
+// paths returns the public paths of the family, inherited from the nearest ancestor if the family has none of its own.
+func (fam *SchemaFamily) paths() []string {
+	for f := fam; f != nil; f = f.parent {
+		if f.publicPaths != nil {
+			return f.publicPaths
+		}
+	}
+	return nil
 }
 
 // IsPartial returns a boolean indicating if this is a dataset that is only partially shown to the API.
 func (fam *SchemaFamily) IsPartial() bool {
 	// nil slice also has len 0
-	return len(fam.publicPaths) > 0
+	return len(fam.paths()) > 0
 }
 
 // Key returns the key containing the partial dataset; the first element of the publicPaths slice.
+// A family without public paths of its own uses the key of its nearest ancestor that has them.
 func (fam *SchemaFamily) Key() string {
-	if len(fam.publicPaths) > 0 {
-		return fam.publicPaths[0]
+	if paths := fam.paths(); len(paths) > 0 {
+		return paths[0]
 	}
 	return ""
 }
 
+// HasKey returns a boolean indicating if key is one of the top-level keys a partial dataset of this family can be fetched by.
+// Any non-empty key is allowed for a family that isn't partial.
+func (fam *SchemaFamily) HasKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	paths := fam.paths()
+	if paths == nil {
+		return true
+	}
+	return contains(paths, key)
+}
+
+// Schemas returns the schemas datasets of this family may have, inherited from the nearest ancestor if the family has none of its own.
+// A nil list means any schema is allowed.
+func (fam *SchemaFamily) Schemas() []string {
+	for f := fam; f != nil; f = f.parent {
+		if f.schemas != nil {
+			schemas := make([]string, len(f.schemas))
+			copy(schemas, f.schemas)
+			return schemas
+		}
+	}
+	return nil
+}
+
+// AllowsSchema returns a boolean indicating if datasets of this family may have the given schema.
+func (fam *SchemaFamily) AllowsSchema(schema string) bool {
+	schemas := fam.Schemas()
+	if schemas == nil {
+		return true
+	}
+	return contains(schemas, schema)
+}
+
 // IsPathPublic returns a boolean indicating if the dataset's subkey can be shown via API.
 // A nil path list means no restrictions.
 func (fam *SchemaFamily) IsPathPublic(p string) bool {
-	if fam.publicPaths == nil {
+	paths := fam.paths()
+	if paths == nil {
 		return true
 	}
-	return inPrefixes(fam.publicPaths, p)
+	return inPrefixes(paths, p)
 }
 
 // contains does a simple linear string search.
@@ -2,23 +2,27 @@ package models
 
 import (
 	"errors"
+	"sort"
 
 	"github.com/wvh/uuid"
 )
 
 var ErrInvalidFamily = errors.New("Invalid dataset type")
 
+// ErrFamilyCycle is returned when setting a parent would make a family its own ancestor.
+var ErrFamilyCycle = errors.New("dataset type hierarchy cycle")
+
 var privateTypeRegistry *TypeRegistry
 
 type TypeRegistry struct {
-	tmap map[int]*SchemaFamily
+	tmap map[Family]*SchemaFamily
 }
 
 func NewTypeRegistry() *TypeRegistry {
-	return &TypeRegistry{tmap: make(map[int]*SchemaFamily)}
+	return &TypeRegistry{tmap: make(map[Family]*SchemaFamily)}
 }
 
-func (reg *TypeRegistry) Register(id int, name string, newFunc NewFunc, loadFunc LoadFunc, paths []string) {
+func (reg *TypeRegistry) Register(id Family, name string, newFunc NewFunc, loadFunc LoadFunc, paths []string) {
 	reg.tmap[id] = &SchemaFamily{
 		Id:          id,
 		Name:        name,
@@ -28,32 +32,113 @@ func (reg *TypeRegistry) Register(id int, name string, newFunc NewFunc, loadFunc
 	}
 }
 
-func (reg *TypeRegistry) Lookup(id int) (*SchemaFamily, error) {
+func (reg *TypeRegistry) Lookup(id Family) (*SchemaFamily, error) {
 	if t, e := reg.tmap[id]; e {
 		return t, nil
 	}
 	return nil, ErrInvalidFamily
 }
 
+// SetParent makes the family with the given id a child of the parent family.
+// Children without public paths of their own inherit those of their parent.
+func (reg *TypeRegistry) SetParent(id Family, parentId Family) error {
+	fam, err := reg.Lookup(id)
+	if err != nil {
+		return err
+	}
+	parent, err := reg.Lookup(parentId)
+	if err != nil {
+		return err
+	}
+
+	for f := parent; f != nil; f = f.parent {
+		if f == fam {
+			return ErrFamilyCycle
+		}
+	}
+
+	if fam.parent != nil {
+		siblings := fam.parent.children
+		for i := range siblings {
+			if siblings[i] == fam {
+				fam.parent.children = append(siblings[:i], siblings[i+1:]...)
+				break
+			}
+		}
+	}
+
+	fam.parent = parent
+	parent.children = append(parent.children, fam)
+	sort.Slice(parent.children, func(i, j int) bool { return parent.children[i].Id < parent.children[j].Id })
+	return nil
+}
+
+// SetSchemas restricts the schemas datasets of the family with the given id may have; nil allows any schema.
+// Children without schemas of their own inherit those of their parent.
+func (reg *TypeRegistry) SetSchemas(id Family, schemas []string) error {
+	fam, err := reg.Lookup(id)
+	if err != nil {
+		return err
+	}
+
+	fam.schemas = schemas
+	return nil
+}
+
+// Families returns all registered families ordered by id.
+func (reg *TypeRegistry) Families() []*SchemaFamily {
+	families := make([]*SchemaFamily, 0, len(reg.tmap))
+	for _, fam := range reg.tmap {
+		families = append(families, fam)
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].Id < families[j].Id })
+	return families
+}
+
 func init() {
 	// global registry
 	privateTypeRegistry = NewTypeRegistry()
 
-	privateTypeRegistry.Register(0, "no type", NewUntypedDataset, LoadUntypedDataset, nil)
-	privateTypeRegistry.Register(1, "open dataset", NewOpenDataset, LoadOpenDataset, nil)
+	privateTypeRegistry.Register(FamilyUntyped, "no type", NewUntypedDataset, LoadUntypedDataset, nil)
+	privateTypeRegistry.Register(FamilyOpen, "open dataset", NewOpenDataset, LoadOpenDataset, nil)
 	// metax registers its own dataset type(s)
 }
 
 // RegisterFamily registers a dataset type into the global registry.
-func RegisterFamily(id int, name string, newFunc NewFunc, loadFunc LoadFunc, paths []string) {
+func RegisterFamily(id Family, name string, newFunc NewFunc, loadFunc LoadFunc, paths []string) {
 	privateTypeRegistry.Register(id, name, newFunc, loadFunc, paths)
 }
 
 // LookupFamily looks up a dataset type from the global registry.
-func LookupFamily(id int) (*SchemaFamily, error) {
+func LookupFamily(id Family) (*SchemaFamily, error) {
 	return privateTypeRegistry.Lookup(id)
 }
 
+// SetFamilyParent makes a dataset type in the global registry a child of another.
+func SetFamilyParent(id Family, parentId Family) error {
+	return privateTypeRegistry.SetParent(id, parentId)
+}
+
+// SetFamilySchemas restricts the schemas of a dataset type in the global registry.
+func SetFamilySchemas(id Family, schemas ...string) error {
+	return privateTypeRegistry.SetSchemas(id, schemas)
+}
+
+// FamilySchemas returns the schemas allowed for a dataset type in the global registry.
+// It returns nil if any schema is allowed or the type is unknown.
+func FamilySchemas(family Family) []string {
+	fam, err := privateTypeRegistry.Lookup(family)
+	if err != nil {
+		return nil
+	}
+	return fam.Schemas()
+}
+
+// Families returns all dataset types in the global registry ordered by id.
+func Families() []*SchemaFamily {
+	return privateTypeRegistry.Families()
+}
+
 // Let's pre-define some basic dataset types... Not sure if this is the best place for it.
 
 // UntypedDataset is a fall-back dataset type for datasets without type.
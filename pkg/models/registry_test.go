@@ -0,0 +1,76 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestFamilyHierarchy(t *testing.T) {
+	reg := NewTypeRegistry()
+	reg.Register(10, "research dataset", nil, nil, []string{"research_dataset"})
+	reg.Register(11, "ida dataset", nil, nil, nil)
+	reg.Register(12, "att dataset", nil, nil, []string{"att"})
+
+	if err := reg.SetParent(11, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.SetParent(12, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.SetParent(10, 11); err != ErrFamilyCycle {
+		t.Errorf("expected cycle error, got %v", err)
+	}
+	if err := reg.SetParent(11, 99); err != ErrInvalidFamily {
+		t.Errorf("expected invalid family error, got %v", err)
+	}
+
+	parent, _ := reg.Lookup(10)
+	if children := parent.Children(); len(children) != 2 || children[0].Id != 11 || children[1].Id != 12 {
+		t.Errorf("unexpected children: %v", children)
+	}
+
+	ida, _ := reg.Lookup(11)
+	if ida.Parent() != parent {
+		t.Error("expected parent to be set")
+	}
+	if !ida.IsPartial() || ida.Key() != "research_dataset" {
+		t.Errorf("expected inherited key research_dataset, got %q", ida.Key())
+	}
+
+	att, _ := reg.Lookup(12)
+	if att.Key() != "att" {
+		t.Errorf("expected own key att, got %q", att.Key())
+	}
+
+	if !ida.HasKey("research_dataset") || ida.HasKey("research") || ida.HasKey("att") {
+		t.Error("expected only the inherited key to be allowed")
+	}
+
+	if err := reg.SetSchemas(10, []string{"metax-ida", "metax-att"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.SetSchemas(12, []string{"metax-att"}); err != nil {
+		t.Fatal(err)
+	}
+	if !ida.AllowsSchema("metax-ida") || !ida.AllowsSchema("metax-att") || ida.AllowsSchema("other") {
+		t.Errorf("expected inherited schemas, got %v", ida.Schemas())
+	}
+	if att.AllowsSchema("metax-ida") || !att.AllowsSchema("metax-att") {
+		t.Errorf("expected own schemas, got %v", att.Schemas())
+	}
+	if err := reg.SetSchemas(99, nil); err != ErrInvalidFamily {
+		t.Errorf("expected invalid family error, got %v", err)
+	}
+
+	if families := reg.Families(); len(families) != 3 || families[0].Id != 10 {
+		t.Errorf("unexpected families: %v", families)
+	}
+}
+
+func TestFamilyString(t *testing.T) {
+	if s := FamilyOpen.String(); s != "open dataset" {
+		t.Errorf("registered family: expected %q, got %q", "open dataset", s)
+	}
+	if s := Family(99).String(); s != "family 99" {
+		t.Errorf("unknown family: expected %q, got %q", "family 99", s)
+	}
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/CSCfi/qvain-api/pkg/jsonschema"
+)
+
+// ErrUnknownSchema is returned when a schema isn't registered; it is the same value as jsonschema.ErrUnknownSchema.
+var ErrUnknownSchema = jsonschema.ErrUnknownSchema
+
+// Schema is one version of a JSON schema definition for dataset blobs.
+type Schema struct {
+	Name       string
+	Version    int
+	Definition json.RawMessage
+
+	compiled *jsonschema.Schema
+}
+
+// Validate checks a blob against the schema and returns the list of violations.
+// An error is only returned if the blob isn't valid JSON.
+func (schema *Schema) Validate(blob []byte) ([]string, error) {
+	return schema.compiled.Validate(blob)
+}
+
+// SchemaError is returned when a dataset blob doesn't conform to its schema.
+type SchemaError struct {
+	Schema     string
+	Version    int
+	Violations []string
+}
+
+// Error satisfies Go's Error interface.
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("schema %s (version %d): %s", e.Schema, e.Version, strings.Join(e.Violations, "; "))
+}
+
+// SchemaRegistry holds the JSON schemas that dataset blobs are validated against, by name and version.
+// It is safe for concurrent use.
+type SchemaRegistry struct {
+	mu      sync.RWMutex
+	schemas map[string][]*Schema
+}
+
+// NewSchemaRegistry creates an empty schema registry.
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{schemas: make(map[string][]*Schema)}
+}
+
+// Add compiles a schema definition and registers it under the given name and version, replacing an existing definition with the same version.
+func (reg *SchemaRegistry) Add(name string, version int, definition []byte) error {
+	compiled, err := jsonschema.Compile(definition)
+	if err != nil {
+		return err
+	}
+
+	schema := &Schema{
+		Name:       name,
+		Version:    version,
+		Definition: append(json.RawMessage(nil), definition...),
+		compiled:   compiled,
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	versions := reg.schemas[name]
+	for i := range versions {
+		if versions[i].Version == version {
+			versions[i] = schema
+			return nil
+		}
+	}
+	versions = append(versions, schema)
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	reg.schemas[name] = versions
+	return nil
+}
+
+// LoadDir registers all `*.json` files in a directory. Files are named `<name>@<version>.json`;
+// a file without version, `<name>.json`, is registered as version 1.
+func (reg *SchemaRegistry) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range files {
+		name, version, err := parseSchemaName(strings.TrimSuffix(filepath.Base(fn), ".json"))
+		if err != nil {
+			return fmt.Errorf("%s: %s", fn, err)
+		}
+		if version == 0 {
+			version = 1
+		}
+
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		if err := reg.Add(name, version, data); err != nil {
+			return fmt.Errorf("%s: %s", fn, err)
+		}
+	}
+	return nil
+}
+
+// parseSchemaName splits a schema reference of the form `name` or `name@version`; version is 0 if not given.
+func parseSchemaName(ref string) (string, int, error) {
+	sep := strings.LastIndexByte(ref, '@')
+	if sep < 0 {
+		return ref, 0, nil
+	}
+
+	version, err := strconv.Atoi(ref[sep+1:])
+	if err != nil || version < 1 {
+		return "", 0, fmt.Errorf("invalid schema version in %q", ref)
+	}
+	return ref[:sep], version, nil
+}
+
+// Lookup returns the latest version of the named schema, or a specific version if the name has the form `name@version`.
+func (reg *SchemaRegistry) Lookup(name string) (*Schema, error) {
+	name, version, err := parseSchemaName(name)
+	if err != nil {
+		return nil, ErrUnknownSchema
+	}
+
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	versions := reg.schemas[name]
+	if len(versions) == 0 {
+		return nil, ErrUnknownSchema
+	}
+	if version == 0 {
+		return versions[len(versions)-1], nil
+	}
+	for _, schema := range versions {
+		if schema.Version == version {
+			return schema, nil
+		}
+	}
+	return nil, ErrUnknownSchema
+}
+
+// Validate validates a blob against the named schema as resolved by Lookup.
+// It returns a *SchemaError listing the violations if the blob doesn't conform, and ErrUnknownSchema if there is no such schema.
+func (reg *SchemaRegistry) Validate(name string, blob []byte) error {
+	schema, err := reg.Lookup(name)
+	if err != nil {
+		return err
+	}
+
+	violations, err := schema.Validate(blob)
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return &SchemaError{Schema: schema.Name, Version: schema.Version, Violations: violations}
+	}
+	return nil
+}
+
+// Names returns the names of all registered schemas in sorted order.
+func (reg *SchemaRegistry) Names() []string {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	names := make([]string, 0, len(reg.schemas))
+	for name := range reg.schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
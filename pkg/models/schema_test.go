@@ -0,0 +1,47 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestSchemaRegistryVersions(t *testing.T) {
+	reg := NewSchemaRegistry()
+	if err := reg.Add("test", 1, []byte(`{"type":"object"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Add("test", 2, []byte(`{"type":"object","required":["title"]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		version int
+		err     error
+	}{
+		{name: "test", version: 2},
+		{name: "test@1", version: 1},
+		{name: "test@2", version: 2},
+		{name: "test@3", err: ErrUnknownSchema},
+		{name: "test@x", err: ErrUnknownSchema},
+		{name: "other", err: ErrUnknownSchema},
+	}
+
+	for _, test := range tests {
+		schema, err := reg.Lookup(test.name)
+		if err != test.err {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.err, err)
+			continue
+		}
+		if err == nil && schema.Version != test.version {
+			t.Errorf("%s: expected version %d, got %d", test.name, test.version, schema.Version)
+		}
+	}
+
+	if err := reg.Validate("test@1", []byte(`{}`)); err != nil {
+		t.Errorf("expected version 1 to accept empty object, got %v", err)
+	}
+	err := reg.Validate("test", []byte(`{}`))
+	if serr, ok := err.(*SchemaError); !ok || serr.Version != 2 || len(serr.Violations) != 1 {
+		t.Errorf("expected schema error for version 2, got %v", err)
+	}
+}
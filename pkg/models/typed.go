@@ -19,8 +19,8 @@ var (
 
 // TypedDataset is a wrapper around a base dataset that allows different dataset types to fondle the data in ways that pleases them.
 type TypedDataset interface {
-	CreateData(int, string, []byte, map[string]string) error
-	UpdateData(int, string, []byte, map[string]string) error
+	CreateData(Family, string, []byte, map[string]string) error
+	UpdateData(Family, string, []byte, map[string]string) error
 	Unwrap() *Dataset
 }
 
@@ -33,7 +33,7 @@ func CreateDatasetFromJson(creator uuid.UUID, data io.Reader, inject map[string]
 	aux := &struct {
 		Id *uuid.UUID `json:"id"`
 
-		Family *int             `json:"type"`
+		Family *Family          `json:"type"`
 		Schema *string          `json:"schema"`
 		Blob   *json.RawMessage `json:"dataset"`
 
@@ -86,7 +86,7 @@ func UpdateDatasetFromJson(owner uuid.UUID, data io.Reader, inject map[string]st
 	aux := &struct {
 		Id *uuid.UUID `json:"id"`
 
-		Family int              `json:"type"`
+		Family Family           `json:"type"`
 		Schema string           `json:"schema"`
 		Blob   *json.RawMessage `json:"dataset"`
 
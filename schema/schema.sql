@@ -40,10 +40,77 @@ $$ LANGUAGE PLPGSQL;
 
 CREATE SEQUENCE object_id_seq;
 
+-- Function `dataset_search_vector` builds the full-text search document for a dataset from selected blob paths.
+--
+-- Change the paths per schema here to make other fields searchable. All string values below a path are indexed,
+-- so language maps like `{"en": "...", "fi": "..."}` work as is; the `simple` configuration is used because datasets are multilingual.
+-- After replacing the function, refresh the generated column with: UPDATE datasets SET search = DEFAULT;
+--
+-- To add search to an existing database, create this function and run:
+--   ALTER TABLE datasets ADD COLUMN search tsvector GENERATED ALWAYS AS (dataset_search_vector(schema, blob)) STORED;
+--   CREATE INDEX idx_datasets_search ON datasets USING GIN (search);
+CREATE OR REPLACE FUNCTION dataset_search_vector(_schema text, _blob jsonb) RETURNS tsvector AS $$
+    SELECT CASE
+        WHEN _schema IN ('metax-ida', 'metax-att') THEN
+            setweight(jsonb_to_tsvector('simple', coalesce(_blob#>'{research_dataset,title}', '{}'), '["string"]'), 'A') ||
+            setweight(jsonb_to_tsvector('simple', coalesce(_blob#>'{research_dataset,keyword}', '[]'), '["string"]'), 'B') ||
+            setweight(jsonb_to_tsvector('simple', coalesce(_blob#>'{research_dataset,description}', '[]'), '["string"]'), 'C')
+        ELSE
+            setweight(jsonb_to_tsvector('simple', coalesce(_blob->'title', '{}'), '["string"]'), 'A') ||
+            setweight(jsonb_to_tsvector('simple', coalesce(_blob->'keywords', '[]'), '["string"]'), 'B') ||
+            setweight(jsonb_to_tsvector('simple', coalesce(_blob->'description', '{}'), '["string"]'), 'C')
+    END
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Function `dataset_title` extracts the canonical title of a dataset for sorting and title lookups.
+--
+-- Change the title path per schema here; schemas not listed use a top-level `title`, either a plain string or a language map.
+-- Language maps yield the English title, or the Finnish one if there is no English title.
+-- After replacing the function, refresh the generated column with: UPDATE datasets SET title = DEFAULT;
+--
+-- To add the title column to an existing database, create this function and run:
+--   ALTER TABLE datasets ADD COLUMN title text GENERATED ALWAYS AS (dataset_title(schema, blob)) STORED;
+--   CREATE INDEX idx_datasets_title ON datasets (owner, title);
+CREATE OR REPLACE FUNCTION dataset_title(_schema text, _blob jsonb) RETURNS text AS $$
+    SELECT CASE
+        WHEN _schema IN ('metax-ida', 'metax-att') THEN
+            coalesce(_blob#>>'{research_dataset,title,en}', _blob#>>'{research_dataset,title,fi}')
+        ELSE
+            coalesce(_blob#>>'{title,en}', _blob#>>'{title,fi}', CASE WHEN jsonb_typeof(_blob->'title') = 'string' THEN _blob->>'title' END)
+    END
+$$ LANGUAGE sql IMMUTABLE;
+
 -- Table `datasets` contains datasets of different types (families).
 --
 -- The `blob` field has the actual dataset as it is known to external services;
 -- the other fields are internal metadata.
+--
+-- The `origin` field tells datasets created by users apart from those harvested from Metax or restored from an export.
+-- To add it to an existing database, run:
+--   ALTER TABLE datasets ADD COLUMN origin text NOT NULL DEFAULT 'user' CHECK (origin IN ('user', 'service', 'import'));
+--
+-- The `archived` field is set for datasets whose blob has been moved to `archived_datasets`; see that table.
+-- To add it to an existing database, run:
+--   ALTER TABLE datasets ADD COLUMN archived boolean NOT NULL DEFAULT false;
+--
+-- The `slug` field is an optional human-readable handle for shareable links, unique per owner.
+-- To add it to an existing database, run:
+--   ALTER TABLE datasets ADD COLUMN slug text;
+--   CREATE UNIQUE INDEX idx_datasets_slug ON datasets (owner, slug);
+--
+-- The `is_template` field marks datasets any user may copy into their own account with CopyToUser.
+-- To add it to an existing database, run:
+--   ALTER TABLE datasets ADD COLUMN is_template boolean NOT NULL DEFAULT false;
+--
+-- The `compressed` field is set for datasets whose blob is stored gzip-compressed in `blob_gz` instead of `blob`; see `compress_dataset`.
+-- To add compression to an existing database, run:
+--   ALTER TABLE datasets ADD COLUMN compressed boolean NOT NULL DEFAULT false, ADD COLUMN blob_gz bytea;
+-- then create the `dataset_data`, `compress_dataset` and `decompress_dataset` functions and the `datasets_compress`
+-- and `datasets_decompress` triggers, and replace the `datasets_archive` trigger.
+--
+-- The `locked_by` and `locked_until` fields hold a user's edit lock on the dataset; see AcquireLock.
+-- To add them to an existing database, run:
+--   ALTER TABLE datasets ADD COLUMN locked_by uuid, ADD COLUMN locked_until timestamp with time zone;
 CREATE TABLE datasets (
 	id          uuid PRIMARY KEY,
 	creator     uuid,
@@ -52,14 +119,232 @@ CREATE TABLE datasets (
 	created     timestamp with time zone DEFAULT now(),
 	modified    timestamp with time zone DEFAULT now(),
 	synced      timestamp with time zone,
+	deleted     timestamp with time zone,
 	seq         integer DEFAULT 0,
 
 	published   boolean DEFAULT false,
 	valid       boolean DEFAULT false,
+	state       text DEFAULT 'draft' CHECK (state IN ('draft', 'publishing', 'published', 'failed')),
+	metax_id    text,
+	modified_by uuid,
+	origin      text NOT NULL DEFAULT 'user' CHECK (origin IN ('user', 'service', 'import')),
+	archived    boolean NOT NULL DEFAULT false,
+	slug        text,
+	is_template boolean NOT NULL DEFAULT false,
+
+	locked_by   uuid,
+	locked_until timestamp with time zone,
+
+	change_id   bigserial,
+	tags        text[] NOT NULL DEFAULT '{}',
 
 	family      int,
 	schema      text,
-	blob        jsonb
+	blob        jsonb,
+	compressed  boolean NOT NULL DEFAULT false,
+	blob_gz     bytea,
+
+	search      tsvector GENERATED ALWAYS AS (dataset_search_vector(schema, blob)) STORED,
+	title       text GENERATED ALWAYS AS (dataset_title(schema, blob)) STORED
+);
+
+-- Index `idx_datasets_search` supports full-text search.
+CREATE INDEX idx_datasets_search ON datasets USING GIN (search);
+
+-- Index `idx_datasets_title` supports ordering a user's datasets by title.
+CREATE INDEX idx_datasets_title ON datasets (owner, title);
+
+-- Index `idx_datasets_metax_id` speeds up lookups by Metax identifier.
+CREATE INDEX idx_datasets_metax_id ON datasets (metax_id);
+
+-- Index `idx_datasets_tags` supports filtering by tag; tags are stored lowercased.
+CREATE INDEX idx_datasets_tags ON datasets USING GIN (tags);
+
+-- Index `idx_datasets_slug` keeps slugs unique per owner and serves lookups by slug; datasets without a slug don't collide.
+CREATE UNIQUE INDEX idx_datasets_slug ON datasets (owner, slug);
+
+-- Index `idx_datasets_changes` supports polling the changes feed per owner.
+CREATE INDEX idx_datasets_changes ON datasets (owner, change_id);
+
+-- Index `idx_datasets_created` supports listing datasets of all users by creation date for reporting.
+CREATE INDEX idx_datasets_created ON datasets (created);
+
+-- Function `bump_dataset_change_id` gives every updated row a new global change id for the changes feed; inserts get one from the column default.
+CREATE OR REPLACE FUNCTION bump_dataset_change_id() RETURNS trigger AS $$
+BEGIN
+    NEW.change_id := nextval(pg_get_serial_sequence('datasets', 'change_id'));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS datasets_change_id ON datasets;
+CREATE TRIGGER datasets_change_id BEFORE UPDATE ON datasets
+    FOR EACH ROW EXECUTE PROCEDURE bump_dataset_change_id();
+
+-- Function `notify_dataset_change` publishes dataset mutations on the `dataset_changes` channel
+-- so API instances can invalidate their caches; the payload is `operation:id`, for instance `update:053bffbcc41edad4853bea91fc42ea18`.
+--
+-- This can be applied to an existing database as is.
+CREATE OR REPLACE FUNCTION notify_dataset_change() RETURNS trigger AS $$
+DECLARE
+    rec record;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        rec := OLD;
+    ELSE
+        rec := NEW;
+    END IF;
+    PERFORM pg_notify('dataset_changes', lower(TG_OP) || ':' || replace(rec.id::text, '-', ''));
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS datasets_notify ON datasets;
+CREATE TRIGGER datasets_notify AFTER INSERT OR UPDATE OR DELETE ON datasets
+    FOR EACH ROW EXECUTE PROCEDURE notify_dataset_change();
+
+-- Table `dataset_versions` keeps earlier blobs of datasets, keyed by the sequence number the dataset had at the time.
+-- Prune it with PruneVersions to bound its growth. Versions of compressed datasets are kept compressed in `blob_gz`.
+-- To add it to an existing database, run:
+--   ALTER TABLE dataset_versions ADD COLUMN blob_gz bytea;
+CREATE TABLE dataset_versions (
+	id     uuid REFERENCES datasets(id) ON DELETE CASCADE,
+	seq    integer,
+	saved  timestamp with time zone DEFAULT now(),
+	blob   jsonb,
+	blob_gz bytea,
+	PRIMARY KEY (id, seq)
+);
+
+-- Function `archive_dataset_version` saves the previous blob of a dataset to the version history when the blob changes.
+CREATE OR REPLACE FUNCTION archive_dataset_version() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO dataset_versions(id, seq, blob, blob_gz) VALUES (OLD.id, OLD.seq, OLD.blob, OLD.blob_gz)
+    ON CONFLICT (id, seq) DO NOTHING;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Moving a blob to or from cold storage isn't a new version, so the trigger skips archived datasets.
+-- Writing a compressed blob only updates `blob_gz`, so the trigger watches both columns.
+DROP TRIGGER IF EXISTS datasets_archive ON datasets;
+CREATE TRIGGER datasets_archive BEFORE UPDATE OF blob, blob_gz ON datasets
+    FOR EACH ROW WHEN ((OLD.blob IS DISTINCT FROM NEW.blob OR OLD.blob_gz IS DISTINCT FROM NEW.blob_gz) AND NOT OLD.archived AND NOT NEW.archived) EXECUTE PROCEDURE archive_dataset_version();
+
+-- Table `archived_datasets` is cold storage for blobs of rarely accessed published datasets, to keep the `datasets` table small.
+-- Archiving moves the blob here and sets `datasets.archived`; the metadata stays in `datasets`, but the generated `title` and `search`
+-- columns are empty while a dataset is archived, so it doesn't show up in full-text search.
+--
+-- To add cold storage to an existing database, add the `archived` column to `datasets` and create this table,
+-- the `dataset_blob` and `restore_archived_dataset` functions and the `datasets_restore` trigger, and replace the `datasets_archive` trigger.
+CREATE TABLE archived_datasets (
+	dataset     uuid PRIMARY KEY REFERENCES datasets(id) ON DELETE CASCADE,
+	archived    timestamp with time zone NOT NULL DEFAULT now(),
+	blob        jsonb NOT NULL
+);
+
+-- Function `dataset_blob` returns a dataset's blob, reading it from cold storage if the dataset is archived.
+CREATE OR REPLACE FUNCTION dataset_blob(_id uuid, _blob jsonb) RETURNS jsonb AS $$
+    SELECT coalesce(_blob, (SELECT blob FROM archived_datasets WHERE dataset = _id))
+$$ LANGUAGE sql STABLE;
+
+-- Function `restore_archived_dataset` brings an archived dataset back when its blob is replaced.
+-- Updates that modify the archived blob in place, such as patches, can't see it and fail with SQLSTATE QV001; unarchive the dataset first.
+CREATE OR REPLACE FUNCTION restore_archived_dataset() RETURNS trigger AS $$
+BEGIN
+    IF NEW.blob IS NULL THEN
+        RAISE EXCEPTION 'dataset % is archived', OLD.id USING ERRCODE = 'QV001';
+    END IF;
+    NEW.archived := false;
+    DELETE FROM archived_datasets WHERE dataset = OLD.id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS datasets_restore ON datasets;
+CREATE TRIGGER datasets_restore BEFORE UPDATE OF blob ON datasets
+    FOR EACH ROW WHEN (OLD.archived AND NEW.archived) EXECUTE PROCEDURE restore_archived_dataset();
+
+-- Function `dataset_data` returns a dataset's blob as bytes: gzip-compressed if the dataset is compressed, JSON text otherwise.
+-- The application tells the two apart by the gzip magic number, which can't start a JSON document.
+CREATE OR REPLACE FUNCTION dataset_data(_id uuid, _blob jsonb, _blob_gz bytea) RETURNS bytea AS $$
+    SELECT coalesce(_blob_gz, convert_to(dataset_blob(_id, _blob)::text, 'UTF8'))
+$$ LANGUAGE sql STABLE;
+
+-- Function `compress_dataset` clears the JSON blob when a compressed blob is written to `blob_gz`.
+-- Like archived datasets, compressed datasets have empty `title` and `search` columns, jsonb queries don't see their content,
+-- and their versions are kept compressed. Writing a compressed blob to an archived dataset brings it back from cold storage.
+CREATE OR REPLACE FUNCTION compress_dataset() RETURNS trigger AS $$
+BEGIN
+    NEW.blob := NULL;
+    NEW.compressed := true;
+    IF OLD.archived THEN
+        NEW.archived := false;
+        DELETE FROM archived_datasets WHERE dataset = OLD.id;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS datasets_compress ON datasets;
+CREATE TRIGGER datasets_compress BEFORE UPDATE OF blob_gz ON datasets
+    FOR EACH ROW WHEN (NEW.blob_gz IS NOT NULL) EXECUTE PROCEDURE compress_dataset();
+
+-- Function `decompress_dataset` clears the compressed blob when the JSON blob of a compressed dataset is replaced.
+-- Updates that modify the blob in place, such as patches, can't see the compressed blob and fail with SQLSTATE QV002;
+-- compressed datasets only take full replacements.
+CREATE OR REPLACE FUNCTION decompress_dataset() RETURNS trigger AS $$
+BEGIN
+    IF NEW.blob IS NULL THEN
+        RAISE EXCEPTION 'dataset % is compressed', OLD.id USING ERRCODE = 'QV002';
+    END IF;
+    NEW.compressed := false;
+    NEW.blob_gz := NULL;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS datasets_decompress ON datasets;
+CREATE TRIGGER datasets_decompress BEFORE UPDATE OF blob ON datasets
+    FOR EACH ROW WHEN (OLD.compressed AND NEW.compressed) EXECUTE PROCEDURE decompress_dataset();
+
+-- Table `dataset_access` records when a dataset was last read, to find abandoned drafts.
+-- It is kept apart from `datasets` so recording a read doesn't rewrite the dataset row or fire its update triggers.
+CREATE TABLE dataset_access (
+	dataset     uuid PRIMARY KEY REFERENCES datasets(id) ON DELETE CASCADE,
+	accessed    timestamp with time zone NOT NULL DEFAULT now()
+);
+
+-- Table `dataset_grants` gives users other than the owner access to a dataset.
+CREATE TABLE dataset_grants (
+	dataset     uuid REFERENCES datasets(id) ON DELETE CASCADE,
+	grantee     uuid,
+	permission  text NOT NULL CHECK (permission IN ('read', 'write')),
+	created     timestamp with time zone DEFAULT now(),
+	PRIMARY KEY (dataset, grantee)
+);
+
+-- Index `idx_dataset_grants_grantee` speeds up listing the datasets shared with a user.
+CREATE INDEX idx_dataset_grants_grantee ON dataset_grants (grantee);
+
+-- Table `idempotency_keys` maps client-supplied idempotency keys to the dataset created with them, so retried create requests don't create duplicates.
+-- Keys expire after 24 hours; PurgeIdempotencyKeys deletes them.
+CREATE TABLE idempotency_keys (
+	owner    uuid,
+	key      text,
+	dataset  uuid REFERENCES datasets(id) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+	created  timestamp with time zone DEFAULT now(),
+	PRIMARY KEY (owner, key)
+);
+
+-- Table `schemas` holds versioned JSON schema definitions for dataset blobs, loaded into the schema registry at start-up.
+-- Schema files in APP_SCHEMA_DIR are loaded first; definitions here replace those with the same name and version.
+CREATE TABLE schemas (
+	name        text,
+	version     integer,
+	definition  jsonb NOT NULL,
+	created     timestamp with time zone DEFAULT now(),
+	PRIMARY KEY (name, version)
 );
 
 -- Table `identities` lists app users and their external identities.
@@ -92,6 +377,14 @@ CREATE INDEX idx_btree_extid_fairdata ON identities USING BTREE ((extids->>'fair
 -- this index has all key->path->value paths but supports existence checking only.
 CREATE INDEX idx_gin_extid_all ON identities USING GIN (extids jsonb_path_ops);
 
+-- Table `users` holds display information for app users, updated on login, so listings can show who created a dataset.
+CREATE TABLE users (
+	id       uuid PRIMARY KEY,
+	name     text,
+	email    text,
+	updated  timestamp with time zone DEFAULT now()
+);
+
 -- Table `lastsync` stores the time of last synchronisation for a user's records from an external service.
 CREATE TABLE lastsync (
 	uid      uuid PRIMARY KEY REFERENCES identities(uid) ON DELETE CASCADE ON UPDATE CASCADE,
@@ -100,6 +393,30 @@ CREATE TABLE lastsync (
 	msg      text
 );
 
+-- Table `ownership_history` records dataset ownership transfers.
+CREATE TABLE ownership_history (
+	id         bigserial PRIMARY KEY,
+	dataset    uuid,
+	old_owner  uuid,
+	new_owner  uuid,
+	changed    timestamp with time zone DEFAULT now()
+);
+
+CREATE INDEX idx_ownership_history_dataset ON ownership_history (dataset);
+
+-- Table `publish_events` records every attempt to publish a dataset to Metax, successful or not; see PublishHistory.
+-- The uid is the dataset's owner at the time, as only owners can publish.
+CREATE TABLE publish_events (
+	id         bigserial PRIMARY KEY,
+	dataset    uuid REFERENCES datasets(id) ON DELETE CASCADE,
+	uid        uuid,
+	metax_id   text,
+	published  timestamp with time zone NOT NULL DEFAULT now(),
+	success    boolean NOT NULL
+);
+
+CREATE INDEX idx_publish_events_dataset ON publish_events (dataset, published);
+
 -- Table `objects` stores user saved objects.
 CREATE TABLE objects (
     id       bigint NOT NULL DEFAULT next_object_id(),